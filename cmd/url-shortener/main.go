@@ -4,12 +4,34 @@ import (
 	"context"
 	"log"
 	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
 	"github.com/mrvin/url-shortener/internal/cache"
 	"github.com/mrvin/url-shortener/internal/config"
+	"github.com/mrvin/url-shortener/internal/credcache"
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/geoip"
+	"github.com/mrvin/url-shortener/internal/health"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	"github.com/mrvin/url-shortener/internal/httpserver"
+	"github.com/mrvin/url-shortener/internal/httpserver/handlers"
+	"github.com/mrvin/url-shortener/internal/lockout"
 	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/metadata"
+	"github.com/mrvin/url-shortener/internal/metrics"
+	"github.com/mrvin/url-shortener/internal/oidc"
+	"github.com/mrvin/url-shortener/internal/qr"
+	"github.com/mrvin/url-shortener/internal/ratelimit"
+	"github.com/mrvin/url-shortener/internal/reserved"
+	"github.com/mrvin/url-shortener/internal/safety"
+	"github.com/mrvin/url-shortener/internal/session"
 	"github.com/mrvin/url-shortener/internal/storage/postgresql"
+	"github.com/mrvin/url-shortener/internal/tracing"
+	"github.com/mrvin/url-shortener/internal/webhook"
 )
 
 func main() {
@@ -30,8 +52,29 @@ func main() {
 		}
 	}()
 
+	// The background workers and the server stop on these signals.
+	ctx, cancel := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,    // SIGINT, (Control-C)
+		syscall.SIGTERM, // systemd
+		syscall.SIGQUIT,
+	)
+	defer cancel()
+
+	// init tracing
+	info := handlers.BuildInfo()
+	shutdownTracing, err := tracing.Init(ctx, &conf.Tracing, info.Tag)
+	if err != nil {
+		slog.Error("Failed to init tracing: " + err.Error())
+		return
+	}
+	defer func() {
+		if err := shutdownTracing(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("Failed to shutdown tracing: " + err.Error())
+		}
+	}()
+
 	// init storage
-	ctx := context.Background()
 	st, err := postgresql.New(ctx, &conf.DB)
 	if err != nil {
 		slog.Error("Failed to init storage: " + err.Error())
@@ -61,8 +104,144 @@ func main() {
 		}
 	}()
 
+	// init sessions
+	sessions, err := session.New(&conf.Session, c)
+	if err != nil {
+		slog.Error("Failed to init sessions: " + err.Error())
+		return
+	}
+
+	// init verified credentials cache
+	credentials, err := credcache.New(&conf.CredCache)
+	if err != nil {
+		slog.Error("Failed to init credentials cache: " + err.Error())
+		return
+	}
+
+	// init single sign-on
+	var provider *oidc.Provider
+	if conf.OIDC.Issuer != "" {
+		provider, err = oidc.New(ctx, &conf.OIDC)
+		if err != nil {
+			slog.Error("Failed to init oidc provider: " + err.Error())
+			return
+		}
+		slog.Info("Discovered oidc issuer", slog.String("issuer", conf.OIDC.Issuer))
+	}
+
+	// init brute-force protection
+	var lockoutStore lockout.Store = c
+	if conf.Lockout.Store == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	}
+	guard := lockout.New(&conf.Lockout, lockoutStore)
+	slog.Info("Init lockout", slog.String("store", conf.Lockout.Store))
+
+	// init rate limiting
+	var rateLimitStore ratelimit.Store = ratelimit.NewRedisStore(c)
+	if conf.RateLimit.Store == "memory" {
+		rateLimitStore = ratelimit.NewMemoryStore()
+	}
+	limiter := ratelimit.New(&conf.RateLimit, rateLimitStore)
+	slog.Info("Init rate limiting", slog.String("store", conf.RateLimit.Store))
+
+	// init alias rules
+	rules, err := aliases.New(&conf.Aliases)
+	if err != nil {
+		slog.Error("Failed to init alias rules: " + err.Error())
+		return
+	}
+	// Aliases created before the case-insensitive mode was turned on are
+	// brought to lower case, otherwise they could not be found.
+	if conf.Aliases.CaseInsensitive {
+		renamed, conflicts, err := rules.NormalizeStored(ctx, st)
+		if err != nil {
+			slog.Error("Failed to normalize stored aliases: " + err.Error())
+			return
+		}
+		for _, conflict := range conflicts {
+			slog.Error("Alias can not be reached: its lower case form is taken",
+				slog.String("alias", conflict.Alias), slog.String("taken", conflict.Normalized))
+		}
+		slog.Info("Normalized stored aliases", slog.Int("renamed", renamed), slog.Int("conflicts", len(conflicts)))
+	}
+
+	// init reserved aliases
+	filter, err := reserved.New(ctx, &conf.Reserved, st)
+	if err != nil {
+		slog.Error("Failed to init reserved aliases: " + err.Error())
+		return
+	}
+	go filter.Run(ctx)
+	// Links created before their alias became a route can not be reached,
+	// they are reported for the admin to rename.
+	shadowed, err := reserved.Builtin(ctx, st)
+	if err != nil {
+		slog.Error("Failed to check stored aliases: " + err.Error())
+		return
+	}
+	for _, alias := range shadowed {
+		slog.Error("Alias can not be reached: it is taken by a built-in route", slog.String("alias", alias))
+	}
+
+	// init destination checks
+	destinations := destination.New(&conf.Destination)
+
+	// init destination host rules
+	policy, err := hostpolicy.New(ctx, &conf.HostPolicy, st)
+	if err != nil {
+		slog.Error("Failed to init host rules: " + err.Error())
+		return
+	}
+	go policy.Run(ctx)
+
+	// init url safety checks
+	safetyChecker, err := safety.New(&conf.Safety)
+	if err != nil {
+		slog.Error("Failed to init safety checker: " + err.Error())
+		return
+	}
+	scanner := safety.NewScanner(safetyChecker, st, c, conf.Safety.ScanInterval)
+	go scanner.Run(ctx)
+
+	// init page metadata
+	collector := metadata.New(&conf.Metadata, st)
+	go collector.Run(ctx)
+
+	// init qr codes
+	generator, err := qr.New(&conf.QR)
+	if err != nil {
+		slog.Error("Failed to init qr code generator: " + err.Error())
+		return
+	}
+
+	// init geoip
+	locator, err := geoip.New(&conf.GeoIP)
+	if err != nil {
+		slog.Error("Failed to init geoip database: " + err.Error())
+		return
+	}
+	go locator.Run(ctx)
+
+	// init webhooks
+	dispatcher := webhook.New(&conf.Webhook, st)
+	// Deliveries interrupted by the shutdown are released before the
+	// storage is closed.
+	var webhooks sync.WaitGroup
+	webhooks.Go(func() { dispatcher.Run(ctx) })
+	defer webhooks.Wait()
+
+	// init health checks of destinations
+	checker := health.New(&conf.Health, st, dispatcher)
+	go checker.Run(ctx)
+
+	// init metrics
+	m := metrics.New(&conf.Metrics)
+	m.SetBuildInfo(info.Tag, info.Hash, info.Date)
+	m.RegisterDB(st)
+
 	// Start server
-	server := httpserver.New(&conf.HTTP, st, c)
+	server := httpserver.New(&conf.HTTP, st, c, sessions, credentials, provider, guard, limiter, rules, filter, destinations, policy, safetyChecker, scanner, generator, collector, locator, dispatcher, m)
 
 	server.Run(ctx)
 }
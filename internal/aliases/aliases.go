@@ -0,0 +1,188 @@
+package aliases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/errcode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Character classes allowed in aliases.
+const (
+	ClassLower      = "lower"
+	ClassUpper      = "upper"
+	ClassDigit      = "digit"
+	ClassDash       = "dash"
+	ClassUnderscore = "underscore"
+	// ClassUnicode allows letters, digits and combining marks of any script.
+	ClassUnicode = "unicode"
+)
+
+var (
+	ErrInvalidAlias = errcode.New("alias_invalid", "invalid alias")
+	ErrUnknownClass = errors.New("unknown character class")
+)
+
+const scanBatchSize = 1000
+
+//nolint:gochecknoglobals
+var defaultClasses = []string{ClassLower, ClassUpper, ClassDigit, ClassDash, ClassUnderscore}
+
+type Conf struct {
+	// Length bounds in characters, not limited if zero.
+	MinLength int
+	MaxLength int
+	// Allowed character classes, ASCII letters, digits, '-' and '_' if empty.
+	Classes []string
+	// Treat aliases differing only in case as the same alias.
+	CaseInsensitive bool
+}
+
+// Rules normalizes and validates aliases. Every alias coming from a request
+// is normalized before it is validated or looked up, so that the same alias
+// is stored and found the same way.
+type Rules struct {
+	minLength       int
+	maxLength       int
+	allowed         func(r rune) bool
+	caseInsensitive bool
+}
+
+func New(conf *Conf) (*Rules, error) {
+	classes := conf.Classes
+	if len(classes) == 0 {
+		classes = defaultClasses
+	}
+	checks := make([]func(r rune) bool, 0, len(classes))
+	for _, class := range classes {
+		check, err := classCheck(strings.ToLower(strings.TrimSpace(class)))
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	if conf.MaxLength > 0 && conf.MinLength > conf.MaxLength {
+		return nil, fmt.Errorf("min alias length %d is greater than max %d", conf.MinLength, conf.MaxLength)
+	}
+
+	return &Rules{
+		minLength: conf.MinLength,
+		maxLength: conf.MaxLength,
+		allowed: func(r rune) bool {
+			for _, check := range checks {
+				if check(r) {
+					return true
+				}
+			}
+			return false
+		},
+		caseInsensitive: conf.CaseInsensitive,
+	}, nil
+}
+
+// Normalize brings the alias to the NFC form and to lower case in the
+// case-insensitive mode.
+func (r *Rules) Normalize(alias string) string {
+	alias = norm.NFC.String(alias)
+	if r.caseInsensitive {
+		alias = strings.ToLower(alias)
+	}
+
+	return alias
+}
+
+// Validate checks the length and the characters of the normalized alias.
+func (r *Rules) Validate(alias string) error {
+	length := utf8.RuneCountInString(alias)
+	if length == 0 || length < r.minLength {
+		return fmt.Errorf("%w: shorter than %d characters", ErrInvalidAlias, max(r.minLength, 1))
+	}
+	if r.maxLength > 0 && length > r.maxLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidAlias, r.maxLength)
+	}
+	for _, c := range alias {
+		if !r.allowed(c) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidAlias, c)
+		}
+	}
+
+	return nil
+}
+
+// Store lists and renames the stored aliases.
+type Store interface {
+	ScanAliases(ctx context.Context, after string, limit uint64) ([]string, error)
+	RenameAlias(ctx context.Context, alias, newAlias string) error
+}
+
+// Conflict is a stored alias that can not be brought to the normalized form,
+// because another alias already has it.
+type Conflict struct {
+	Alias      string
+	Normalized string
+}
+
+// NormalizeStored renames the stored aliases that are not in the normalized
+// form, like the mixed-case aliases created before the case-insensitive mode
+// was turned on, which can not be found by the normalized aliases of requests
+// otherwise. Aliases whose normalized form is taken are left as they are and
+// returned as conflicts for the admin to resolve.
+func (r *Rules) NormalizeStored(ctx context.Context, store Store) (int, []Conflict, error) {
+	renamed := 0
+	var conflicts []Conflict
+	after := ""
+	for {
+		batch, err := store.ScanAliases(ctx, after, scanBatchSize)
+		if err != nil {
+			return renamed, conflicts, fmt.Errorf("scan aliases: %w", err)
+		}
+		for _, alias := range batch {
+			normalized := r.Normalize(alias)
+			if normalized == alias {
+				continue
+			}
+			err := store.RenameAlias(ctx, alias, normalized)
+			switch {
+			case err == nil:
+				renamed++
+			case errors.Is(err, storage.ErrAliasExists):
+				conflicts = append(conflicts, Conflict{Alias: alias, Normalized: normalized})
+			case errors.Is(err, storage.ErrAliasNotFound):
+				// Deleted in the meantime.
+			default:
+				return renamed, conflicts, fmt.Errorf("rename alias %q: %w", alias, err)
+			}
+		}
+		if len(batch) < scanBatchSize {
+			return renamed, conflicts, nil
+		}
+		after = batch[len(batch)-1]
+	}
+}
+
+func classCheck(class string) (func(r rune) bool, error) {
+	switch class {
+	case ClassLower:
+		return func(r rune) bool { return 'a' <= r && r <= 'z' }, nil
+	case ClassUpper:
+		return func(r rune) bool { return 'A' <= r && r <= 'Z' }, nil
+	case ClassDigit:
+		return func(r rune) bool { return '0' <= r && r <= '9' }, nil
+	case ClassDash:
+		return func(r rune) bool { return r == '-' }, nil
+	case ClassUnderscore:
+		return func(r rune) bool { return r == '_' }, nil
+	case ClassUnicode:
+		return func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownClass, class)
+	}
+}
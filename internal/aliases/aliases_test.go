@@ -0,0 +1,112 @@
+package aliases
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type fakeStore map[string]string
+
+func (f fakeStore) ScanAliases(_ context.Context, after string, limit uint64) ([]string, error) {
+	aliases := make([]string, 0)
+	for alias := range f {
+		if alias > after {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+
+	return aliases[:min(len(aliases), int(limit))], nil
+}
+
+func (f fakeStore) RenameAlias(_ context.Context, alias, newAlias string) error {
+	if _, ok := f[newAlias]; ok {
+		return storage.ErrAliasExists
+	}
+	f[newAlias] = f[alias]
+	delete(f, alias)
+
+	return nil
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		conf       Conf
+		alias      string
+		normalized string
+		valid      bool
+	}{
+		{"default", Conf{}, "Sys_dsgn-1", "Sys_dsgn-1", true},
+		{"default slash", Conf{}, "api/", "api/", false},
+		{"default unicode", Conf{}, "привет", "привет", false},
+		{"empty", Conf{}, "", "", false},
+		{"too short", Conf{MinLength: 3}, "yc", "yc", false},
+		{"too long", Conf{MaxLength: 4}, "zn9edcu", "zn9edcu", false},
+		{"length in characters", Conf{MaxLength: 6, Classes: []string{ClassUnicode}}, "привет", "привет", true},
+		{"lower only", Conf{Classes: []string{ClassLower, ClassDigit}}, "Promo", "Promo", false},
+		{"case insensitive", Conf{Classes: []string{ClassLower}, CaseInsensitive: true}, "Promo", "promo", true},
+		{"unicode nfc", Conf{Classes: []string{ClassUnicode}}, "cafe\u0301", "caf\u00e9", true},
+		{"unicode case insensitive", Conf{Classes: []string{ClassUnicode}, CaseInsensitive: true}, "Привет", "привет", true},
+		{"unicode punctuation", Conf{Classes: []string{ClassUnicode}}, "a.b", "a.b", false},
+	}
+	for _, test := range tests {
+		rules, err := New(&test.conf)
+		if err != nil {
+			t.Fatalf("%s: new: %v", test.name, err)
+		}
+		normalized := rules.Normalize(test.alias)
+		if normalized != test.normalized {
+			t.Errorf("%s: expected normalized %q but received %q", test.name, test.normalized, normalized)
+		}
+		err = rules.Validate(normalized)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %t but received %v", test.name, test.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidAlias) {
+			t.Errorf("%s: expected ErrInvalidAlias but received %v", test.name, err)
+		}
+	}
+
+	if _, err := New(&Conf{Classes: []string{"emoji"}}); !errors.Is(err, ErrUnknownClass) {
+		t.Errorf("expected ErrUnknownClass but received %v", err)
+	}
+	if _, err := New(&Conf{MinLength: 5, MaxLength: 3}); err == nil {
+		t.Errorf("expected error for min length greater than max")
+	}
+}
+
+func TestNormalizeStored(t *testing.T) {
+	rules, err := New(&Conf{CaseInsensitive: true})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	store := fakeStore{
+		"AbC":   "https://example.com/abc",
+		"XyZ":   "https://example.com/upper",
+		"xyz":   "https://example.com/lower",
+		"plain": "https://example.com/plain",
+	}
+
+	renamed, conflicts, err := rules.NormalizeStored(context.Background(), store)
+	if err != nil {
+		t.Fatalf("normalize stored: %v", err)
+	}
+	if renamed != 1 {
+		t.Errorf("expected 1 renamed alias but received %d", renamed)
+	}
+	if expected := []Conflict{{Alias: "XyZ", Normalized: "xyz"}}; !slices.Equal(conflicts, expected) {
+		t.Errorf("expected conflicts %v but received %v", expected, conflicts)
+	}
+	// The pre-existing mixed-case alias is found by the alias of a request.
+	if url := store[rules.Normalize("AbC")]; url != "https://example.com/abc" {
+		t.Errorf(`expected "AbC" to be found but received %q`, url)
+	}
+	if url := store["xyz"]; url != "https://example.com/lower" {
+		t.Errorf(`expected "xyz" to be kept but received %q`, url)
+	}
+}
@@ -2,12 +2,16 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"strconv"
 	"time"
 
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -17,6 +21,42 @@ var (
 
 const ttl = 30 * time.Minute
 
+// Every kind of entry has its own prefix, so that no key of one kind can be
+// reached by a key of another, like a lockout counter by a link alias.
+const (
+	prefixURL             = "url:"
+	prefixRevokedSession  = "session:revoked:"
+	prefixRevokedUser     = "session:revoked-user:"
+	prefixLockoutFailures = "lockout:failures:"
+	prefixLockoutLevel    = "lockout:level:"
+	prefixLockoutLocked   = "lockout:locked:"
+	prefixRateLimit       = "ratelimit:"
+)
+
+// takeToken refills the token bucket by the time elapsed since the last
+// call and takes a token. The time of the Redis server is used so that
+// instances with skewed clocks share buckets correctly.
+//
+//nolint:gochecknoglobals
+var takeToken = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
 type Conf struct {
 	Host     string
 	Port     string
@@ -25,8 +65,8 @@ type Conf struct {
 }
 
 type Cacher interface {
-	GetURL(ctx context.Context, alias string) (string, error)
-	SetURL(ctx context.Context, alias, url string) error
+	GetURL(ctx context.Context, alias string) (*storage.Target, error)
+	SetURL(ctx context.Context, alias string, target *storage.Target) error
 	DeleteURL(ctx context.Context, alias string) error
 }
 
@@ -40,6 +80,9 @@ func New(ctx context.Context, conf *Conf) (*Cache, error) {
 		Password: conf.Password,
 		DB:       conf.Name,
 	})
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		return nil, fmt.Errorf("instrument tracing: %w", err)
+	}
 	if err := rdb.Ping(ctx).Err(); err != nil {
 		return nil, fmt.Errorf("cache ping: %w", err)
 	}
@@ -51,21 +94,39 @@ func (c *Cache) Close() error {
 	return c.conn.Close() //nolint:wrapcheck
 }
 
-func (c *Cache) GetURL(ctx context.Context, alias string) (string, error) {
-	value, err := c.conn.Get(ctx, alias).Result()
+// GetURL returns the cached target of the alias or nil on a cache miss.
+func (c *Cache) GetURL(ctx context.Context, alias string) (*storage.Target, error) {
+	value, err := c.conn.Get(ctx, prefixURL+alias).Bytes()
 	if errors.Is(err, redis.Nil) {
 		slog.DebugContext(ctx, "Cache miss")
-		return "", nil
+		return nil, nil //nolint:nilnil
 	}
 	if err != nil {
-		return "", fmt.Errorf("getting url from cache: %w", err)
+		return nil, fmt.Errorf("getting url from cache: %w", err)
+	}
+	var target storage.Target
+	if err := json.Unmarshal(value, &target); err != nil {
+		return nil, fmt.Errorf("unmarshal url from cache: %w", err)
 	}
 
-	return value, nil
+	return &target, nil
 }
 
-func (c *Cache) SetURL(ctx context.Context, alias, url string) error {
-	if err := c.conn.Set(ctx, alias, url, ttl).Err(); err != nil {
+// SetURL caches the target of the alias, not longer than until the next
+// change of its schedule.
+func (c *Cache) SetURL(ctx context.Context, alias string, target *storage.Target) error {
+	value, err := json.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("marshal url: %w", err)
+	}
+	// The next change is after now, so the expiration is positive: zero
+	// would keep the entry forever.
+	expiration := ttl
+	now := time.Now()
+	if next := target.NextChange(now); !next.IsZero() {
+		expiration = min(expiration, next.Sub(now))
+	}
+	if err := c.conn.Set(ctx, prefixURL+alias, value, expiration).Err(); err != nil {
 		return fmt.Errorf("setting url to cache: %w", err)
 	}
 
@@ -73,7 +134,7 @@ func (c *Cache) SetURL(ctx context.Context, alias, url string) error {
 }
 
 func (c *Cache) DeleteURL(ctx context.Context, alias string) error {
-	count, err := c.conn.Del(ctx, alias).Result()
+	count, err := c.conn.Del(ctx, prefixURL+alias).Result()
 	if err != nil {
 		return fmt.Errorf("deleting url from cache: %w", err)
 	}
@@ -83,3 +144,120 @@ func (c *Cache) DeleteURL(ctx context.Context, alias string) error {
 
 	return nil
 }
+
+func (c *Cache) RevokeSession(ctx context.Context, id string, ttl time.Duration) error {
+	if err := c.conn.Set(ctx, prefixRevokedSession+id, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("setting revoked session to cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) IsSessionRevoked(ctx context.Context, id string) (bool, error) {
+	count, err := c.conn.Exists(ctx, prefixRevokedSession+id).Result()
+	if err != nil {
+		return false, fmt.Errorf("checking revoked session in cache: %w", err)
+	}
+
+	return count != 0, nil
+}
+
+func (c *Cache) RevokeUserSessions(ctx context.Context, username string, before time.Time, ttl time.Duration) error {
+	if err := c.conn.Set(ctx, prefixRevokedUser+username, before.UnixNano(), ttl).Err(); err != nil {
+		return fmt.Errorf("setting revoked user sessions to cache: %w", err)
+	}
+
+	return nil
+}
+
+// UserSessionsRevokedBefore returns the moment before which all sessions of
+// the user are revoked or the zero time if they are not.
+func (c *Cache) UserSessionsRevokedBefore(ctx context.Context, username string) (time.Time, error) {
+	before, err := c.conn.Get(ctx, prefixRevokedUser+username).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("getting revoked user sessions from cache: %w", err)
+	}
+
+	return time.Unix(0, before), nil
+}
+
+func (c *Cache) IncrFailures(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return c.incrWithTTL(ctx, prefixLockoutFailures+key, window)
+}
+
+func (c *Cache) IncrLevel(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return c.incrWithTTL(ctx, prefixLockoutLevel+key, ttl)
+}
+
+func (c *Cache) Lock(ctx context.Context, key string, d time.Duration) error {
+	pipe := c.conn.TxPipeline()
+	pipe.Set(ctx, prefixLockoutLocked+key, 1, d)
+	pipe.Del(ctx, prefixLockoutFailures+key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("setting lockout to cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	d, err := c.conn.PTTL(ctx, prefixLockoutLocked+key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("getting lockout from cache: %w", err)
+	}
+	// Negative values mean the key does not exist or has no expiry.
+	if d < 0 {
+		return 0, nil
+	}
+
+	return d, nil
+}
+
+func (c *Cache) ResetFailures(ctx context.Context, key string) error {
+	if err := c.conn.Del(ctx, prefixLockoutFailures+key).Err(); err != nil {
+		return fmt.Errorf("deleting failures from cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) Unlock(ctx context.Context, key string) error {
+	err := c.conn.Del(ctx, prefixLockoutFailures+key, prefixLockoutLevel+key, prefixLockoutLocked+key).Err()
+	if err != nil {
+		return fmt.Errorf("deleting lockout from cache: %w", err)
+	}
+
+	return nil
+}
+
+// incrWithTTL increments the counter and sets its expiry when it is created.
+func (c *Cache) incrWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := c.conn.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("incrementing counter in cache: %w", err)
+	}
+
+	return incr.Val(), nil
+}
+
+func (c *Cache) TakeToken(ctx context.Context, key string, count int, period time.Duration) (float64, bool, error) {
+	// Tokens per millisecond.
+	rate := float64(count) / (float64(period) / float64(time.Millisecond))
+	values, err := takeToken.Run(ctx, c.conn, []string{prefixRateLimit + key}, count, rate).Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("taking token from cache: %w", err)
+	}
+	allowed, _ := values[0].(int64)
+	strTokens, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(strTokens, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing tokens from cache: %w", err)
+	}
+
+	return tokens, allowed == 1, nil
+}
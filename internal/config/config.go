@@ -5,18 +5,54 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
 	"github.com/mrvin/url-shortener/internal/cache"
+	"github.com/mrvin/url-shortener/internal/credcache"
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/geoip"
+	"github.com/mrvin/url-shortener/internal/health"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	"github.com/mrvin/url-shortener/internal/httpserver"
+	"github.com/mrvin/url-shortener/internal/lockout"
 	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/metadata"
+	"github.com/mrvin/url-shortener/internal/metrics"
+	"github.com/mrvin/url-shortener/internal/oidc"
+	"github.com/mrvin/url-shortener/internal/qr"
+	"github.com/mrvin/url-shortener/internal/ratelimit"
+	"github.com/mrvin/url-shortener/internal/reserved"
+	"github.com/mrvin/url-shortener/internal/safety"
+	"github.com/mrvin/url-shortener/internal/session"
 	"github.com/mrvin/url-shortener/internal/storage/postgresql"
+	"github.com/mrvin/url-shortener/internal/tracing"
+	"github.com/mrvin/url-shortener/internal/webhook"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
 )
 
 type Config struct {
-	DB     postgresql.Conf
-	Cache  cache.Conf
-	HTTP   httpserver.Conf
-	Logger logger.Conf
+	DB          postgresql.Conf
+	Cache       cache.Conf
+	HTTP        httpserver.Conf
+	Session     session.Conf
+	CredCache   credcache.Conf
+	OIDC        oidc.Conf
+	Lockout     lockout.Conf
+	RateLimit   ratelimit.Conf
+	Aliases     aliases.Conf
+	Reserved    reserved.Conf
+	Destination destination.Conf
+	HostPolicy  hostpolicy.Conf
+	Safety      safety.Conf
+	QR          qr.Conf
+	Metadata    metadata.Conf
+	GeoIP       geoip.Conf
+	Health      health.Conf
+	Webhook     webhook.Conf
+	Metrics     metrics.Conf
+	Tracing     tracing.Conf
+	Logger      logger.Conf
 }
 
 // LoadFromEnv will load configuration solely from the environment.
@@ -104,6 +140,272 @@ func (c *Config) LoadFromEnv() {
 	} else {
 		slog.Warn("Empty doc file path")
 	}
+	if strProxies := os.Getenv("HTTP_TRUSTED_PROXIES"); strProxies != "" {
+		if proxies, err := realip.ParsePrefixes(splitList(strProxies)); err != nil {
+			slog.Warn("invalid trusted proxies: " + err.Error())
+		} else {
+			c.HTTP.TrustedProxies = proxies
+		}
+	} else {
+		slog.Warn("Empty trusted proxies, X-Forwarded-For is ignored")
+	}
+	c.HTTP.RedirectType = getInt("HTTP_REDIRECT_TYPE", "default redirect type")
+	if publicURL := os.Getenv("HTTP_PUBLIC_URL"); publicURL != "" {
+		c.HTTP.PublicURL = publicURL
+	} else {
+		slog.Warn("Empty public url, short links are built from the request host")
+	}
+
+	if metricsEnable := os.Getenv("METRICS_ENABLE"); strings.ToLower(metricsEnable) == "true" {
+		c.Metrics.Enabled = true
+		if strNets := os.Getenv("METRICS_ALLOWED_NETS"); strNets != "" {
+			if nets, err := realip.ParsePrefixes(splitList(strNets)); err != nil {
+				slog.Warn("invalid metrics allowed networks: " + err.Error())
+			} else {
+				c.Metrics.AllowedNets = nets
+			}
+		} else {
+			slog.Warn("Empty metrics allowed networks, metrics are public")
+		}
+	} else {
+		slog.Warn("Metrics are disabled")
+	}
+
+	if exporter := os.Getenv("TRACING_EXPORTER"); exporter != "" {
+		c.Tracing.Exporter = strings.ToLower(exporter)
+		c.Tracing.Endpoint = os.Getenv("TRACING_OTLP_ENDPOINT")
+		if strRatio := os.Getenv("TRACING_SAMPLE_RATIO"); strRatio != "" {
+			if ratio, err := strconv.ParseFloat(strRatio, 64); err != nil || ratio < 0 || ratio > 1 {
+				slog.Warn("invalid tracing sample ratio: " + strRatio)
+			} else {
+				c.Tracing.SampleRatio = ratio
+			}
+		}
+	} else {
+		slog.Warn("Tracing is disabled")
+	}
+
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		c.Session.Secret = secret
+	} else {
+		slog.Warn("Empty session secret")
+	}
+	c.Session.TTL = getDuration("SESSION_TTL", "session ttl")
+	// The cookie is secure when the server serves https itself, unless told
+	// otherwise: behind a proxy terminating TLS it has to be set explicitly.
+	switch cookieSecure := strings.ToLower(os.Getenv("SESSION_COOKIE_SECURE")); cookieSecure {
+	case "true":
+		c.Session.CookieSecure = true
+	case "false":
+	default:
+		c.Session.CookieSecure = c.HTTP.IsTLS
+	}
+	if !c.Session.CookieSecure {
+		slog.Warn("Session cookie is sent over insecure connections")
+	}
+
+	c.CredCache.TTL = getDuration("AUTH_CACHE_TTL", "auth cache ttl")
+	if strSize := os.Getenv("AUTH_CACHE_SIZE"); strSize != "" {
+		if size, err := strconv.Atoi(strSize); err != nil {
+			slog.Warn("invalid auth cache size: " + strSize)
+		} else {
+			c.CredCache.Size = size
+		}
+	} else {
+		slog.Warn("Empty auth cache size, auth cache is disabled")
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		c.OIDC.Issuer = issuer
+		if clientID := os.Getenv("OIDC_CLIENT_ID"); clientID != "" {
+			c.OIDC.ClientID = clientID
+		} else {
+			slog.Warn("Empty oidc client id")
+		}
+		if clientSecret := os.Getenv("OIDC_CLIENT_SECRET"); clientSecret != "" {
+			c.OIDC.ClientSecret = clientSecret
+		} else {
+			slog.Warn("Empty oidc client secret")
+		}
+		if redirectURL := os.Getenv("OIDC_REDIRECT_URL"); redirectURL != "" {
+			c.OIDC.RedirectURL = redirectURL
+		} else {
+			slog.Warn("Empty oidc redirect url")
+		}
+		c.OIDC.AllowedDomains = splitList(os.Getenv("OIDC_ALLOWED_DOMAINS"))
+		c.OIDC.AllowedGroups = splitList(os.Getenv("OIDC_ALLOWED_GROUPS"))
+		c.OIDC.AdminGroup = os.Getenv("OIDC_ADMIN_GROUP")
+		c.OIDC.GroupsClaim = os.Getenv("OIDC_GROUPS_CLAIM")
+	} else {
+		slog.Warn("Empty oidc issuer, single sign-on is disabled")
+	}
+
+	if strMax := os.Getenv("LOCKOUT_MAX_FAILURES"); strMax != "" {
+		if maxFailures, err := strconv.Atoi(strMax); err != nil {
+			slog.Warn("invalid lockout max failures: " + strMax)
+		} else {
+			c.Lockout.MaxFailures = maxFailures
+		}
+	} else {
+		slog.Warn("Empty lockout max failures")
+	}
+	c.Lockout.Window = getDuration("LOCKOUT_WINDOW", "lockout window")
+	c.Lockout.BaseLockout = getDuration("LOCKOUT_BASE_DURATION", "lockout base duration")
+	c.Lockout.MaxLockout = getDuration("LOCKOUT_MAX_DURATION", "lockout max duration")
+	if store := os.Getenv("LOCKOUT_STORE"); store != "" {
+		c.Lockout.Store = store
+	} else {
+		slog.Warn("Empty lockout store")
+	}
+
+	c.RateLimit.IP = make(map[string]ratelimit.Limit)
+	c.RateLimit.User = make(map[string]ratelimit.Limit)
+	for _, group := range ratelimit.Groups {
+		key := "RATELIMIT_" + strings.ToUpper(group)
+		if limit, ok := getLimit(key+"_IP", group+" rate limit per address"); ok {
+			c.RateLimit.IP[group] = limit
+		}
+		if limit, ok := getLimit(key+"_USER", group+" rate limit per user"); ok {
+			c.RateLimit.User[group] = limit
+		}
+	}
+	if store := os.Getenv("RATELIMIT_STORE"); store != "" {
+		c.RateLimit.Store = store
+	} else {
+		slog.Warn("Empty rate limit store")
+	}
+
+	c.Aliases.MinLength = getInt("ALIAS_MIN_LENGTH", "min alias length")
+	c.Aliases.MaxLength = getInt("ALIAS_MAX_LENGTH", "max alias length")
+	if classes := os.Getenv("ALIAS_CHARSET"); classes != "" {
+		c.Aliases.Classes = splitList(classes)
+	} else {
+		slog.Warn("Empty alias charset, only ASCII letters, digits, '-' and '_' are allowed")
+	}
+	if caseInsensitive := os.Getenv("ALIAS_CASE_INSENSITIVE"); strings.ToLower(caseInsensitive) == "true" {
+		c.Aliases.CaseInsensitive = true
+	} else {
+		slog.Warn("Aliases are case-sensitive")
+	}
+
+	if reservedAliases := os.Getenv("RESERVED_ALIASES"); reservedAliases != "" {
+		c.Reserved.Aliases = splitList(reservedAliases)
+	} else {
+		slog.Warn("Empty reserved aliases, only the built-in ones are reserved")
+	}
+	c.Reserved.ReloadInterval = getDuration("RESERVED_RELOAD_INTERVAL", "reserved aliases reload interval")
+
+	if schemes := os.Getenv("URL_ALLOWED_SCHEMES"); schemes != "" {
+		c.Destination.Schemes = splitList(schemes)
+	} else {
+		slog.Warn("Empty allowed url schemes, only http and https are allowed")
+	}
+	if ownHosts := os.Getenv("URL_OWN_HOSTS"); ownHosts != "" {
+		c.Destination.OwnHosts = splitList(ownHosts)
+	} else {
+		slog.Warn("Empty own hosts, only the request host is treated as own")
+	}
+	if strDepth := os.Getenv("URL_RESOLVE_DEPTH"); strDepth != "" {
+		if depth, err := strconv.Atoi(strDepth); err != nil {
+			slog.Warn("invalid url resolve depth: " + strDepth)
+		} else {
+			c.Destination.ResolveDepth = depth
+		}
+	} else {
+		slog.Warn("Empty url resolve depth, redirects of destinations are not followed")
+	}
+	c.Destination.ResolveTimeout = getDuration("URL_RESOLVE_TIMEOUT", "url resolve timeout")
+	if stripTracking := os.Getenv("URL_STRIP_TRACKING"); strings.ToLower(stripTracking) == "true" {
+		c.Destination.StripTracking = true
+		if params := os.Getenv("URL_TRACKING_PARAMS"); params != "" {
+			c.Destination.TrackingParams = splitList(params)
+		}
+	} else {
+		slog.Warn("Stripping of tracking parameters is disabled")
+	}
+	if dedup := os.Getenv("URL_DEDUP"); strings.ToLower(dedup) == "true" {
+		c.Destination.Dedup = true
+	} else {
+		slog.Warn("Deduplication of urls is disabled")
+	}
+
+	c.HostPolicy.ReloadInterval = getDuration("HOST_RULES_RELOAD_INTERVAL", "host rules reload interval")
+
+	if feedFile := os.Getenv("SAFETY_FEED_FILE"); feedFile != "" {
+		c.Safety.FeedFile = feedFile
+	} else {
+		slog.Warn("Empty safety feed file, threat feed is disabled")
+	}
+	if httpURL := os.Getenv("SAFETY_HTTP_URL"); httpURL != "" {
+		c.Safety.HTTPURL = httpURL
+		c.Safety.HTTPTimeout = getDuration("SAFETY_HTTP_TIMEOUT", "safety http timeout")
+	} else {
+		slog.Warn("Empty safety http url, http safety checker is disabled")
+	}
+	c.Safety.ScanInterval = getDuration("SAFETY_SCAN_INTERVAL", "safety scan interval")
+
+	if fetch := os.Getenv("METADATA_FETCH"); strings.ToLower(fetch) == "true" {
+		c.Metadata.Enabled = true
+		c.Metadata.Timeout = getDuration("METADATA_TIMEOUT", "metadata fetch timeout")
+		c.Metadata.MaxSize = int64(getInt("METADATA_MAX_SIZE", "metadata max page size"))
+		c.Metadata.MaxRedirects = getInt("METADATA_MAX_REDIRECTS", "metadata max redirects")
+		c.Metadata.QueueSize = getInt("METADATA_QUEUE_SIZE", "metadata queue size")
+	} else {
+		slog.Warn("Fetching of page metadata is disabled")
+	}
+
+	if database := os.Getenv("GEOIP_DATABASE"); database != "" {
+		c.GeoIP.File = database
+		c.GeoIP.ReloadInterval = getDuration("GEOIP_RELOAD_INTERVAL", "geoip reload interval")
+	} else {
+		slog.Warn("Empty geoip database, countries of clicks are not known")
+	}
+
+	c.Health.Interval = getDuration("HEALTH_CHECK_INTERVAL", "health check interval")
+	if c.Health.Interval > 0 {
+		c.Health.Timeout = getDuration("HEALTH_CHECK_TIMEOUT", "health check timeout")
+		c.Health.Concurrency = getInt("HEALTH_CHECK_CONCURRENCY", "health check concurrency")
+		c.Health.HostDelay = getDuration("HEALTH_CHECK_HOST_DELAY", "health check host delay")
+		c.Health.Retries = getInt("HEALTH_CHECK_RETRIES", "health check retries")
+		c.Health.RetryDelay = getDuration("HEALTH_CHECK_RETRY_DELAY", "health check retry delay")
+	}
+
+	c.Webhook.Interval = getDuration("WEBHOOK_INTERVAL", "webhook interval")
+	if c.Webhook.Interval > 0 {
+		c.Webhook.Timeout = getDuration("WEBHOOK_TIMEOUT", "webhook timeout")
+		c.Webhook.Concurrency = getInt("WEBHOOK_CONCURRENCY", "webhook concurrency")
+		c.Webhook.MaxAttempts = getInt("WEBHOOK_MAX_ATTEMPTS", "webhook max attempts")
+		c.Webhook.Retries = getInt("WEBHOOK_RETRIES", "webhook retries")
+		c.Webhook.RetryDelay = getDuration("WEBHOOK_RETRY_DELAY", "webhook retry delay")
+		c.Webhook.Retention = getDuration("WEBHOOK_RETENTION", "webhook retention")
+		for _, str := range splitList(os.Getenv("WEBHOOK_CLICK_THRESHOLDS")) {
+			threshold, err := strconv.ParseUint(str, 10, 64)
+			if err != nil || threshold == 0 {
+				slog.Warn("invalid webhook click threshold: " + str)
+				continue
+			}
+			c.Webhook.ClickThresholds = append(c.Webhook.ClickThresholds, threshold)
+		}
+	}
+
+	c.QR.Size = getInt("QR_SIZE", "qr code size")
+	c.QR.MaxSize = getInt("QR_MAX_SIZE", "qr code max size")
+	c.QR.Level = os.Getenv("QR_LEVEL")
+	if str := os.Getenv("QR_MARGIN"); str != "" {
+		margin, err := strconv.Atoi(str)
+		if err != nil {
+			slog.Warn("invalid qr code margin: " + str)
+		} else {
+			c.QR.Margin = &margin
+		}
+	}
+	c.QR.Foreground = os.Getenv("QR_FOREGROUND")
+	c.QR.Background = os.Getenv("QR_BACKGROUND")
+	if logo := os.Getenv("QR_LOGO"); logo != "" {
+		c.QR.Logo = logo
+	} else {
+		slog.Warn("Empty qr code logo, codes are rendered without logo")
+	}
 
 	if logFilePath := os.Getenv("LOGGER_FILEPATH"); logFilePath != "" {
 		c.Logger.FilePath = logFilePath
@@ -116,3 +418,62 @@ func (c *Config) LoadFromEnv() {
 		slog.Warn("Empty log level")
 	}
 }
+
+// splitList splits a comma-separated list, ignoring empty elements.
+func splitList(str string) []string {
+	var list []string
+	for elem := range strings.SplitSeq(str, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+
+	return list
+}
+
+// getDuration reads a duration like "1m30s" from the environment variable.
+func getDuration(key, name string) time.Duration {
+	str := os.Getenv(key)
+	if str == "" {
+		slog.Warn("Empty " + name)
+		return 0
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		slog.Warn("invalid " + name + ": " + str)
+		return 0
+	}
+
+	return d
+}
+
+func getInt(key, name string) int {
+	str := os.Getenv(key)
+	if str == "" {
+		slog.Warn("Empty " + name)
+		return 0
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		slog.Warn("invalid " + name + ": " + str)
+		return 0
+	}
+
+	return n
+}
+
+// getLimit reads a rate limit like "100/1m" from the environment variable.
+// An empty variable means no limit.
+func getLimit(key, name string) (ratelimit.Limit, bool) {
+	str := os.Getenv(key)
+	if str == "" {
+		return ratelimit.Limit{}, false
+	}
+	limit, err := ratelimit.ParseLimit(str)
+	if err != nil {
+		slog.Warn("invalid " + name + ": " + str)
+		return ratelimit.Limit{}, false
+	}
+
+	return limit, true
+}
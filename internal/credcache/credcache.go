@@ -0,0 +1,154 @@
+package credcache
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const lenKey = 32
+
+type Conf struct {
+	TTL  time.Duration
+	Size int
+}
+
+type digest [sha256.Size]byte
+
+type entry struct {
+	key       digest
+	username  string
+	role      string
+	expiresAt time.Time
+}
+
+// Cache remembers successfully verified credentials for a short time so that
+// repeated Basic auth requests do not hit the database and bcrypt.
+// Credentials are never stored: entries are keyed by HMAC-SHA256 of the
+// username and password with a random per-process key.
+// The least recently used entry is evicted when the cache is full.
+type Cache struct {
+	mu sync.Mutex
+
+	key  []byte
+	ttl  time.Duration
+	size int
+
+	items  map[digest]*list.Element
+	byUser map[string]map[digest]struct{}
+	lru    *list.List
+}
+
+func New(conf *Conf) (*Cache, error) {
+	key := make([]byte, lenKey)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	return &Cache{
+		key:    key,
+		ttl:    conf.TTL,
+		size:   conf.Size,
+		items:  make(map[digest]*list.Element),
+		byUser: make(map[string]map[digest]struct{}),
+		lru:    list.New(),
+	}, nil
+}
+
+// Get returns the role of the user if the credentials were verified recently.
+func (c *Cache) Get(username, password string) (string, bool) {
+	if c.disabled() {
+		return "", false
+	}
+	key := c.digest(username, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	e := elem.Value.(*entry) //nolint:forcetypeassert
+	if time.Now().After(e.expiresAt) {
+		c.remove(elem)
+		return "", false
+	}
+	c.lru.MoveToFront(elem)
+
+	return e.role, true
+}
+
+// Set remembers verified credentials.
+func (c *Cache) Set(username, password, role string) {
+	if c.disabled() {
+		return
+	}
+	key := c.digest(username, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+	}
+	elem := c.lru.PushFront(&entry{
+		key:       key,
+		username:  username,
+		role:      role,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.items[key] = elem
+	if c.byUser[username] == nil {
+		c.byUser[username] = make(map[digest]struct{})
+	}
+	c.byUser[username][key] = struct{}{}
+}
+
+// Invalidate forgets all verified credentials of the user.
+// It must be called when the password of the user changes.
+func (c *Cache) Invalidate(username string) {
+	if c.disabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.byUser[username] {
+		c.remove(c.items[key])
+	}
+}
+
+func (c *Cache) disabled() bool {
+	return c.ttl <= 0 || c.size <= 0
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := elem.Value.(*entry) //nolint:forcetypeassert
+	c.lru.Remove(elem)
+	delete(c.items, e.key)
+	delete(c.byUser[e.username], e.key)
+	if len(c.byUser[e.username]) == 0 {
+		delete(c.byUser, e.username)
+	}
+}
+
+func (c *Cache) digest(username, password string) digest {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(username))
+	h.Write([]byte{0})
+	h.Write([]byte(password))
+
+	var d digest
+	copy(d[:], h.Sum(nil))
+
+	return d
+}
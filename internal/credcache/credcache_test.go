@@ -0,0 +1,67 @@
+package credcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("Hit and miss", func(t *testing.T) {
+		c, _ := New(&Conf{TTL: time.Minute, Size: 10})
+		c.Set("Bob", "qwerty", "user")
+		if role, ok := c.Get("Bob", "qwerty"); !ok || role != "user" {
+			t.Errorf("expected hit with role user but received %q, %t", role, ok)
+		}
+		if _, ok := c.Get("Bob", "wrong"); ok {
+			t.Error("expected miss for wrong password")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		c, _ := New(&Conf{TTL: time.Millisecond, Size: 10})
+		c.Set("Bob", "qwerty", "user")
+		time.Sleep(2 * time.Millisecond)
+		if _, ok := c.Get("Bob", "qwerty"); ok {
+			t.Error("expected miss for expired entry")
+		}
+	})
+
+	t.Run("Evict least recently used", func(t *testing.T) {
+		c, _ := New(&Conf{TTL: time.Minute, Size: 2})
+		c.Set("Bob", "1", "user")
+		c.Set("Alice", "2", "user")
+		c.Get("Bob", "1")
+		c.Set("Jimmy", "3", "user")
+		if _, ok := c.Get("Alice", "2"); ok {
+			t.Error("expected Alice to be evicted")
+		}
+		if _, ok := c.Get("Bob", "1"); !ok {
+			t.Error("expected Bob to stay in cache")
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		c, _ := New(&Conf{TTL: time.Minute, Size: 10})
+		c.Set("Bob", "old", "user")
+		c.Set("Bob", "new", "user")
+		c.Set("Alice", "qwerty", "user")
+		c.Invalidate("Bob")
+		if _, ok := c.Get("Bob", "old"); ok {
+			t.Error("expected miss after invalidate")
+		}
+		if _, ok := c.Get("Bob", "new"); ok {
+			t.Error("expected miss after invalidate")
+		}
+		if _, ok := c.Get("Alice", "qwerty"); !ok {
+			t.Error("expected Alice to stay in cache")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c, _ := New(&Conf{TTL: 0, Size: 10})
+		c.Set("Bob", "qwerty", "user")
+		if _, ok := c.Get("Bob", "qwerty"); ok {
+			t.Error("expected miss when cache is disabled")
+		}
+	})
+}
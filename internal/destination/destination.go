@@ -0,0 +1,252 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mrvin/url-shortener/pkg/errcode"
+)
+
+const (
+	defaultResolveTimeout = 3 * time.Second
+
+	maxDiscardSize = 64 << 10
+)
+
+var (
+	ErrSchemeNotAllowed = errcode.New("scheme_not_allowed", "url scheme is not allowed")
+	ErrSelfReference    = errcode.New("self_reference", "destination points to this service")
+	ErrRedirectLoop     = errcode.New("redirect_loop", "destination redirects back to this service")
+	ErrPrivateAddress   = errors.New("private address")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+//nolint:gochecknoglobals
+var defaultSchemes = []string{"http", "https"}
+
+type Conf struct {
+	// Allowed url schemes, http and https if empty.
+	Schemes []string
+	// Hosts the service is served on besides the Host of the request.
+	OwnHosts []string
+	// How many redirects of the destination are followed to find chains
+	// of short links leading back to the service, disabled if zero.
+	ResolveDepth   int
+	ResolveTimeout time.Duration
+	// Drop tracking parameters like utm_source from the query.
+	StripTracking bool
+	// Tracking parameters, a trailing '*' matches any suffix. Common
+	// analytics parameters if empty.
+	TrackingParams []string
+	// Return the existing link of the user instead of creating a new one
+	// for the same destination.
+	Dedup bool
+}
+
+// Validator rejects destinations that must not be shortened: urls with
+// schemes like javascript: or data: and urls leading back to the service,
+// which would make redirect loops.
+type Validator struct {
+	schemes        []string
+	ownHosts       []string
+	resolveDepth   int
+	client         *http.Client
+	stripTracking  bool
+	trackingParams []string
+	dedup          bool
+}
+
+func New(conf *Conf) *Validator {
+	schemes := defaultSchemes
+	if len(conf.Schemes) != 0 {
+		schemes = make([]string, 0, len(conf.Schemes))
+		for _, scheme := range conf.Schemes {
+			schemes = append(schemes, strings.ToLower(scheme))
+		}
+	}
+	ownHosts := make([]string, 0, len(conf.OwnHosts))
+	for _, host := range conf.OwnHosts {
+		ownHosts = append(ownHosts, normalizeHost(host))
+	}
+	trackingParams := defaultTrackingParams
+	if len(conf.TrackingParams) != 0 {
+		trackingParams = make([]string, 0, len(conf.TrackingParams))
+		for _, param := range conf.TrackingParams {
+			trackingParams = append(trackingParams, strings.ToLower(param))
+		}
+	}
+	timeout := conf.ResolveTimeout
+	if timeout <= 0 {
+		timeout = defaultResolveTimeout
+	}
+
+	return &Validator{
+		schemes:        schemes,
+		ownHosts:       ownHosts,
+		resolveDepth:   conf.ResolveDepth,
+		client:         NewClient(timeout, 0, false),
+		stripTracking:  conf.StripTracking,
+		trackingParams: trackingParams,
+		dedup:          conf.Dedup,
+	}
+}
+
+// Dedup reports whether an existing link of the user to the same
+// destination is returned instead of creating a new one.
+func (v *Validator) Dedup() bool {
+	return v.dedup
+}
+
+// Check validates the destination. requestHost is the Host of the request
+// creating the link, it is treated as one of the own hosts.
+func (v *Validator) Check(ctx context.Context, rawURL, requestHost string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+	if !slices.Contains(v.schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+	isOwn := func(host string) bool {
+		host = normalizeHost(host)
+		return host == normalizeHost(requestHost) || slices.Contains(v.ownHosts, host)
+	}
+	if isOwn(u.Host) {
+		return fmt.Errorf("%w: %s", ErrSelfReference, u.Hostname())
+	}
+
+	return v.resolve(ctx, u, isOwn)
+}
+
+// resolve follows redirects of the destination and fails if one of them
+// leads to the service. Network errors are ignored: the destination may be
+// down at the moment and that is not a reason to reject it.
+func (v *Validator) resolve(ctx context.Context, u *url.URL, isOwn func(host string) bool) error {
+	for range v.resolveDepth {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil
+		}
+		location, err := v.location(ctx, u)
+		if err != nil {
+			slog.DebugContext(ctx, "Resolve destination", slog.String("url", u.String()), slog.String("warn", err.Error()))
+			return nil
+		}
+		if location == nil {
+			return nil
+		}
+		if isOwn(location.Host) {
+			return fmt.Errorf("%w: %s redirects to %s", ErrRedirectLoop, u.Hostname(), location.Hostname())
+		}
+		u = location
+	}
+
+	return nil
+}
+
+// location returns the target of the redirect or nil if the url does not redirect.
+func (v *Validator) location(ctx context.Context, u *url.URL) (*url.URL, error) {
+	res, err := v.do(ctx, http.MethodHead, u)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		if res, err = v.do(ctx, http.MethodGet, u); err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode < 300 || res.StatusCode >= 400 {
+		return nil, nil //nolint:nilnil
+	}
+	location, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("redirect location: %w", err)
+	}
+
+	return location, nil
+}
+
+func (v *Validator) do(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	res.Body.Close()
+
+	return res, nil
+}
+
+// NewClient returns a client that follows up to maxRedirects redirects and,
+// unless allowPrivate is set, refuses to connect to private addresses so
+// that user supplied urls cannot be used to probe the internal network. The
+// address is checked on every connection, redirects included. With zero
+// maxRedirects the first response is returned as is.
+func NewClient(timeout time.Duration, maxRedirects int, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{ //nolint:exhaustruct
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return fmt.Errorf("split address: %w", err)
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return fmt.Errorf("parse address: %w", err)
+			}
+			if addr = addr.Unmap(); !addr.IsGlobalUnicast() || addr.IsPrivate() {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{ //nolint:exhaustruct
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if maxRedirects <= 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return nil
+		},
+	}
+}
+
+// DiscardBody drains a little of the body of the response to let the
+// connection be reused and closes it.
+func DiscardBody(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxDiscardSize))
+	res.Body.Close()
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
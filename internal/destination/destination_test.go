@@ -0,0 +1,159 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	validator := New(&Conf{OwnHosts: []string{"Sho.rt"}})
+	tests := []struct {
+		url         string
+		requestHost string
+		expected    error
+	}{
+		{"https://en.wikipedia.org/wiki/Systems_design", "localhost:8081", nil},
+		{"HTTP://example.com/", "localhost:8081", nil},
+		{"javascript:alert(1)", "localhost:8081", ErrSchemeNotAllowed},
+		{"data:text/html,<script>alert(1)</script>", "localhost:8081", ErrSchemeNotAllowed},
+		{"ftp://example.com/file", "localhost:8081", ErrSchemeNotAllowed},
+		{"https://sho.rt./yc", "localhost:8081", ErrSelfReference},
+		{"http://localhost:8081/yc", "localhost:8081", ErrSelfReference},
+		{"http://localhost/yc", "localhost:8081", ErrSelfReference},
+	}
+	for _, test := range tests {
+		err := validator.Check(context.Background(), test.url, test.requestHost)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v but received %v", test.url, test.expected, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	// The service and the external site listen on the same address, the
+	// service is reached by name so that the hosts differ.
+	own := httptest.NewServer(http.NotFoundHandler())
+	defer own.Close()
+	ownURL := "http://localhost:" + own.URL[strings.LastIndex(own.URL, ":")+1:]
+	chain := http.NewServeMux()
+	chain.Handle("/loop", http.RedirectHandler("/next", http.StatusFound))
+	chain.Handle("/next", http.RedirectHandler(ownURL+"/yc", http.StatusMovedPermanently))
+	chain.HandleFunc("/head-not-allowed", func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			res.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.Redirect(res, req, ownURL+"/yc", http.StatusFound)
+	})
+	chain.Handle("/ok", http.RedirectHandler("/final", http.StatusFound))
+	chain.HandleFunc("/final", func(http.ResponseWriter, *http.Request) {})
+	external := httptest.NewServer(chain)
+	defer external.Close()
+
+	validator := New(&Conf{ResolveDepth: 2})
+	validator.client = NewClient(time.Second, 0, true)
+	requestHost := "localhost"
+	tests := []struct {
+		url      string
+		expected error
+	}{
+		{external.URL + "/loop", ErrRedirectLoop},
+		{external.URL + "/head-not-allowed", ErrRedirectLoop},
+		{external.URL + "/ok", nil},
+	}
+	for _, test := range tests {
+		err := validator.Check(context.Background(), test.url, requestHost)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v but received %v", test.url, test.expected, err)
+		}
+	}
+}
+
+func TestPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("/", http.StatusFound))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodHead, server.URL, nil)
+	if err != nil {
+		t.Fatalf("cant create new request: %v", err)
+	}
+	if _, err := NewClient(time.Second, 0, false).Do(req); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected ErrPrivateAddress but received %v", err)
+	}
+}
+
+func TestClientRedirects(t *testing.T) {
+	// /3 redirects to /2, /2 to /1 and /1 to /0, which answers 200.
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if n := strings.TrimPrefix(req.URL.Path, "/"); n != "0" {
+			http.Redirect(res, req, "/"+string(n[0]-1), http.StatusFound)
+			return
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		maxRedirects int
+		expectedCode int
+		expectedErr  error
+	}{
+		{0, http.StatusFound, nil},
+		{3, http.StatusOK, nil},
+		{2, 0, ErrTooManyRedirects},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/3", nil)
+		if err != nil {
+			t.Fatalf("cant create new request: %v", err)
+		}
+		res, err := NewClient(time.Second, test.maxRedirects, true).Do(req)
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%d: expected %v but received %v", test.maxRedirects, test.expectedErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		DiscardBody(res)
+		if res.StatusCode != test.expectedCode {
+			t.Errorf("%d: expected status code %d but received %d", test.maxRedirects, test.expectedCode, res.StatusCode)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	validator := New(&Conf{StripTracking: true})
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"HTTPS://En.Wikipedia.ORG:443/wiki/Systems_design", "https://en.wikipedia.org/wiki/Systems_design"},
+		{"http://example.com:80", "http://example.com/"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com./", "https://example.com/"},
+		{"https://пример.рф/путь", "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{"https://[2001:DB8::1]:443/", "https://[2001:db8::1]/"},
+		{"https://example.com/?utm_source=tg&id=1&UTM_Medium=x&fbclid=abc#top", "https://example.com/?id=1#top"},
+		{"https://example.com/?utm_source=tg", "https://example.com/"},
+		{"https://example.com/Path/?q=A%20B", "https://example.com/Path/?q=A%20B"},
+	}
+	for _, test := range tests {
+		normalized, err := validator.Normalize(test.url)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.url, err)
+			continue
+		}
+		if normalized != test.expected {
+			t.Errorf("%s: expected %s but received %s", test.url, test.expected, normalized)
+		}
+	}
+
+	normalized, err := New(&Conf{}).Normalize("https://example.com/?utm_source=tg")
+	if err != nil || normalized != "https://example.com/?utm_source=tg" {
+		t.Errorf("expected tracking parameters kept but received %s, %v", normalized, err)
+	}
+}
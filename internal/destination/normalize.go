@@ -0,0 +1,101 @@
+package destination
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+//nolint:gochecknoglobals
+var defaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "mc_cid", "mc_eid", "_openstat",
+}
+
+//nolint:gochecknoglobals
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize returns the canonical form of the url so that trivially
+// different urls of the same destination are stored the same way: the
+// scheme and the host are lowercased, internationalized hosts are converted
+// to punycode, default ports are removed, an empty path becomes "/" and,
+// if enabled, tracking parameters are dropped from the query.
+func (v *Validator) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return u.String(), nil
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if !strings.Contains(host, ":") {
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return "", fmt.Errorf("convert host to punycode: %w", err)
+		}
+	}
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if u.Path == "" && (u.Scheme == "http" || u.Scheme == "https") {
+		u.Path = "/"
+	}
+	if v.stripTracking {
+		u.RawQuery = v.stripQuery(u.RawQuery)
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
+
+// stripQuery drops tracking parameters keeping the order and the encoding
+// of the others.
+func (v *Validator) stripQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil && v.isTracking(key) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+
+	return strings.Join(kept, "&")
+}
+
+func (v *Validator) isTracking(key string) bool {
+	key = strings.ToLower(key)
+	for _, param := range v.trackingParams {
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+
+	return false
+}
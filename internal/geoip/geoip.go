@@ -0,0 +1,160 @@
+// Package geoip tells the country of a client address from a local database
+// in the MaxMind DB format, like GeoLite2-Country or GeoIP2-City.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+const defaultReloadInterval = time.Minute
+
+type Conf struct {
+	// Database file, lookups are disabled if empty.
+	File string
+	// How often the file is checked for changes.
+	ReloadInterval time.Duration
+}
+
+// DB looks countries up in the database file, which is reloaded when it
+// changes. The zero DB and a DB without a file know no countries.
+type DB struct {
+	conf Conf
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+// record holds the fields of the country and the city databases used here.
+// The registered country is the fallback for anycast and satellite networks.
+//
+//nolint:tagliatelle
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func New(conf *Conf) (*DB, error) {
+	c := *conf
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = defaultReloadInterval
+	}
+	db := &DB{conf: c}
+	if c.File == "" {
+		return db, nil
+	}
+	if err := db.reload(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Enabled tells whether the database file is set.
+func (db *DB) Enabled() bool {
+	return db.conf.File != ""
+}
+
+// Run reloads the database when the file changes until the context is done.
+func (db *DB) Run(ctx context.Context) {
+	if !db.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(db.conf.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.reloadIfChanged(ctx); err != nil {
+				// Keep the previous database.
+				slog.WarnContext(ctx, "Reload geoip database", slog.String("warn", err.Error()))
+			}
+		}
+	}
+}
+
+// Country returns the upper case ISO 3166-1 alpha-2 code of the country of
+// the address, or an empty string if it is not known.
+func (db *DB) Country(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	db.mu.RLock()
+	reader := db.reader
+	db.mu.RUnlock()
+	if reader == nil {
+		return ""
+	}
+
+	addr = addr.Unmap()
+	if addr.Is6() && reader.Metadata.IPVersion == 4 {
+		return ""
+	}
+	var rec record
+	if err := reader.Lookup(addr).Decode(&rec); err != nil {
+		return ""
+	}
+	if rec.Country.ISOCode != "" {
+		return strings.ToUpper(rec.Country.ISOCode)
+	}
+
+	return strings.ToUpper(rec.RegisteredCountry.ISOCode)
+}
+
+func (db *DB) reloadIfChanged(ctx context.Context) error {
+	info, err := os.Stat(db.conf.File)
+	if err != nil {
+		return fmt.Errorf("stat geoip database: %w", err)
+	}
+	db.mu.RLock()
+	modTime := db.modTime
+	db.mu.RUnlock()
+	if info.ModTime().Equal(modTime) {
+		return nil
+	}
+	if err := db.reload(); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Reload geoip database", slog.String("path", db.conf.File))
+
+	return nil
+}
+
+// reload reads the whole file into memory rather than mapping it, so that
+// the file may be replaced while the previous database is in use.
+func (db *DB) reload() error {
+	info, err := os.Stat(db.conf.File)
+	if err != nil {
+		return fmt.Errorf("stat geoip database: %w", err)
+	}
+	data, err := os.ReadFile(db.conf.File)
+	if err != nil {
+		return fmt.Errorf("read geoip database: %w", err)
+	}
+	reader, err := maxminddb.OpenBytes(data)
+	if err != nil {
+		return fmt.Errorf("open geoip database: %w", err)
+	}
+
+	db.mu.Lock()
+	db.reader = reader
+	db.modTime = info.ModTime()
+	db.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeDB writes an IPv4 database in the MaxMind DB format with 24 bit
+// records mapping the networks to country records.
+func writeDB(t *testing.T, path string, countries map[string]string) {
+	t.Helper()
+
+	type node struct {
+		// A record is a node index, -1 if empty or -2-i for the data i.
+		records [2]int
+	}
+	nodes := []node{{records: [2]int{-1, -1}}}
+	var data bytes.Buffer
+	for network, country := range countries {
+		prefix := netip.MustParsePrefix(network)
+		offset := data.Len()
+		writeMap(&data, 1)
+		writeString(&data, "country")
+		writeMap(&data, 1)
+		writeString(&data, "iso_code")
+		writeString(&data, country)
+
+		ip := prefix.Addr().As4()
+		current := 0
+		for i := range prefix.Bits() {
+			bit := (ip[i/8] >> (7 - i%8)) & 1
+			if i == prefix.Bits()-1 {
+				nodes[current].records[bit] = -2 - offset
+				break
+			}
+			if nodes[current].records[bit] < 0 {
+				nodes = append(nodes, node{records: [2]int{-1, -1}})
+				nodes[current].records[bit] = len(nodes) - 1
+			}
+			current = nodes[current].records[bit]
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, record := range n.records {
+			value := record
+			switch {
+			case record == -1:
+				value = len(nodes)
+			case record < -1:
+				value = len(nodes) + 16 + (-2 - record)
+			}
+			buf.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	writeMap(&buf, 6)
+	writeString(&buf, "node_count")
+	writeUint32(&buf, uint32(len(nodes)))
+	writeString(&buf, "record_size")
+	writeUint16(&buf, 24)
+	writeString(&buf, "ip_version")
+	writeUint16(&buf, 4)
+	writeString(&buf, "database_type")
+	writeString(&buf, "Test-Country")
+	writeString(&buf, "binary_format_major_version")
+	writeUint16(&buf, 2)
+	writeString(&buf, "binary_format_minor_version")
+	writeUint16(&buf, 0)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+}
+
+func writeMap(buf *bytes.Buffer, size int) {
+	buf.WriteByte(7<<5 | byte(size))
+}
+
+func writeString(buf *bytes.Buffer, str string) {
+	buf.WriteByte(2<<5 | byte(len(str)))
+	buf.WriteString(str)
+}
+
+func writeUint16(buf *bytes.Buffer, value uint16) {
+	buf.WriteByte(5<<5 | 2)
+	buf.Write(binary.BigEndian.AppendUint16(nil, value))
+}
+
+func writeUint32(buf *bytes.Buffer, value uint32) {
+	buf.WriteByte(6<<5 | 4)
+	buf.Write(binary.BigEndian.AppendUint32(nil, value))
+}
+
+func TestCountry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeDB(t, path, map[string]string{"81.2.69.0/24": "gb", "2.125.0.0/16": "DE"})
+	db, err := New(&Conf{File: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"81.2.69.160", "GB"},
+		{"2.125.160.216", "DE"},
+		{"::ffff:81.2.69.1", "GB"},
+		{"8.8.8.8", ""},
+		{"2001:db8::1", ""},
+	}
+	for _, test := range tests {
+		if country := db.Country(netip.MustParseAddr(test.addr)); country != test.expected {
+			t.Errorf("%s: expected %q but received %q", test.addr, test.expected, country)
+		}
+	}
+	if country := db.Country(netip.Addr{}); country != "" {
+		t.Errorf("invalid address: expected empty country but received %q", country)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	db, err := New(&Conf{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if db.Enabled() {
+		t.Error("expected disabled database")
+	}
+	if country := db.Country(netip.MustParseAddr("81.2.69.160")); country != "" {
+		t.Errorf("expected empty country but received %q", country)
+	}
+}
+
+func TestInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, []byte("not a database"), 0o600); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+	if _, err := New(&Conf{File: path}); err == nil {
+		t.Error("expected error for invalid database")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeDB(t, path, map[string]string{"81.2.69.0/24": "GB"})
+	db, err := New(&Conf{File: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	writeDB(t, path, map[string]string{"81.2.69.0/24": "IE"})
+	// The modification time may not change within the resolution of the
+	// file system.
+	if err := os.Chtimes(path, time.Time{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := db.reloadIfChanged(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if country := db.Country(netip.MustParseAddr("81.2.69.160")); country != "IE" {
+		t.Errorf(`expected "IE" but received %q`, country)
+	}
+
+	// A broken file keeps the previous database.
+	if err := os.WriteFile(path, []byte("broken"), 0o600); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+	if err := os.Chtimes(path, time.Time{}, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := db.reloadIfChanged(context.Background()); err == nil {
+		t.Error("expected error for broken database")
+	}
+	if country := db.Country(netip.MustParseAddr("81.2.69.160")); country != "IE" {
+		t.Errorf(`expected "IE" but received %q`, country)
+	}
+}
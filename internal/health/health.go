@@ -0,0 +1,330 @@
+// Package health periodically checks that the destinations of links still
+// answer and records the status, the latency and the time of the check.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/retry"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 10
+	defaultHostDelay   = time.Second
+	defaultRetryDelay  = 2 * time.Second
+
+	scanBatchSize = 500
+	maxRedirects  = 5
+
+	userAgent = "url-shortener-health/1.0"
+)
+
+var errTransient = errors.New("transient failure")
+
+type Conf struct {
+	// How often all destinations are checked, the checks are disabled if zero.
+	Interval time.Duration
+	// Time limit of a request, redirects included.
+	Timeout time.Duration
+	// How many destinations are checked at once.
+	Concurrency int
+	// Least time between two requests to the same host.
+	HostDelay time.Duration
+	// How many times a transient failure is retried.
+	Retries int
+	// Delay before the first retry, doubled before each next one.
+	RetryDelay time.Duration
+}
+
+type HealthStorage interface {
+	ScanHealth(ctx context.Context, after string, limit uint64) ([]storage.HealthState, error)
+	SetHealth(ctx context.Context, alias, url string, health *storage.Health) error
+}
+
+// Notifier tells the owner of the link that its destination broke or
+// recovered.
+type Notifier interface {
+	NotifyHealth(ctx context.Context, state *storage.HealthState, health *storage.Health)
+}
+
+// Checker checks the destinations of all links every interval.
+type Checker struct {
+	conf     Conf
+	client   *http.Client
+	st       HealthStorage
+	notifier Notifier
+}
+
+func New(conf *Conf, st HealthStorage, notifier Notifier) *Checker {
+	c := *conf
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.HostDelay <= 0 {
+		c.HostDelay = defaultHostDelay
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = defaultRetryDelay
+	}
+
+	return &Checker{
+		conf:     c,
+		client:   destination.NewClient(c.Timeout, maxRedirects, false),
+		st:       st,
+		notifier: notifier,
+	}
+}
+
+// Run checks all destinations every interval until the context is canceled.
+func (c *Checker) Run(ctx context.Context) {
+	if c.conf.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checked, broken, err := c.Scan(ctx)
+			if err != nil {
+				slog.WarnContext(ctx, "Health check", slog.String("warn", err.Error()))
+			}
+			slog.InfoContext(ctx, "Health check", slog.Int("checked", checked), slog.Int("broken", broken))
+		}
+	}
+}
+
+// Scan checks the destinations of all not flagged links once and returns the
+// number of links checked and of those found broken.
+func (c *Checker) Scan(ctx context.Context) (int, int, error) {
+	var checked, broken atomic.Int64
+	hosts := newHostLimiter(c.conf.HostDelay)
+	states := make(chan storage.HealthState)
+
+	var wg sync.WaitGroup
+	for range c.conf.Concurrency {
+		wg.Go(func() {
+			for state := range states {
+				health := c.checkAll(ctx, hosts, &state)
+				if ctx.Err() != nil {
+					// The check was interrupted, its result tells nothing.
+					continue
+				}
+				if err := c.update(ctx, &state, health); err != nil {
+					slog.WarnContext(ctx, "Health check", slog.String("alias", state.Alias), slog.String("warn", err.Error()))
+					continue
+				}
+				checked.Add(1)
+				if health.Broken {
+					broken.Add(1)
+				}
+			}
+		})
+	}
+
+	err := c.scan(ctx, states)
+	close(states)
+	wg.Wait()
+
+	return int(checked.Load()), int(broken.Load()), err
+}
+
+func (c *Checker) scan(ctx context.Context, states chan<- storage.HealthState) error {
+	after := ""
+	for {
+		batch, err := c.st.ScanHealth(ctx, after, scanBatchSize)
+		if err != nil {
+			return fmt.Errorf("scan health: %w", err)
+		}
+		for _, state := range batch {
+			select {
+			case states <- state:
+			case <-ctx.Done():
+				return fmt.Errorf("scan health: %w", ctx.Err())
+			}
+		}
+		if len(batch) < scanBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].Alias
+	}
+}
+
+// update stores the health and, if the link broke or recovered, logs the
+// change and notifies the owner. A link deleted or edited during the check is skipped.
+func (c *Checker) update(ctx context.Context, state *storage.HealthState, health *storage.Health) error {
+	if err := c.st.SetHealth(ctx, state.Alias, state.URL, health); err != nil {
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return nil
+		}
+		return fmt.Errorf("set health: %w", err)
+	}
+	if health.Broken == state.Broken {
+		return nil
+	}
+	slog.WarnContext(ctx, "Link health changed",
+		slog.String("username", state.Username),
+		slog.String("alias", state.Alias),
+		slog.String("url", state.URL),
+		slog.Bool("broken", health.Broken),
+		slog.Int("status", health.Status),
+		slog.String("error", health.Error),
+	)
+	if c.notifier != nil {
+		c.notifier.NotifyHealth(ctx, state, health)
+	}
+
+	return nil
+}
+
+// checkAll checks every destination of the link. The link is broken if any
+// of them is: its health is the one of the first broken destination, with
+// the url in the error if it is not the main one, or the one of the main
+// url otherwise.
+func (c *Checker) checkAll(ctx context.Context, hosts *hostLimiter, state *storage.HealthState) *storage.Health {
+	health := c.check(ctx, hosts, state.URL)
+	checked := map[string]bool{state.URL: true}
+	for _, rawURL := range state.Destinations {
+		if health.Broken || ctx.Err() != nil {
+			break
+		}
+		if checked[rawURL] {
+			continue
+		}
+		checked[rawURL] = true
+		if other := c.check(ctx, hosts, rawURL); other.Broken {
+			reason := other.Error
+			if reason == "" {
+				reason = "status " + strconv.Itoa(other.Status)
+			}
+			other.Error = rawURL + ": " + reason
+			health = other
+		}
+	}
+
+	return health
+}
+
+// check requests the url, retrying transient failures, and tells whether the
+// destination is broken: it does not answer, is not found or fails.
+func (c *Checker) check(ctx context.Context, hosts *hostLimiter, rawURL string) *storage.Health {
+	health := &storage.Health{} //nolint:exhaustruct
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		health.Error = err.Error()
+		health.Broken = true
+		health.CheckedAt = time.Now().UTC()
+		return health
+	}
+
+	attempt := func(ctx context.Context) error {
+		if err := hosts.wait(ctx, u.Hostname()); err != nil {
+			return err
+		}
+		start := time.Now()
+		status, err := c.request(ctx, rawURL)
+		health.Status = status
+		health.LatencyMS = time.Since(start).Milliseconds()
+		if err != nil {
+			return err
+		}
+		if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+			return fmt.Errorf("%w: status %d", errTransient, status)
+		}
+		return nil
+	}
+	err = retry.WithDelay(attempt, c.conf.Retries, c.conf.RetryDelay)(ctx)
+
+	health.CheckedAt = time.Now().UTC()
+	if health.Status == 0 && err != nil {
+		health.Error = err.Error()
+	}
+	health.Broken = health.Status == 0 ||
+		health.Status == http.StatusNotFound ||
+		health.Status == http.StatusGone ||
+		health.Status >= http.StatusInternalServerError
+
+	return health
+}
+
+// request sends HEAD, or GET if the destination does not allow HEAD, and
+// returns the status code of the response.
+func (c *Checker) request(ctx context.Context, rawURL string) (int, error) {
+	status, err := c.do(ctx, http.MethodHead, rawURL)
+	if err != nil {
+		return 0, err
+	}
+	if status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented {
+		return c.do(ctx, http.MethodGet, rawURL)
+	}
+
+	return status, nil
+}
+
+func (c *Checker) do(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s: %w", method, rawURL, err)
+	}
+	defer destination.DiscardBody(res)
+
+	return res.StatusCode, nil
+}
+
+// hostLimiter spaces the requests to the same host by the delay.
+type hostLimiter struct {
+	delay time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait reserves the next free slot of the host and waits for it.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.delay)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for host: %w", ctx.Err())
+	}
+}
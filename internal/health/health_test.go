@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	states []storage.HealthState
+	health map[string]storage.Health
+}
+
+func (s *memoryStore) ScanHealth(_ context.Context, after string, limit uint64) ([]storage.HealthState, error) {
+	batch := make([]storage.HealthState, 0)
+	for _, state := range s.states {
+		if state.Alias > after && uint64(len(batch)) < limit {
+			batch = append(batch, state)
+		}
+	}
+
+	return batch, nil
+}
+
+func (s *memoryStore) SetHealth(_ context.Context, alias, url string, health *storage.Health) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, state := range s.states {
+		if state.Alias == alias && state.URL == url {
+			s.health[alias] = *health
+			return nil
+		}
+	}
+
+	return storage.ErrAliasNotFound
+}
+
+type memoryNotifier struct {
+	mu      sync.Mutex
+	changes map[string]bool
+}
+
+func (n *memoryNotifier) NotifyHealth(_ context.Context, state *storage.HealthState, health *storage.Health) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.changes[state.Alias] = health.Broken
+}
+
+func newServer() *httptest.Server {
+	var flaky atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("/get-only", func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			res.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/flaky", func(res http.ResponseWriter, _ *http.Request) {
+		if flaky.Add(1) == 1 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/down", func(res http.ResponseWriter, _ *http.Request) {
+		res.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.Handle("/gone", http.NotFoundHandler())
+	mux.Handle("/moved", http.RedirectHandler("/ok", http.StatusMovedPermanently))
+	mux.Handle("/loop", http.RedirectHandler("/loop", http.StatusFound))
+	mux.HandleFunc("/forbidden", func(res http.ResponseWriter, _ *http.Request) {
+		res.WriteHeader(http.StatusForbidden)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func newChecker(st HealthStorage, notifier Notifier) *Checker {
+	checker := New(&Conf{Retries: 1, RetryDelay: time.Millisecond, HostDelay: time.Millisecond}, st, notifier)
+	checker.client = destination.NewClient(time.Second, maxRedirects, true)
+
+	return checker
+}
+
+func TestCheck(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	checker := newChecker(nil, nil)
+	hosts := newHostLimiter(time.Millisecond)
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedBroken bool
+		expectedError  bool
+	}{
+		{server.URL + "/ok", http.StatusOK, false, false},
+		{server.URL + "/get-only", http.StatusOK, false, false},
+		{server.URL + "/flaky", http.StatusOK, false, false},
+		{server.URL + "/moved", http.StatusOK, false, false},
+		{server.URL + "/forbidden", http.StatusForbidden, false, false},
+		{server.URL + "/gone", http.StatusNotFound, true, false},
+		{server.URL + "/down", http.StatusInternalServerError, true, false},
+		{server.URL + "/loop", 0, true, true},
+		{closed.URL + "/ok", 0, true, true},
+	}
+	for _, test := range tests {
+		health := checker.check(context.Background(), hosts, test.url)
+		if health.Status != test.expectedStatus {
+			t.Errorf("%s: expected status %d but received %d", test.url, test.expectedStatus, health.Status)
+		}
+		if health.Broken != test.expectedBroken {
+			t.Errorf("%s: expected broken %t but received %t", test.url, test.expectedBroken, health.Broken)
+		}
+		if (health.Error != "") != test.expectedError {
+			t.Errorf("%s: unexpected error %q", test.url, health.Error)
+		}
+		if health.CheckedAt.IsZero() {
+			t.Errorf("%s: expected time of the check", test.url)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	st := &memoryStore{
+		states: []storage.HealthState{
+			{Alias: "down", URL: server.URL + "/down", Username: "Bob", Broken: true},
+			{Alias: "gone", URL: server.URL + "/gone", Username: "Bob"},
+			{Alias: "ok", URL: server.URL + "/ok", Username: "Alice"},
+			{Alias: "recovered", URL: server.URL + "/ok", Username: "Alice", Broken: true},
+			{Alias: "variant", URL: server.URL + "/ok", Destinations: []string{server.URL + "/moved", server.URL + "/gone"}, Username: "Alice"},
+		},
+		health: make(map[string]storage.Health),
+	}
+	notifier := &memoryNotifier{changes: make(map[string]bool)}
+	checked, broken, err := newChecker(st, notifier).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if checked != 5 || broken != 3 {
+		t.Errorf("expected 5 checked and 3 broken but received %d and %d", checked, broken)
+	}
+	for alias, expected := range map[string]bool{"down": true, "gone": true, "ok": false, "recovered": false, "variant": true} {
+		if health, ok := st.health[alias]; !ok || health.Broken != expected {
+			t.Errorf("%s: expected broken %t but received %+v", alias, expected, health)
+		}
+	}
+	// Only the links that broke or recovered are notified.
+	if len(notifier.changes) != 3 || !notifier.changes["gone"] || !notifier.changes["variant"] || notifier.changes["recovered"] {
+		t.Errorf(`expected "gone" and "variant" broken and "recovered" notified but received %v`, notifier.changes)
+	}
+	if health := st.health["variant"]; health.Error != server.URL+"/gone: status 404" {
+		t.Errorf("expected the broken variant in the error but received %q", health.Error)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	delay := 20 * time.Millisecond
+	hosts := newHostLimiter(delay)
+	start := time.Now()
+	for range 3 {
+		if err := hosts.wait(context.Background(), "example.com"); err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Errorf("expected at least %v between requests but received %v", 2*delay, elapsed)
+	}
+	start = time.Now()
+	if err := hosts.wait(context.Background(), "example.org"); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("expected other host not to wait but waited %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hosts.wait(context.Background(), "example.net")
+	if err := hosts.wait(ctx, "example.net"); err == nil {
+		t.Error("expected error for canceled context")
+	}
+}
@@ -0,0 +1,244 @@
+package hostpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/errcode"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Lists of rules.
+const (
+	ListDeny  = "deny"
+	ListAllow = "allow"
+)
+
+// Types of rules.
+const (
+	// TypeExact matches the host itself.
+	TypeExact = "exact"
+	// TypeWildcard like "*.example.com" matches the domain and all its subdomains.
+	TypeWildcard = "wildcard"
+	// TypeRegex matches the whole host against the regular expression.
+	TypeRegex = "regex"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid host rule")
+	ErrBlocked     = errcode.New("host_blocked", "destination host is blocked")
+)
+
+type Conf struct {
+	// How often rules are reloaded from the storage to pick up
+	// changes made through other instances.
+	ReloadInterval time.Duration
+}
+
+type Store interface {
+	CreateHostRule(ctx context.Context, rule *storage.HostRule) (int64, error)
+	GetHostRules(ctx context.Context) ([]storage.HostRule, error)
+	DeleteHostRule(ctx context.Context, id int64) error
+}
+
+type matcher func(host string) bool
+
+type compiledRule struct {
+	rule  storage.HostRule
+	match matcher
+}
+
+type ruleSet struct {
+	deny  []compiledRule
+	allow []compiledRule
+}
+
+// Policy checks destination hosts against the denylist and the allowlist.
+// A host is blocked if it matches a denylist rule, or if the allowlist is
+// not empty and the host matches none of its rules.
+type Policy struct {
+	conf  Conf
+	store Store
+	rules atomic.Pointer[ruleSet]
+}
+
+func New(ctx context.Context, conf *Conf, store Store) (*Policy, error) {
+	c := *conf
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = defaultReloadInterval
+	}
+	p := &Policy{conf: c, store: store}
+	if err := p.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Run reloads rules periodically until the context is canceled.
+func (p *Policy) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.conf.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(ctx); err != nil {
+				slog.WarnContext(ctx, "Reload host rules", slog.String("warn", err.Error()))
+			}
+		}
+	}
+}
+
+// Reload replaces the rules in use with the rules from the storage.
+func (p *Policy) Reload(ctx context.Context) error {
+	rules, err := p.store.GetHostRules(ctx)
+	if err != nil {
+		return fmt.Errorf("get host rules: %w", err)
+	}
+	var set ruleSet
+	for _, rule := range rules {
+		match, err := compile(rule.Type, rule.Pattern)
+		if err != nil {
+			// Rules are validated on creation, skip the broken one
+			// rather than drop the whole list.
+			slog.WarnContext(ctx, "Reload host rules", slog.Int64("id", rule.ID), slog.String("warn", err.Error()))
+			continue
+		}
+		if rule.List == ListAllow {
+			set.allow = append(set.allow, compiledRule{rule: rule, match: match})
+		} else {
+			set.deny = append(set.deny, compiledRule{rule: rule, match: match})
+		}
+	}
+	p.rules.Store(&set)
+
+	return nil
+}
+
+// Rules returns all rules from the storage.
+func (p *Policy) Rules(ctx context.Context) ([]storage.HostRule, error) {
+	rules, err := p.store.GetHostRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get host rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// AddRule validates and saves the rule and applies it at once.
+func (p *Policy) AddRule(ctx context.Context, rule *storage.HostRule) (int64, error) {
+	if rule.List != ListDeny && rule.List != ListAllow {
+		return 0, fmt.Errorf("%w: unknown list %q", ErrInvalidRule, rule.List)
+	}
+	rule.Pattern = normalizePattern(rule.Type, rule.Pattern)
+	if _, err := compile(rule.Type, rule.Pattern); err != nil {
+		return 0, err
+	}
+	id, err := p.store.CreateHostRule(ctx, rule)
+	if err != nil {
+		return 0, fmt.Errorf("create host rule: %w", err)
+	}
+	slog.WarnContext(ctx, "Add host rule",
+		slog.Bool("audit", true),
+		slog.Int64("id", id),
+		slog.String("list", rule.List),
+		slog.String("type", rule.Type),
+		slog.String("pattern", rule.Pattern),
+	)
+
+	return id, p.Reload(ctx)
+}
+
+// DeleteRule deletes the rule and applies the change at once.
+func (p *Policy) DeleteRule(ctx context.Context, id int64) error {
+	if err := p.store.DeleteHostRule(ctx, id); err != nil {
+		return fmt.Errorf("delete host rule: %w", err)
+	}
+	slog.WarnContext(ctx, "Delete host rule", slog.Bool("audit", true), slog.Int64("id", id))
+
+	return p.Reload(ctx)
+}
+
+// CheckURL checks the host of the URL.
+func (p *Policy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	return p.CheckHost(u.Hostname())
+}
+
+// CheckHost returns ErrBlocked if the host is not allowed as a destination.
+func (p *Policy) CheckHost(host string) error {
+	set := p.rules.Load()
+	if set == nil {
+		return nil
+	}
+	host = normalizeHost(host)
+	for _, r := range set.deny {
+		if r.match(host) {
+			return fmt.Errorf("%w: %s matches denylist rule %d", ErrBlocked, host, r.rule.ID)
+		}
+	}
+	if len(set.allow) == 0 {
+		return nil
+	}
+	for _, r := range set.allow {
+		if r.match(host) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s is not in the allowlist", ErrBlocked, host)
+}
+
+func compile(typ, pattern string) (matcher, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidRule)
+	}
+	switch typ {
+	case TypeExact:
+		return func(host string) bool { return host == pattern }, nil
+	case TypeWildcard:
+		domain, found := strings.CutPrefix(pattern, "*.")
+		if !found || domain == "" || strings.Contains(domain, "*") {
+			return nil, fmt.Errorf("%w: wildcard must look like *.example.com: %q", ErrInvalidRule, pattern)
+		}
+		return func(host string) bool {
+			return host == domain || strings.HasSuffix(host, "."+domain)
+		}, nil
+	case TypeRegex:
+		re, err := regexp.Compile("^(?i:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidRule, typ)
+	}
+}
+
+func normalizePattern(typ, pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	if typ == TypeRegex {
+		return pattern
+	}
+
+	return normalizeHost(pattern)
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,133 @@
+package hostpolicy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type memoryStore struct {
+	rules  []storage.HostRule
+	nextID int64
+}
+
+func (s *memoryStore) CreateHostRule(_ context.Context, rule *storage.HostRule) (int64, error) {
+	for _, r := range s.rules {
+		if r.List == rule.List && r.Type == rule.Type && r.Pattern == rule.Pattern {
+			return 0, storage.ErrHostRuleExists
+		}
+	}
+	s.nextID++
+	r := *rule
+	r.ID = s.nextID
+	s.rules = append(s.rules, r)
+
+	return r.ID, nil
+}
+
+func (s *memoryStore) GetHostRules(_ context.Context) ([]storage.HostRule, error) {
+	return s.rules, nil
+}
+
+func (s *memoryStore) DeleteHostRule(_ context.Context, id int64) error {
+	for i, r := range s.rules {
+		if r.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrHostRuleNotFound
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	p, err := New(ctx, &Conf{}, &memoryStore{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	rules := []storage.HostRule{
+		{List: ListDeny, Type: TypeExact, Pattern: "Evil.example."},
+		{List: ListDeny, Type: TypeWildcard, Pattern: "*.phishing.test"},
+		{List: ListDeny, Type: TypeRegex, Pattern: `paypa1\..*`},
+	}
+	ids := make([]int64, 0, len(rules))
+	for _, rule := range rules {
+		id, err := p.AddRule(ctx, &rule)
+		if err != nil {
+			t.Fatalf("add rule %q: %v", rule.Pattern, err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://evil.example/login", true},
+		{"https://EVIL.example:8443/", true},
+		{"https://www.evil.example/", false},
+		{"https://phishing.test/", true},
+		{"https://a.b.phishing.test/", true},
+		{"https://notphishing.test/", false},
+		{"https://paypa1.com/", true},
+		{"https://my-paypa1.com/", false},
+		{"https://en.wikipedia.org/wiki/Systems_design", false},
+	}
+	for _, test := range tests {
+		err := p.CheckURL(test.url)
+		if blocked := errors.Is(err, ErrBlocked); blocked != test.blocked {
+			t.Errorf("%s: expected blocked %t but received %v", test.url, test.blocked, err)
+		}
+	}
+
+	// Deleted rules stop blocking at once.
+	if err := p.DeleteRule(ctx, ids[0]); err != nil {
+		t.Fatalf("delete rule: %v", err)
+	}
+	if err := p.CheckURL("https://evil.example/login"); err != nil {
+		t.Errorf("expected not blocked after delete but received %v", err)
+	}
+
+	// A non-empty allowlist blocks all other hosts, the denylist still wins.
+	if _, err := p.AddRule(ctx, &storage.HostRule{List: ListAllow, Type: TypeWildcard, Pattern: "*.example.com"}); err != nil {
+		t.Fatalf("add allow rule: %v", err)
+	}
+	if _, err := p.AddRule(ctx, &storage.HostRule{List: ListDeny, Type: TypeExact, Pattern: "bad.example.com"}); err != nil {
+		t.Fatalf("add deny rule: %v", err)
+	}
+	for url, blocked := range map[string]bool{
+		"https://docs.example.com/": false,
+		"https://example.com/":      false,
+		"https://bad.example.com/":  true,
+		"https://example.org/":      true,
+	} {
+		if err := p.CheckURL(url); errors.Is(err, ErrBlocked) != blocked {
+			t.Errorf("%s: expected blocked %t but received %v", url, blocked, err)
+		}
+	}
+}
+
+func TestAddRuleInvalid(t *testing.T) {
+	ctx := context.Background()
+	p, err := New(ctx, &Conf{}, &memoryStore{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	rules := []storage.HostRule{
+		{List: "block", Type: TypeExact, Pattern: "evil.example"},
+		{List: ListDeny, Type: "prefix", Pattern: "evil"},
+		{List: ListDeny, Type: TypeExact, Pattern: " "},
+		{List: ListDeny, Type: TypeWildcard, Pattern: "evil.example"},
+		{List: ListDeny, Type: TypeWildcard, Pattern: "*.*.example"},
+		{List: ListDeny, Type: TypeRegex, Pattern: "evil("},
+	}
+	for _, rule := range rules {
+		if _, err := p.AddRule(ctx, &rule); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%+v: expected ErrInvalidRule but received %v", rule, err)
+		}
+	}
+}
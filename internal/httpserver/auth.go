@@ -0,0 +1,197 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/httpserver/handlers"
+	"github.com/mrvin/url-shortener/internal/lockout"
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const roleAdmin = "admin"
+
+type UserGetter interface {
+	GetUser(ctx context.Context, name string) (*storage.User, error)
+}
+
+type SessionParser interface {
+	Parse(ctx context.Context, token string) (*session.Claims, error)
+}
+
+type CredentialsCache interface {
+	Get(username, password string) (string, bool)
+	Set(username, password, role string)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, keys ...string) (time.Duration, error)
+	Fail(ctx context.Context, keys ...string) (time.Duration, error)
+	Success(ctx context.Context, keys ...string) error
+}
+
+type authenticator struct {
+	users       UserGetter
+	sessions    SessionParser
+	credentials CredentialsCache
+	guard       LoginGuard
+}
+
+// auth authenticates the request by a bearer token, a session cookie or
+// Basic credentials. Mutating requests authenticated by the session cookie
+// must carry the CSRF token in the X-CSRF-Token header.
+func (a *authenticator) auth(next http.HandlerFunc) http.HandlerFunc {
+	handler := func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		var username, role string
+		if token, ok := bearerToken(req); ok {
+			claims, ok := a.parseSession(ctx, res, token)
+			if !ok {
+				return
+			}
+			username, role = claims.Username, claims.Role
+			ctx = session.WithClaims(ctx, claims)
+		} else if cookie, err := req.Cookie(session.CookieName); err == nil {
+			claims, ok := a.parseSession(ctx, res, cookie.Value)
+			if !ok {
+				return
+			}
+			if !isSafeMethod(req.Method) && !session.CheckCSRF(claims, req.Header.Get(session.CSRFHeaderName)) {
+				http.Error(res, "Forbidden", http.StatusForbidden)
+				return
+			}
+			username, role = claims.Username, claims.Role
+			ctx = session.WithClaims(ctx, claims)
+		} else {
+			var password string
+			username, password, ok = req.BasicAuth()
+			if !ok {
+				http.Error(res, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var code int
+			role, code = a.verifyPassword(ctx, res, realip.Host(req), username, password)
+			if code != http.StatusOK {
+				http.Error(res, http.StatusText(code), code)
+				return
+			}
+		}
+
+		ctx = log.WithUsername(ctx, username)
+		ctx = log.WithRole(ctx, role)
+
+		next(res, req.WithContext(ctx)) // Pass request to next handler
+	}
+
+	return http.HandlerFunc(handler)
+}
+
+// parseSession verifies the session token and writes 401 if it is not valid
+// or 500 if its revocation can not be checked.
+func (a *authenticator) parseSession(ctx context.Context, res http.ResponseWriter, token string) (*session.Claims, bool) {
+	claims, err := a.sessions.Parse(ctx, token)
+	if errors.Is(err, session.ErrUnavailable) {
+		slog.ErrorContext(ctx, "Auth", slog.String("error", err.Error()))
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(res, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// admin allows only authenticated users with the admin role. The role is
+// read from the storage, since the one of a session or of cached credentials
+// may be stale.
+func (a *authenticator) admin(next http.HandlerFunc) http.HandlerFunc {
+	return a.auth(func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		username, err := log.GetUsernameFromCtx(ctx)
+		if err != nil {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		user, err := a.users.GetUser(ctx, username)
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			slog.ErrorContext(ctx, "Auth", slog.String("error", err.Error()))
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || user.Role != roleAdmin {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(res, req)
+	})
+}
+
+// verifyPassword checks Basic credentials against the credentials cache and
+// falls back to the database and bcrypt on a cache miss. Failed attempts are
+// counted per username and per client address.
+func (a *authenticator) verifyPassword(ctx context.Context, res http.ResponseWriter, ip, username, password string) (string, int) {
+	keys := []string{lockout.UserKey(username), lockout.IPKey(ip)}
+	retryAfter, err := a.guard.Check(ctx, keys...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Auth", slog.String("error", err.Error()))
+		return "", http.StatusInternalServerError
+	}
+	if retryAfter > 0 {
+		httpresponse.SetRetryAfter(res, retryAfter)
+		return "", http.StatusTooManyRequests
+	}
+
+	if role, ok := a.credentials.Get(username, password); ok {
+		return role, http.StatusOK
+	}
+	user, err := a.users.GetUser(ctx, username)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		slog.ErrorContext(ctx, "Auth", slog.String("error", err.Error()))
+		return "", http.StatusInternalServerError
+	}
+	if err != nil {
+		handlers.CompareDummyPassword(password)
+	}
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.HashPassword), []byte(password)) != nil {
+		lockedFor, err := a.guard.Fail(ctx, keys...)
+		if err != nil {
+			slog.WarnContext(ctx, "Auth", slog.String("warn", err.Error()))
+		}
+		if lockedFor > 0 {
+			httpresponse.SetRetryAfter(res, lockedFor)
+		}
+		return "", http.StatusUnauthorized
+	}
+	if err := a.guard.Success(ctx, keys[0]); err != nil {
+		slog.WarnContext(ctx, "Auth", slog.String("warn", err.Error()))
+	}
+	a.credentials.Set(username, password, user.Role)
+
+	return user.Role, http.StatusOK
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	header := req.Header.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return header[len(prefix):], true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,134 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/credcache"
+	"github.com/mrvin/url-shortener/internal/lockout"
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type stubUserGetter struct {
+	user *storage.User
+}
+
+func (g stubUserGetter) GetUser(_ context.Context, _ string) (*storage.User, error) {
+	return g.user, nil
+}
+
+type stubSessionParser struct {
+	err error
+}
+
+func (p stubSessionParser) Parse(_ context.Context, _ string) (*session.Claims, error) {
+	return nil, p.err
+}
+
+func newBenchAuthenticator(b *testing.B, conf *credcache.Conf) *authenticator {
+	b.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("qwerty"), bcrypt.DefaultCost)
+	if err != nil {
+		b.Fatalf("generate hash password: %v", err)
+	}
+	credentials, err := credcache.New(conf)
+	if err != nil {
+		b.Fatalf("new credentials cache: %v", err)
+	}
+
+	return &authenticator{
+		users:       stubUserGetter{&storage.User{Name: "Bob", HashPassword: string(hash), Role: "user"}},
+		sessions:    stubSessionParser{session.ErrInvalidToken},
+		credentials: credentials,
+		guard:       lockout.New(&lockout.Conf{}, lockout.NewMemoryStore()),
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("qwerty"), bcrypt.MinCost)
+	credentials, _ := credcache.New(&credcache.Conf{TTL: time.Minute, Size: 10})
+	a := &authenticator{
+		users:       stubUserGetter{&storage.User{Name: "Bob", HashPassword: string(hash), Role: "admin"}},
+		sessions:    stubSessionParser{session.ErrInvalidToken},
+		credentials: credentials,
+		guard:       lockout.New(&lockout.Conf{MaxFailures: 2, BaseLockout: time.Minute}, lockout.NewMemoryStore()),
+	}
+	handler := a.admin(func(res http.ResponseWriter, _ *http.Request) { res.WriteHeader(http.StatusOK) })
+
+	for i, test := range []struct {
+		password   string
+		statusCode int
+		retryAfter string
+	}{
+		{"qwerty", http.StatusOK, ""},
+		{"wrong", http.StatusUnauthorized, ""},
+		{"wrong", http.StatusUnauthorized, "60"},
+		{"qwerty", http.StatusTooManyRequests, "60"},
+	} {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/unlock", nil)
+		req.SetBasicAuth("Bob", test.password)
+		handler.ServeHTTP(res, req)
+		if res.Code != test.statusCode {
+			t.Errorf("attempt %d: expected status code %d but received %d", i+1, test.statusCode, res.Code)
+		}
+		if retryAfter := res.Header().Get("Retry-After"); retryAfter != test.retryAfter {
+			t.Errorf(`attempt %d: expected Retry-After "%s" but received "%s"`, i+1, test.retryAfter, retryAfter)
+		}
+	}
+}
+
+func TestAuthSession(t *testing.T) {
+	for _, test := range []struct {
+		err        error
+		statusCode int
+	}{
+		{session.ErrRevokedToken, http.StatusUnauthorized},
+		{fmt.Errorf("%w: connection refused", session.ErrUnavailable), http.StatusInternalServerError},
+	} {
+		a := &authenticator{sessions: stubSessionParser{test.err}}
+		handler := a.auth(func(res http.ResponseWriter, _ *http.Request) { res.WriteHeader(http.StatusOK) })
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		handler.ServeHTTP(res, req)
+		if res.Code != test.statusCode {
+			t.Errorf("%v: expected status code %d but received %d", test.err, test.statusCode, res.Code)
+		}
+	}
+}
+
+// BenchmarkAuthBasic compares the per-request cost of Basic auth
+// with bcrypt on every request and with the verified credentials cache.
+func BenchmarkAuthBasic(b *testing.B) {
+	next := func(res http.ResponseWriter, _ *http.Request) { res.WriteHeader(http.StatusOK) }
+	req := httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+	req.SetBasicAuth("Bob", "qwerty")
+
+	for _, bench := range []struct {
+		name string
+		conf credcache.Conf
+	}{
+		{"WithoutCache", credcache.Conf{TTL: 0, Size: 0}},
+		{"WithCache", credcache.Conf{TTL: time.Minute, Size: 1000}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			handler := newBenchAuthenticator(b, &bench.conf).auth(next)
+			handler.ServeHTTP(httptest.NewRecorder(), req) // warm up cache
+			for b.Loop() {
+				res := httptest.NewRecorder()
+				handler.ServeHTTP(res, req)
+				if res.Code != http.StatusOK {
+					b.Fatalf("expected status code %d but received %d", http.StatusOK, res.Code)
+				}
+			}
+		})
+	}
+}
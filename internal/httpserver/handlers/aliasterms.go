@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/reserved"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type AliasTermsGetter interface {
+	Terms(ctx context.Context) ([]storage.AliasTerm, error)
+}
+
+type AliasTermAdder interface {
+	AddTerm(ctx context.Context, term *storage.AliasTerm) (int64, error)
+}
+
+type AliasTermDeleter interface {
+	DeleteTerm(ctx context.Context, id int64) error
+}
+
+type RequestCreateAliasTerm struct {
+	Term  string `json:"term"`
+	Match string `json:"match"`
+}
+
+type ResponseCreateAliasTerm struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+type ResponseGetAliasTerms struct {
+	Terms  []storage.AliasTerm `json:"terms"`
+	Status string              `json:"status"`
+}
+
+func NewGetAliasTerms(getter AliasTermsGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		terms, err := getter.Terms(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting alias terms: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetAliasTerms{
+			Terms:  terms,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+func NewCreateAliasTerm(adder AliasTermAdder) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestCreateAliasTerm
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		term := storage.AliasTerm{
+			Term:      request.Term,
+			Match:     request.Match,
+			CreatedBy: username,
+		}
+		id, err := adder.AddTerm(ctx, &term)
+		if err != nil {
+			err = fmt.Errorf("adding alias term: %w", err)
+			switch {
+			case errors.Is(err, reserved.ErrInvalidTerm):
+				return ctx, http.StatusBadRequest, err
+			case errors.Is(err, storage.ErrAliasTermExists):
+				return ctx, http.StatusConflict, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		// Write json response
+		response := ResponseCreateAliasTerm{
+			ID:     id,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.WriteHeader(http.StatusCreated)
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusCreated, nil
+	}
+}
+
+func NewDeleteAliasTerm(deleter AliasTermDeleter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect id value: %w", err)
+		}
+
+		if err := deleter.DeleteTerm(ctx, id); err != nil {
+			err = fmt.Errorf("deleting alias term: %w", err)
+			if errors.Is(err, storage.ErrAliasTermNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordUpdater interface {
+	UserGetter
+	UpdatePassword(ctx context.Context, name, hashPassword string) error
+}
+
+type CredentialsInvalidator interface {
+	Invalidate(username string)
+}
+
+// UserSessionsRevoker invalidates all sessions of a user.
+type UserSessionsRevoker interface {
+	RevokeUser(ctx context.Context, username string) error
+}
+
+//nolint:tagliatelle
+type RequestChangePassword struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6,max=32"`
+}
+
+// NewChangePassword changes the password of the user and signs the user out
+// everywhere: the cached credentials and all sessions, the current one too,
+// stop working.
+func NewChangePassword(updater PasswordUpdater, invalidator CredentialsInvalidator, revoker UserSessionsRevoker) HandlerFunc {
+	validate := validator.New()
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestChangePassword
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		// Validation
+		if err := validate.Struct(request); err != nil {
+			var vErrors validator.ValidationErrors
+			if errors.As(err, &vErrors) {
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s field: %s", vErrors[0].Tag(), vErrors[0].Field())
+			}
+			return ctx, http.StatusInternalServerError, fmt.Errorf("validation: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		user, err := updater.GetUser(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting user from storage: %w", err)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.HashPassword), []byte(request.OldPassword)); err != nil {
+			return ctx, http.StatusUnauthorized, fmt.Errorf("compare hash and password: %w", err)
+		}
+
+		hashPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("generate hash password: %w", err)
+		}
+		if err := updater.UpdatePassword(ctx, username, string(hashPassword)); err != nil {
+			err = fmt.Errorf("updating password in storage: %w", err)
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+		invalidator.Invalidate(username)
+		if err := revoker.RevokeUser(ctx, username); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("revoke sessions: %w", err)
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPasswordUpdater struct {
+	MockUserGetter
+}
+
+func (m *MockPasswordUpdater) UpdatePassword(_ context.Context, name, _ string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+type MockCredentialsInvalidator struct {
+	mock.Mock
+}
+
+func (m *MockCredentialsInvalidator) Invalidate(username string) {
+	m.Called(username)
+}
+
+type MockUserSessionsRevoker struct {
+	mock.Mock
+}
+
+func (m *MockUserSessionsRevoker) RevokeUser(_ context.Context, username string) error {
+	args := m.Called(username)
+	return args.Error(0)
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		OldPassword              string
+		NewPassword              string
+		StatusCode               int
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:                 "Success smoke test",
+			Username:                 "Bob",
+			OldPassword:              "qwerty",
+			NewPassword:              "qwerty123",
+			StatusCode:               http.StatusOK,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error wrong old password",
+			Username:                 "Alice",
+			OldPassword:              "password",
+			NewPassword:              "qwerty123",
+			StatusCode:               http.StatusUnauthorized,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "compare hash and password: crypto/bcrypt: hashedPassword is not the hash of the given password",
+		},
+		{
+			TestName:                 "Error short new password",
+			Username:                 "Jimmy",
+			OldPassword:              "qwerty",
+			NewPassword:              "123",
+			StatusCode:               http.StatusBadRequest,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: min field: NewPassword",
+		},
+	}
+
+	mockUpdater := new(MockPasswordUpdater)
+	mockInvalidator := new(MockCredentialsInvalidator)
+	mockRevoker := new(MockUserSessionsRevoker)
+	handler := ErrorHandler("Change password", NewChangePassword(mockUpdater, mockInvalidator, mockRevoker))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			dataRequest, err := json.Marshal(RequestChangePassword{OldPassword: test.OldPassword, NewPassword: test.NewPassword})
+			if err != nil {
+				t.Fatalf("cant marshal json: %v", err)
+			}
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/api/users/password", bytes.NewReader(dataRequest))
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockUpdater.On("GetUser", test.Username).Return(&storage.User{
+				Name:         test.Username,
+				HashPassword: "$2a$10$WW6Hn.HPGq65LeLsk..b5O9.k4kQpgVWq7LeDwC9GGW9txOkrdybG",
+				Role:         "user",
+			}, nil)
+			mockUpdater.On("UpdatePassword", test.Username).Return(nil)
+			mockInvalidator.On("Invalidate", test.Username).Return()
+			mockRevoker.On("RevokeUser", test.Username).Return(nil)
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			var response httpresponse.RequestError
+			json.Unmarshal(res.Body.Bytes(), &response)
+			if response.Status != test.ExpectedStatus {
+				t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+			}
+			if response.Error != test.ExpectedErrorDescription {
+				t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+			}
+			if test.StatusCode == http.StatusOK {
+				mockInvalidator.AssertCalled(t, "Invalidate", test.Username)
+				mockRevoker.AssertCalled(t, "RevokeUser", test.Username)
+			} else {
+				mockRevoker.AssertNotCalled(t, "RevokeUser", test.Username)
+			}
+		})
+	}
+}
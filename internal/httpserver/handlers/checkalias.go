@@ -9,30 +9,45 @@ import (
 	"github.com/mrvin/url-shortener/internal/logger"
 )
 
+// ResponseCheckAlias reports whether the alias is taken. Reserved aliases
+// are reported as existing too, so that they are never offered as free.
 type ResponseCheckAlias struct {
-	Exists bool   `json:"exists"`
-	Status string `json:"status"`
+	Exists   bool   `json:"exists"`
+	Reserved bool   `json:"reserved"`
+	Valid    bool   `json:"valid"`
+	Status   string `json:"status"`
 }
 
 type AliasChecker interface {
 	CheckAlias(ctx context.Context, alias string) (bool, error)
 }
 
-func NewCheckAlias(checker AliasChecker) HandlerFunc {
+// ReservedChecker checks that the alias is not reserved.
+type ReservedChecker interface {
+	CheckAlias(alias string) error
+}
+
+func NewCheckAlias(checker AliasChecker, rules AliasValidator, reserved ReservedChecker) HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
-		alias := req.PathValue("alias")
+		alias := rules.Normalize(req.PathValue("alias"))
 		ctx := logger.WithAlias(req.Context(), alias)
 
-		exists, err := checker.CheckAlias(ctx, alias)
-		if err != nil {
-			return ctx, http.StatusInternalServerError, fmt.Errorf("check alias in storage: %w", err)
-		}
-
-		// Write json response
 		response := ResponseCheckAlias{
-			Exists: exists,
+			Valid:  rules.Validate(alias) == nil,
 			Status: "OK",
 		}
+		if err := reserved.CheckAlias(alias); err != nil {
+			response.Exists = true
+			response.Reserved = true
+		} else if response.Valid {
+			exists, err := checker.CheckAlias(ctx, alias)
+			if err != nil {
+				return ctx, http.StatusInternalServerError, fmt.Errorf("check alias in storage: %w", err)
+			}
+			response.Exists = exists
+		}
+
+		// Write json response
 		jsonResponse, err := json.Marshal(&response)
 		if err != nil {
 			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
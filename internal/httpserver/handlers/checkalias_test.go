@@ -8,6 +8,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/reserved"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 	"github.com/stretchr/testify/mock"
 )
@@ -21,6 +23,23 @@ func (m *MockAliasChecker) CheckAlias(ctx context.Context, alias string) (bool,
 	return args.Bool(0), args.Error(1)
 }
 
+type MockReservedChecker struct {
+	mock.Mock
+}
+
+func (m *MockReservedChecker) CheckAlias(alias string) error {
+	args := m.Called(alias)
+	return args.Error(0)
+}
+
+func newMockReservedChecker() *MockReservedChecker {
+	mockReservedChecker := new(MockReservedChecker)
+	mockReservedChecker.On("CheckAlias", "api").Return(reserved.ErrReserved)
+	mockReservedChecker.On("CheckAlias", "login.html").Return(reserved.ErrReserved)
+	mockReservedChecker.On("CheckAlias", mock.Anything).Return(nil)
+	return mockReservedChecker
+}
+
 func TestCheckAlias(t *testing.T) {
 	tests := []struct {
 		TestName                 string
@@ -28,6 +47,8 @@ func TestCheckAlias(t *testing.T) {
 		StatusCode               int
 		Error                    error
 		Exists                   bool
+		Reserved                 bool
+		Valid                    bool
 		ExpectedStatus           string
 		ExpectedErrorDescription string
 	}{
@@ -37,6 +58,8 @@ func TestCheckAlias(t *testing.T) {
 			StatusCode:               http.StatusOK,
 			Error:                    nil,
 			Exists:                   false,
+			Reserved:                 false,
+			Valid:                    true,
 			ExpectedStatus:           "OK",
 			ExpectedErrorDescription: "",
 		},
@@ -46,6 +69,41 @@ func TestCheckAlias(t *testing.T) {
 			StatusCode:               http.StatusOK,
 			Error:                    nil,
 			Exists:                   true,
+			Reserved:                 false,
+			Valid:                    true,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Alias reserved",
+			Alias:                    "api",
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			Exists:                   true,
+			Reserved:                 true,
+			Valid:                    true,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Static page reserved",
+			Alias:                    "login.html",
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			Exists:                   true,
+			Reserved:                 true,
+			Valid:                    false,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Alias invalid",
+			Alias:                    "a.b",
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			Exists:                   false,
+			Reserved:                 false,
+			Valid:                    false,
 			ExpectedStatus:           "OK",
 			ExpectedErrorDescription: "",
 		},
@@ -55,6 +113,8 @@ func TestCheckAlias(t *testing.T) {
 			StatusCode:               http.StatusInternalServerError,
 			Error:                    errors.New("internal"),
 			Exists:                   false,
+			Reserved:                 false,
+			Valid:                    true,
 			ExpectedStatus:           "Error",
 			ExpectedErrorDescription: "check alias in storage: internal",
 		},
@@ -62,7 +122,7 @@ func TestCheckAlias(t *testing.T) {
 
 	mockAliasChecker := new(MockAliasChecker)
 	mux := http.NewServeMux()
-	mux.HandleFunc(http.MethodGet+" /api/urls/check/{alias...}", ErrorHandler("Check alias", NewCheckAlias(mockAliasChecker)))
+	mux.HandleFunc(http.MethodGet+" /api/urls/check/{alias...}", ErrorHandler("Check alias", NewCheckAlias(mockAliasChecker, newAliasRules(&aliases.Conf{}), newMockReservedChecker())))
 	for _, test := range tests {
 		t.Run(test.TestName, func(t *testing.T) {
 			t.Parallel()
@@ -89,6 +149,12 @@ func TestCheckAlias(t *testing.T) {
 				if response.Exists != test.Exists {
 					t.Errorf(`expected exists "%t" but received "%t"`, test.Exists, response.Exists)
 				}
+				if response.Reserved != test.Reserved {
+					t.Errorf(`expected reserved "%t" but received "%t"`, test.Reserved, response.Reserved)
+				}
+				if response.Valid != test.Valid {
+					t.Errorf(`expected valid "%t" but received "%t"`, test.Valid, response.Valid)
+				}
 			} else {
 				var response httpresponse.RequestError
 				json.Unmarshal(res.Body.Bytes(), &response)
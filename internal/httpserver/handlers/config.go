@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ResponseConfig tells the web interface which optional features are enabled.
+type ResponseConfig struct {
+	OIDC bool `json:"oidc"`
+}
+
+func NewConfig(oidc bool) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		response := ResponseConfig{OIDC: oidc}
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
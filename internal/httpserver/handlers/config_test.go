@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	for _, oidc := range []bool{true, false} {
+		handler := ErrorHandler("Config", NewConfig(oidc))
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/config", nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		handler.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Errorf("expected status code %d but received %d", http.StatusOK, res.Code)
+		}
+		var response ResponseConfig
+		json.Unmarshal(res.Body.Bytes(), &response)
+		if response.OIDC != oidc {
+			t.Errorf("expected oidc %t but received %t", oidc, response.OIDC)
+		}
+	}
+}
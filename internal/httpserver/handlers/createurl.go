@@ -6,35 +6,87 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"regexp"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/safety"
 	"github.com/mrvin/url-shortener/internal/storage"
-	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/mrvin/url-shortener/internal/webhook"
 )
 
 type URLCreator interface {
-	CreateURL(ctx context.Context, username, url, alias string) error
+	CreateURL(ctx context.Context, username, alias string, target *storage.Target) error
+	GetAliasByURL(ctx context.Context, username string, target *storage.Target) (string, error)
+	UTMDefaultsGetter
 }
 
+// AliasNormalizer brings the alias from a request to the form it is stored in.
+type AliasNormalizer interface {
+	Normalize(alias string) string
+}
+
+// AliasValidator normalizes aliases and checks their length and characters.
+type AliasValidator interface {
+	AliasNormalizer
+	Validate(alias string) error
+}
+
+// DestinationValidator brings the URL to the canonical form and checks its
+// scheme and that it does not lead back to the service. requestHost is the
+// Host of the request.
+type DestinationValidator interface {
+	Normalize(rawURL string) (string, error)
+	Check(ctx context.Context, rawURL, requestHost string) error
+	Dedup() bool
+}
+
+// URLChecker checks that the destination of the URL is not blocked.
+type URLChecker interface {
+	CheckURL(rawURL string) error
+}
+
+// MetadataCollector fetches the metadata of the destination in the background.
+type MetadataCollector interface {
+	Enqueue(alias, rawURL string)
+}
+
+// SafetyChecker checks that the url is not known to be malicious.
+type SafetyChecker interface {
+	Check(ctx context.Context, rawURL string) (safety.Verdict, error)
+}
+
+//nolint:tagliatelle
 type RequestSaveURL struct {
 	URL   string `json:"url"   validate:"required,url"`
-	Alias string `json:"alias" validate:"required,mybase64"`
+	Alias string `json:"alias" validate:"required"`
+	// Status code of the redirect, the server default if omitted.
+	RedirectType int `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 303 307 308"`
+	// Forward the query string and the rest of the path of the request.
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	ForwardPath  bool `json:"forward_path,omitempty"`
+	// Campaign parameters, the defaults of the user if omitted.
+	RequestUTM
+	Title string `json:"title,omitempty" validate:"max=200"`
+	// Other destinations by the device of the client, URL is the fallback.
+	Targets []RequestTargetRule `json:"targets,omitempty" validate:"max=20,dive"`
+	// Destinations of an A/B split of the clients no target matches.
+	Variants []RequestVariant `json:"variants,omitempty" validate:"omitempty,min=2,max=10,dive"`
+	Sticky   bool             `json:"sticky,omitempty"`
+	// Activation window and changes of the url at given moments.
+	RequestSchedule
+}
+
+type ResponseSaveURL struct {
+	Alias string `json:"alias"`
+	storage.UTM
+	Status string `json:"status"`
 }
 
-func NewSaveURL(creator URLCreator) HandlerFunc {
+func NewSaveURL(creator URLCreator, rules AliasValidator, reserved ReservedChecker, destinations DestinationValidator, checker URLChecker, safetyChecker SafetyChecker, collector MetadataCollector, publisher EventPublisher) HandlerFunc {
 	validate := validator.New()
-	// Base62 and '_', '-'
-	myBase64Regex := regexp.MustCompile("^[0-9a-zA-Z_-]+$")
-	err := validate.RegisterValidation("mybase64",
-		func(fl validator.FieldLevel) bool {
-			return myBase64Regex.MatchString(fl.Field().String())
-		})
-	if err != nil {
-		panic(fmt.Errorf("register validation: %w", err))
-	}
 	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
 		ctx := req.Context()
 
@@ -55,27 +107,138 @@ func NewSaveURL(creator URLCreator) HandlerFunc {
 		if err := validate.Struct(request); err != nil {
 			var vErrors validator.ValidationErrors
 			if errors.As(err, &vErrors) {
-				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s value: %s", vErrors[0].Tag(), vErrors[0].Value())
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s value: %v", vErrors[0].Tag(), vErrors[0].Value())
 			}
 			return ctx, http.StatusInternalServerError, fmt.Errorf("validation: %w", err)
 		}
+		request.Alias = rules.Normalize(request.Alias)
+		ctx = logger.WithAlias(ctx, request.Alias)
+		if err := rules.Validate(request.Alias); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("validate alias: %w", err)
+		}
+		if err := reserved.CheckAlias(request.Alias); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("invalid alias: %w", err)
+		}
+
+		request.URL, err = destinations.Normalize(request.URL)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("normalize url: %w", err)
+		}
+		ctx = logger.WithURL(ctx, request.URL)
+
+		if err := destinations.Check(ctx, request.URL, req.Host); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("invalid destination: %w", err)
+		}
+		if err := checker.CheckURL(request.URL); err != nil {
+			return ctx, checkURLStatus(err), fmt.Errorf("check url: %w", err)
+		}
+		if err := checkSafety(ctx, safetyChecker, request.URL); err != nil {
+			return ctx, http.StatusForbidden, fmt.Errorf("check url safety: %w", err)
+		}
+		targets, status, err := checkTargets(ctx, request.Targets, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
+		variants, status, err := checkVariants(ctx, request.Variants, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
+		schedule, status, err := checkSchedule(ctx, &request.RequestSchedule, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
 
 		username, err := logger.GetUsernameFromCtx(ctx)
 		if err != nil {
 			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
 		}
 
-		if err := creator.CreateURL(ctx, username, request.URL, request.Alias); err != nil {
-			err = fmt.Errorf("saving url to storage: %w", err)
-			if errors.Is(err, storage.ErrAliasExists) {
-				return ctx, http.StatusConflict, err
+		defaults, err := creator.GetUTMDefaults(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting utm defaults from storage: %w", err)
+		}
+		utm := withUTMDefaults(request.RequestUTM, defaults)
+
+		target := storage.Target{
+			URL:          request.URL,
+			RedirectType: request.RedirectType,
+			ForwardQuery: request.ForwardQuery,
+			ForwardPath:  request.ForwardPath,
+			UTM:          utm,
+			Title:        request.Title,
+			Targets:      targets,
+			Variants:     variants,
+			Sticky:       request.Sticky,
+			Schedule:     schedule,
+		}
+		status = http.StatusCreated
+		alias := ""
+		// A link with targets, variants or a schedule is not the same as a
+		// plain link to the fallback.
+		if destinations.Dedup() && len(targets) == 0 && len(variants) == 0 && schedule.ActiveFrom == nil &&
+			schedule.ActiveUntil == nil && len(schedule.Changes) == 0 {
+			alias, err = creator.GetAliasByURL(ctx, username, &target)
+			if err != nil && !errors.Is(err, storage.ErrURLNotFound) {
+				return ctx, http.StatusInternalServerError, fmt.Errorf("getting alias from storage: %w", err)
+			}
+		}
+		if alias != "" {
+			// The user already has the same link to this destination.
+			status = http.StatusOK
+			ctx = logger.WithAlias(ctx, alias)
+		} else {
+			alias = request.Alias
+			if err := creator.CreateURL(ctx, username, alias, &target); err != nil {
+				err = fmt.Errorf("saving url to storage: %w", err)
+				if errors.Is(err, storage.ErrAliasExists) {
+					return ctx, http.StatusConflict, err
+				}
+				return ctx, http.StatusInternalServerError, err
 			}
-			return ctx, http.StatusInternalServerError, err
+			collector.Enqueue(alias, target.URL)
+			publish(ctx, publisher, webhook.EventCreated, &webhook.Link{
+				Username:    username,
+				Alias:       alias,
+				URL:         target.URL,
+				ActiveUntil: target.ActiveUntil,
+			})
 		}
 
 		// Write json response
-		httpresponse.WriteOK(res, http.StatusCreated)
+		response := ResponseSaveURL{
+			Alias:  alias,
+			UTM:    utm,
+			Status: "OK",
+		}
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.WriteHeader(status)
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, status, nil
+	}
+}
+
+func checkURLStatus(err error) int {
+	if errors.Is(err, hostpolicy.ErrBlocked) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
 
-		return ctx, http.StatusCreated, nil
+// checkSafety rejects unsafe urls. It fails open: when the checker is
+// unavailable the url is accepted and left to the periodic scan.
+func checkSafety(ctx context.Context, checker SafetyChecker, rawURL string) error {
+	verdict, err := checker.Check(ctx, rawURL)
+	if err != nil {
+		slog.WarnContext(ctx, "Safety check", slog.String("warn", err.Error()))
+		return nil
 	}
+
+	return verdict.Err() //nolint:wrapcheck
 }
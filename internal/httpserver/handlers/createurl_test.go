@@ -7,9 +7,15 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/safety"
 	"github.com/mrvin/url-shortener/internal/storage"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 	"github.com/stretchr/testify/mock"
@@ -19,20 +25,74 @@ type MockURLCreator struct {
 	mock.Mock
 }
 
-func (m *MockURLCreator) CreateURL(_ context.Context, username, url, alias string) error {
-	args := m.Called(username, url, alias)
+func (m *MockURLCreator) CreateURL(_ context.Context, username, alias string, target *storage.Target) error {
+	args := m.Called(username, target.URL, alias)
 	return args.Error(0)
 }
 
+func (m *MockURLCreator) GetAliasByURL(_ context.Context, username string, target *storage.Target) (string, error) {
+	args := m.Called(username, target)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockURLCreator) GetUTMDefaults(_ context.Context, username string) (*storage.UTM, error) {
+	args := m.Called(username)
+	return args.Get(0).(*storage.UTM), args.Error(1)
+}
+
+type MockURLChecker struct {
+	mock.Mock
+}
+
+func (m *MockURLChecker) CheckURL(rawURL string) error {
+	args := m.Called(rawURL)
+	return args.Error(0)
+}
+
+type MockSafetyChecker struct {
+	mock.Mock
+}
+
+func (m *MockSafetyChecker) Check(_ context.Context, rawURL string) (safety.Verdict, error) {
+	args := m.Called(rawURL)
+	return args.Get(0).(safety.Verdict), args.Error(1)
+}
+
+func newAliasRules(conf *aliases.Conf) *aliases.Rules {
+	rules, err := aliases.New(conf)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+func newMockSafetyChecker() *MockSafetyChecker {
+	mockSafetyChecker := new(MockSafetyChecker)
+	mockSafetyChecker.On("Check", "https://malware.example/setup.exe").Return(safety.Verdict{Unsafe: true, Threat: "malware"}, nil)
+	mockSafetyChecker.On("Check", "https://unavailable.example/").Return(safety.Verdict{}, errors.New("unavailable"))
+	mockSafetyChecker.On("Check", mock.Anything).Return(safety.Verdict{}, nil)
+	return mockSafetyChecker
+}
+
 func TestCreateURL(t *testing.T) {
+	activeFrom := time.Date(2026, time.March, 1, 10, 0, 0, 0, time.UTC)
+	activeUntil := activeFrom.Add(-time.Hour)
 	tests := []struct {
 		TestName                 string
 		Username                 string
 		URL                      string
 		Alias                    string
+		RedirectType             int
+		ForwardPath              bool
+		UTM                      RequestUTM
+		Targets                  []RequestTargetRule
+		Variants                 []RequestVariant
+		Schedule                 RequestSchedule
 		StatusCode               int
 		Error                    error
 		ExpectedStatus           string
+		ExpectedAlias            string
+		ExpectedUTM              storage.UTM
 		ExpectedErrorDescription string
 	}{
 		{
@@ -43,6 +103,54 @@ func TestCreateURL(t *testing.T) {
 			StatusCode:               http.StatusCreated,
 			Error:                    nil,
 			ExpectedStatus:           "OK",
+			ExpectedAlias:            "yc",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success existing url of user",
+			Username:                 "Alice",
+			URL:                      "HTTPS://En.Wikipedia.org:443/wiki/Systems_design?utm_source=telegram",
+			Alias:                    "sd",
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "systems_design",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success existing url of user with other redirect type",
+			Username:                 "Alice",
+			URL:                      "https://en.wikipedia.org/wiki/Systems_design",
+			Alias:                    "sd301",
+			RedirectType:             http.StatusMovedPermanently,
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "sd301",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success existing url of user with forwarded path",
+			Username:                 "Alice",
+			URL:                      "https://en.wikipedia.org/wiki/Systems_design",
+			Alias:                    "sdpath",
+			ForwardPath:              true,
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "sdpath",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success existing url of user with activation window",
+			Username:                 "Alice",
+			URL:                      "https://en.wikipedia.org/wiki/Systems_design",
+			Alias:                    "sdwindow",
+			Schedule:                 RequestSchedule{ActiveUntil: &activeFrom},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "sdwindow",
 			ExpectedErrorDescription: "",
 		},
 		{
@@ -53,6 +161,7 @@ func TestCreateURL(t *testing.T) {
 			StatusCode:               http.StatusCreated,
 			Error:                    nil,
 			ExpectedStatus:           "OK",
+			ExpectedAlias:            "sys_dsgn",
 			ExpectedErrorDescription: "",
 		},
 		{
@@ -63,6 +172,7 @@ func TestCreateURL(t *testing.T) {
 			StatusCode:               http.StatusCreated,
 			Error:                    nil,
 			ExpectedStatus:           "OK",
+			ExpectedAlias:            "y-t",
 			ExpectedErrorDescription: "",
 		},
 		{
@@ -93,7 +203,136 @@ func TestCreateURL(t *testing.T) {
 			StatusCode:               http.StatusBadRequest,
 			Error:                    nil,
 			ExpectedStatus:           "Error",
-			ExpectedErrorDescription: "invalid request: tag: mybase64 value: api/",
+			ExpectedErrorDescription: `validate alias: invalid alias: character '/' is not allowed`,
+		},
+		{
+			TestName:                 "Success case-insensitive alias",
+			Username:                 "Bob",
+			URL:                      "https://www.google.com/",
+			Alias:                    "Promo",
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "promo",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success permanent redirect",
+			Username:                 "Bob",
+			URL:                      "https://www.youtube.com/",
+			Alias:                    "yt",
+			RedirectType:             http.StatusPermanentRedirect,
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "yt",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error invalid redirect type",
+			Username:                 "Bob",
+			URL:                      "https://www.youtube.com/",
+			Alias:                    "yt",
+			RedirectType:             http.StatusOK,
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: oneof value: 200",
+		},
+		{
+			TestName:                 "Error alias too long",
+			Username:                 "Bob",
+			URL:                      "https://www.google.com/",
+			Alias:                    "very_long_alias_of_url",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "validate alias: invalid alias: longer than 16 characters",
+		},
+		{
+			TestName:                 "Error reserved alias",
+			Username:                 "Bob",
+			URL:                      "https://www.google.com/",
+			Alias:                    "api",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid alias: alias is reserved",
+		},
+		{
+			TestName:                 "Error javascript scheme",
+			Username:                 "Bob",
+			URL:                      "javascript:alert(1)",
+			Alias:                    "js",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: `invalid destination: url scheme is not allowed: "javascript"`,
+		},
+		{
+			TestName:                 "Error link to own host",
+			Username:                 "Bob",
+			URL:                      "https://sho.rt/yc",
+			Alias:                    "loop",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid destination: destination points to this service: sho.rt",
+		},
+		{
+			TestName:                 "Error blocked host",
+			Username:                 "Bob",
+			URL:                      "https://phishing.example/login",
+			Alias:                    "login",
+			StatusCode:               http.StatusForbidden,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "check url: destination host is blocked",
+		},
+		{
+			TestName:                 "Error unsafe url",
+			Username:                 "Bob",
+			URL:                      "https://malware.example/setup.exe",
+			Alias:                    "setup",
+			StatusCode:               http.StatusForbidden,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "check url safety: unsafe url: malware",
+		},
+		{
+			TestName:                 "Success safety checker unavailable",
+			Username:                 "Bob",
+			URL:                      "https://unavailable.example/",
+			Alias:                    "unavailable",
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "unavailable",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Success utm with defaults of user",
+			Username:                 "Carol",
+			URL:                      "https://example.com/spring",
+			Alias:                    "spring",
+			UTM:                      RequestUTM{Medium: "social", Campaign: "spring_sale"},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "spring",
+			ExpectedUTM:              storage.UTM{Source: "newsletter", Medium: "social", Campaign: "spring_sale"},
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error utm parameter too long",
+			Username:                 "Carol",
+			URL:                      "https://example.com/autumn",
+			Alias:                    "autumn",
+			UTM:                      RequestUTM{Campaign: strings.Repeat("a", 101)},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: max value: " + strings.Repeat("a", 101),
 		},
 		{
 			TestName:                 "Error internal",
@@ -105,16 +344,129 @@ func TestCreateURL(t *testing.T) {
 			ExpectedStatus:           "Error",
 			ExpectedErrorDescription: "saving url to storage: internal",
 		},
+		{
+			TestName:                 "Success device targets",
+			Username:                 "Bob",
+			URL:                      "https://example.com/app",
+			Alias:                    "app",
+			Targets:                  []RequestTargetRule{{OS: "ios", URL: "https://apps.apple.com/app/id1"}, {Device: "mobile", URL: "https://m.example.com/app"}, {Country: "DE", URL: "https://example.de/app"}},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "app",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error invalid target country",
+			Username:                 "Bob",
+			URL:                      "https://example.com/shop",
+			Alias:                    "shop",
+			Targets:                  []RequestTargetRule{{Country: "UK", URL: "https://example.co.uk/shop"}},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: iso3166_1_alpha2 value: UK",
+		},
+		{
+			TestName:                 "Success variants",
+			Username:                 "Bob",
+			URL:                      "https://example.com/landing",
+			Alias:                    "landing",
+			Variants:                 []RequestVariant{{URL: "https://example.com/landing-a", Weight: 70}, {URL: "https://example.com/landing-b", Weight: 30}},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "landing",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error single variant",
+			Username:                 "Bob",
+			URL:                      "https://example.com/landing",
+			Alias:                    "landing2",
+			Variants:                 []RequestVariant{{URL: "https://example.com/landing-a", Weight: 1}},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: min value: [{https://example.com/landing-a 1}]",
+		},
+		{
+			TestName:                 "Error duplicate variant",
+			Username:                 "Bob",
+			URL:                      "https://example.com/landing",
+			Alias:                    "landing3",
+			Variants:                 []RequestVariant{{URL: "https://Example.com/landing-a", Weight: 1}, {URL: "https://example.com:443/landing-a", Weight: 2}},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "duplicate variant url: https://example.com/landing-a",
+		},
+		{
+			TestName:                 "Success schedule",
+			Username:                 "Bob",
+			URL:                      "https://example.com/register",
+			Alias:                    "event",
+			Schedule:                 RequestSchedule{ActiveFrom: &activeFrom, Schedule: []RequestScheduledChange{{At: activeFrom.Add(time.Hour), URL: "https://example.com/recording"}}},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedAlias:            "event",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error active until before active from",
+			Username:                 "Bob",
+			URL:                      "https://example.com/register",
+			Alias:                    "event2",
+			Schedule:                 RequestSchedule{ActiveFrom: &activeFrom, ActiveUntil: &activeUntil},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid schedule: active_until is not after active_from",
+		},
+		{
+			TestName:                 "Error two changes at once",
+			Username:                 "Bob",
+			URL:                      "https://example.com/register",
+			Alias:                    "event3",
+			Schedule:                 RequestSchedule{Schedule: []RequestScheduledChange{{At: activeFrom, URL: "https://example.com/a"}, {At: activeFrom, URL: "https://example.com/b"}}},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid schedule: two changes at 2026-03-01T10:00:00Z",
+		},
+		{
+			TestName:                 "Error empty target rule",
+			Username:                 "Bob",
+			URL:                      "https://example.com/app",
+			Alias:                    "app2",
+			Targets:                  []RequestTargetRule{{URL: "https://m.example.com/app"}},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "target rule matches neither os, device nor country: https://m.example.com/app",
+		},
 	}
 
 	mockCreator := new(MockURLCreator)
-	handler := ErrorHandler("Save url", NewSaveURL(mockCreator))
+	// Alice has a plain link to the url with the default redirect type.
+	mockCreator.On("GetAliasByURL", "Alice", mock.MatchedBy(func(target *storage.Target) bool {
+		return target.URL == "https://en.wikipedia.org/wiki/Systems_design" && target.RedirectType == 0 &&
+			!target.ForwardQuery && !target.ForwardPath
+	})).Return("systems_design", nil)
+	mockCreator.On("GetAliasByURL", mock.Anything, mock.Anything).Return("", storage.ErrURLNotFound)
+	mockCreator.On("GetUTMDefaults", "Carol").Return(&storage.UTM{Source: "newsletter", Medium: "email"}, nil)
+	mockCreator.On("GetUTMDefaults", mock.Anything).Return(&storage.UTM{}, nil)
+	mockChecker := new(MockURLChecker)
+	mockChecker.On("CheckURL", "https://phishing.example/login").Return(hostpolicy.ErrBlocked)
+	mockChecker.On("CheckURL", mock.Anything).Return(nil)
+	handler := ErrorHandler("Save url", NewSaveURL(mockCreator, newAliasRules(&aliases.Conf{MaxLength: 16, CaseInsensitive: true}), newMockReservedChecker(), destination.New(&destination.Conf{OwnHosts: []string{"sho.rt"}, StripTracking: true, Dedup: true}), mockChecker, newMockSafetyChecker(), newMockMetadataCollector(), newMockEventPublisher()))
 	for _, test := range tests {
 		t.Run(test.TestName, func(t *testing.T) {
 			t.Parallel()
 
 			res := httptest.NewRecorder()
-			dataRequest, err := json.Marshal(RequestSaveURL{URL: test.URL, Alias: test.Alias})
+			dataRequest, err := json.Marshal(RequestSaveURL{URL: test.URL, Alias: test.Alias, RedirectType: test.RedirectType, ForwardPath: test.ForwardPath, RequestUTM: test.UTM, Targets: test.Targets, Variants: test.Variants, RequestSchedule: test.Schedule})
 			if err != nil {
 				t.Fatalf("cant marshal json: %v", err)
 			}
@@ -124,19 +476,25 @@ func TestCreateURL(t *testing.T) {
 				t.Fatalf("cant create new request: %v", err)
 			}
 
-			mockCreator.On("CreateURL", test.Username, test.URL, test.Alias).Return(test.Error)
+			mockCreator.On("CreateURL", test.Username, test.URL, strings.ToLower(test.Alias)).Return(test.Error)
 
 			handler.ServeHTTP(res, req)
 
 			if res.Code != test.StatusCode {
 				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
 			}
-			if test.StatusCode == http.StatusCreated {
-				var response httpresponse.RequestOK
+			if test.StatusCode == http.StatusCreated || test.StatusCode == http.StatusOK {
+				var response ResponseSaveURL
 				json.Unmarshal(res.Body.Bytes(), &response)
 				if response.Status != test.ExpectedStatus {
 					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
 				}
+				if response.Alias != test.ExpectedAlias {
+					t.Errorf(`expected alias "%s" but received "%s"`, test.ExpectedAlias, response.Alias)
+				}
+				if response.UTM != test.ExpectedUTM {
+					t.Errorf("expected utm %+v but received %+v", test.ExpectedUTM, response.UTM)
+				}
 			} else {
 				var response httpresponse.RequestError
 				json.Unmarshal(res.Body.Bytes(), &response)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/mrvin/url-shortener/internal/logger"
 	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/webhook"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 )
 
@@ -20,9 +21,9 @@ type CacheURLDeleter interface {
 	DeleteURL(ctx context.Context, alias string) error
 }
 
-func NewDeleteURL(st DBURLDeleter, cache CacheURLDeleter) HandlerFunc {
+func NewDeleteURL(st DBURLDeleter, cache CacheURLDeleter, rules AliasNormalizer, publisher EventPublisher) HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
-		alias := req.PathValue("alias")
+		alias := rules.Normalize(req.PathValue("alias"))
 		ctx := logger.WithAlias(req.Context(), alias)
 		msg := "Delete url"
 
@@ -42,6 +43,7 @@ func NewDeleteURL(st DBURLDeleter, cache CacheURLDeleter) HandlerFunc {
 			err = fmt.Errorf("deleting url from cache: %w", err)
 			slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
 		}
+		publish(ctx, publisher, webhook.EventDeleted, &webhook.Link{Username: username, Alias: alias})
 
 		httpresponse.WriteOK(res, http.StatusOK)
 
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
 	log "github.com/mrvin/url-shortener/internal/logger"
 	"github.com/mrvin/url-shortener/internal/storage"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
@@ -74,7 +75,7 @@ func TestDeleteURL(t *testing.T) {
 	mockDBURLDeleter := new(MockDBURLDeleter)
 	mockCacheURLDeleter := new(MockCacheURLDeleter)
 	mux := http.NewServeMux()
-	mux.HandleFunc(http.MethodDelete+" /api/urls/{alias...}", ErrorHandler("Delete url", NewDeleteURL(mockDBURLDeleter, mockCacheURLDeleter)))
+	mux.HandleFunc(http.MethodDelete+" /api/urls/{alias...}", ErrorHandler("Delete url", NewDeleteURL(mockDBURLDeleter, mockCacheURLDeleter, newAliasRules(&aliases.Conf{}), newMockEventPublisher())))
 	for _, test := range tests {
 		t.Run(test.TestName, func(t *testing.T) {
 			t.Parallel()
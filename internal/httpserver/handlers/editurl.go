@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/webhook"
+)
+
+type URLUpdater interface {
+	UpdateURL(ctx context.Context, username, alias string, target *storage.Target) error
+	UTMDefaultsGetter
+}
+
+//nolint:tagliatelle
+type RequestEditURL struct {
+	URL          string `json:"url"                     validate:"required,url"`
+	RedirectType int    `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 303 307 308"`
+	ForwardQuery bool   `json:"forward_query,omitempty"`
+	ForwardPath  bool   `json:"forward_path,omitempty"`
+	RequestUTM
+	Title    string              `json:"title,omitempty"    validate:"max=200"`
+	Targets  []RequestTargetRule `json:"targets,omitempty"  validate:"max=20,dive"`
+	Variants []RequestVariant    `json:"variants,omitempty" validate:"omitempty,min=2,max=10,dive"`
+	Sticky   bool                `json:"sticky,omitempty"`
+	RequestSchedule
+}
+
+type ResponseEditURL struct {
+	storage.UTM
+	Status string `json:"status"`
+}
+
+func NewEditURL(updater URLUpdater, cache CacheURLDeleter, rules AliasNormalizer, destinations DestinationValidator, checker URLChecker, safetyChecker SafetyChecker, collector MetadataCollector, publisher EventPublisher) HandlerFunc {
+	validate := validator.New()
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		alias := rules.Normalize(req.PathValue("alias"))
+		ctx := logger.WithAlias(req.Context(), alias)
+		msg := "Edit url"
+
+		// Read json request
+		var request RequestEditURL
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+		ctx = logger.WithURL(ctx, request.URL)
+
+		// Validation
+		if err := validate.Struct(request); err != nil {
+			var vErrors validator.ValidationErrors
+			if errors.As(err, &vErrors) {
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s value: %v", vErrors[0].Tag(), vErrors[0].Value())
+			}
+			return ctx, http.StatusInternalServerError, fmt.Errorf("validation: %w", err)
+		}
+
+		request.URL, err = destinations.Normalize(request.URL)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("normalize url: %w", err)
+		}
+		ctx = logger.WithURL(ctx, request.URL)
+
+		if err := destinations.Check(ctx, request.URL, req.Host); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("invalid destination: %w", err)
+		}
+		if err := checker.CheckURL(request.URL); err != nil {
+			return ctx, checkURLStatus(err), fmt.Errorf("check url: %w", err)
+		}
+		if err := checkSafety(ctx, safetyChecker, request.URL); err != nil {
+			return ctx, http.StatusForbidden, fmt.Errorf("check url safety: %w", err)
+		}
+		targets, status, err := checkTargets(ctx, request.Targets, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
+		variants, status, err := checkVariants(ctx, request.Variants, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
+		schedule, status, err := checkSchedule(ctx, &request.RequestSchedule, req.Host, destinations, checker, safetyChecker)
+		if err != nil {
+			return ctx, status, err
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		defaults, err := updater.GetUTMDefaults(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting utm defaults from storage: %w", err)
+		}
+
+		target := storage.Target{
+			URL:          request.URL,
+			RedirectType: request.RedirectType,
+			ForwardQuery: request.ForwardQuery,
+			ForwardPath:  request.ForwardPath,
+			UTM:          withUTMDefaults(request.RequestUTM, defaults),
+			Title:        request.Title,
+			Targets:      targets,
+			Variants:     variants,
+			Sticky:       request.Sticky,
+			Schedule:     schedule,
+		}
+		if err := updater.UpdateURL(ctx, username, alias, &target); err != nil {
+			err = fmt.Errorf("updating url in storage: %w", err)
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+		if err := cache.DeleteURL(ctx, alias); err != nil {
+			err = fmt.Errorf("deleting url from cache: %w", err)
+			slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
+		}
+		collector.Enqueue(alias, target.URL)
+		publish(ctx, publisher, webhook.EventUpdated, &webhook.Link{
+			Username:    username,
+			Alias:       alias,
+			URL:         target.URL,
+			ActiveUntil: target.ActiveUntil,
+		})
+
+		// Write json response
+		response := ResponseEditURL{
+			UTM:    target.UTM,
+			Status: "OK",
+		}
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
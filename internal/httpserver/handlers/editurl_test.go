@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockURLUpdater struct {
+	mock.Mock
+}
+
+func (m *MockURLUpdater) UpdateURL(_ context.Context, username, alias string, target *storage.Target) error {
+	args := m.Called(username, alias, target.URL)
+	return args.Error(0)
+}
+
+func (m *MockURLUpdater) GetUTMDefaults(_ context.Context, username string) (*storage.UTM, error) {
+	args := m.Called(username)
+	return args.Get(0).(*storage.UTM), args.Error(1)
+}
+
+func TestEditURL(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		Alias                    string
+		URL                      string
+		StatusCode               int
+		Error                    error
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:                 "Success smoke test",
+			Username:                 "Bob",
+			Alias:                    "zn9edcu",
+			URL:                      "https://en.wikipedia.org/wiki/Systems_design",
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error invalid url",
+			Username:                 "Bob",
+			Alias:                    "g",
+			URL:                      "//www.google.com/",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: url value: //www.google.com/",
+		},
+		{
+			TestName:                 "Error link to own host",
+			Username:                 "Bob",
+			Alias:                    "loop",
+			URL:                      "https://sho.rt/yc",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid destination: destination points to this service: sho.rt",
+		},
+		{
+			TestName:                 "Error blocked host",
+			Username:                 "Bob",
+			Alias:                    "login",
+			URL:                      "https://phishing.example/login",
+			StatusCode:               http.StatusForbidden,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "check url: destination host is blocked",
+		},
+		{
+			TestName:                 "Error unsafe url",
+			Username:                 "Bob",
+			Alias:                    "setup",
+			URL:                      "https://malware.example/setup.exe",
+			StatusCode:               http.StatusForbidden,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "check url safety: unsafe url: malware",
+		},
+		{
+			TestName:                 "Error alias not found",
+			Username:                 "Alice",
+			Alias:                    "systems_design",
+			URL:                      "https://www.youtube.com/",
+			StatusCode:               http.StatusNotFound,
+			Error:                    storage.ErrAliasNotFound,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "updating url in storage: alias not found",
+		},
+		{
+			TestName:                 "Error internal",
+			Username:                 "Alice",
+			Alias:                    "yc",
+			URL:                      "https://yandex.cloud/ru",
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "updating url in storage: internal",
+		},
+	}
+
+	mockUpdater := new(MockURLUpdater)
+	mockUpdater.On("GetUTMDefaults", mock.Anything).Return(&storage.UTM{}, nil)
+	mockCacheURLDeleter := new(MockCacheURLDeleter)
+	mockChecker := new(MockURLChecker)
+	mockChecker.On("CheckURL", "https://phishing.example/login").Return(hostpolicy.ErrBlocked)
+	mockChecker.On("CheckURL", mock.Anything).Return(nil)
+	mockCollector := newMockMetadataCollector()
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodPut+" /api/urls/{alias...}", ErrorHandler("Edit url", NewEditURL(mockUpdater, mockCacheURLDeleter, newAliasRules(&aliases.Conf{}), destination.New(&destination.Conf{OwnHosts: []string{"sho.rt"}}), mockChecker, newMockSafetyChecker(), mockCollector, newMockEventPublisher())))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			dataRequest, err := json.Marshal(RequestEditURL{URL: test.URL})
+			if err != nil {
+				t.Fatalf("cant marshal json: %v", err)
+			}
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/api/urls/"+test.Alias, bytes.NewReader(dataRequest))
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockUpdater.On("UpdateURL", test.Username, test.Alias, test.URL).Return(test.Error)
+			mockCacheURLDeleter.On("DeleteURL", test.Alias).Return(nil)
+
+			mux.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if test.StatusCode == http.StatusOK {
+				var response httpresponse.RequestOK
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				mockCollector.AssertCalled(t, "Enqueue", test.Alias, test.URL)
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type URLFlagger interface {
+	Flag(ctx context.Context, alias, threat string) error
+}
+
+type RequestFlagURL struct {
+	Alias string `json:"alias"`
+	// Empty threat enables the url again.
+	Threat string `json:"threat"`
+}
+
+func NewFlagURL(flagger URLFlagger) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestFlagURL
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		// Validation
+		if request.Alias == "" {
+			return ctx, http.StatusBadRequest, errors.New("invalid request: alias required")
+		}
+
+		if err := flagger.Flag(ctx, request.Alias, request.Threat); err != nil {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
@@ -17,7 +17,7 @@ const (
 )
 
 type URLsGetter interface {
-	GetURLs(ctx context.Context, username string, limit, offset uint64) ([]storage.URL, uint64, error)
+	GetURLs(ctx context.Context, username string, filter *storage.URLFilter, limit, offset uint64) ([]storage.URL, uint64, error)
 }
 
 type ResponseGetURLs struct {
@@ -48,12 +48,20 @@ func NewGetURLs(getter URLsGetter) HandlerFunc {
 			}
 		}
 
+		filter := storage.URLFilter{UTM: *utmFilter(req.URL.Query())}
+		if brokenStr := req.URL.Query().Get("broken"); brokenStr != "" {
+			filter.Broken, err = strconv.ParseBool(brokenStr)
+			if err != nil {
+				return ctx, http.StatusBadRequest, fmt.Errorf("incorrect broken value: %w", err)
+			}
+		}
+
 		username, err := logger.GetUsernameFromCtx(ctx)
 		if err != nil {
 			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
 		}
 
-		urls, total, err := getter.GetURLs(ctx, username, limit, offset)
+		urls, total, err := getter.GetURLs(ctx, username, &filter, limit, offset)
 		if err != nil {
 			return ctx, http.StatusInternalServerError, fmt.Errorf("getting urls from storage: %w", err)
 		}
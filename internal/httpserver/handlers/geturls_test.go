@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"slices"
+	"reflect"
 	"testing"
 	"time"
 
@@ -21,8 +21,8 @@ type MockURLsGetter struct {
 	mock.Mock
 }
 
-func (m *MockURLsGetter) GetURLs(_ context.Context, username string, limit, offset uint64) ([]storage.URL, uint64, error) {
-	args := m.Called(username, limit, offset)
+func (m *MockURLsGetter) GetURLs(_ context.Context, username string, filter *storage.URLFilter, limit, offset uint64) ([]storage.URL, uint64, error) {
+	args := m.Called(username, *filter, limit, offset)
 	return args.Get(0).([]storage.URL), args.Get(1).(uint64), args.Error(2)
 }
 
@@ -32,6 +32,8 @@ func TestGetURLs(t *testing.T) {
 		Username                 string
 		Limit                    uint64
 		Offset                   uint64
+		Filter                   string
+		ExpectedFilter           storage.URLFilter
 		StatusCode               int
 		URLs                     []storage.URL
 		Total                    uint64
@@ -58,6 +60,65 @@ func TestGetURLs(t *testing.T) {
 			ExpectedStatus:           "OK",
 			ExpectedErrorDescription: "",
 		},
+		{
+			TestName:       "Success filter by campaign",
+			Username:       "Carol",
+			Limit:          10,
+			Offset:         0,
+			Filter:         "&utm_source=newsletter&utm_campaign=spring%20sale",
+			ExpectedFilter: storage.URLFilter{UTM: storage.UTM{Source: "newsletter", Campaign: "spring sale"}},
+			StatusCode:     http.StatusOK,
+			URLs: []storage.URL{
+				{
+					URL:       "https://example.com/spring",
+					Alias:     "spring",
+					Count:     12,
+					CreatedAt: time.Date(2025, time.November, 29, 10, 0, 0, 0, time.UTC),
+					UTM:       storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring sale"},
+				},
+			},
+			Total:                    1,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:       "Success filter by broken destination",
+			Username:       "Dave",
+			Limit:          10,
+			Offset:         0,
+			Filter:         "&broken=true",
+			ExpectedFilter: storage.URLFilter{Broken: true},
+			StatusCode:     http.StatusOK,
+			URLs: []storage.URL{
+				{
+					URL:       "https://example.com/gone",
+					Alias:     "gone",
+					Count:     3,
+					CreatedAt: time.Date(2025, time.November, 29, 10, 0, 0, 0, time.UTC),
+					Health: &storage.Health{
+						Status:    http.StatusNotFound,
+						LatencyMS: 120,
+						CheckedAt: time.Date(2025, time.December, 1, 10, 0, 0, 0, time.UTC),
+						Broken:    true,
+					},
+				},
+			},
+			Total:                    1,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error broken value",
+			Username:                 "Erin",
+			Limit:                    10,
+			Offset:                   0,
+			Filter:                   "&broken=maybe",
+			StatusCode:               http.StatusBadRequest,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: `incorrect broken value: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
 		{
 			TestName:                 "Error internal",
 			Username:                 "Alice",
@@ -80,13 +141,13 @@ func TestGetURLs(t *testing.T) {
 
 			res := httptest.NewRecorder()
 			ctx := log.WithUsername(context.Background(), test.Username)
-			url := fmt.Sprintf("/api/urls?limit=%d&offset=%d", test.Limit, test.Offset)
+			url := fmt.Sprintf("/api/urls?limit=%d&offset=%d", test.Limit, test.Offset) + test.Filter
 			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 			if err != nil {
 				t.Fatalf("cant create new request: %v", err)
 			}
 
-			mockURLsGetter.On("GetURLs", test.Username, test.Limit, test.Offset).Return(test.URLs, test.Total, test.Error)
+			mockURLsGetter.On("GetURLs", test.Username, test.ExpectedFilter, test.Limit, test.Offset).Return(test.URLs, test.Total, test.Error)
 
 			handler.ServeHTTP(res, req)
 
@@ -96,7 +157,7 @@ func TestGetURLs(t *testing.T) {
 			if res.Code == http.StatusOK {
 				var response ResponseGetURLs
 				json.Unmarshal(res.Body.Bytes(), &response)
-				if !slices.Equal(response.URLs, test.URLs) {
+				if !reflect.DeepEqual(response.URLs, test.URLs) {
 					t.Errorf("expected urls %v but received %v", test.URLs, response.URLs)
 				}
 				if response.Total != test.Total {
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/mrvin/url-shortener/pkg/errcode"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 )
 
@@ -15,7 +16,7 @@ func ErrorHandler(msg string, handler HandlerFunc) http.HandlerFunc {
 		ctx, code, err := handler(res, req)
 		if err != nil {
 			slog.ErrorContext(ctx, msg, slog.String("error", err.Error())) //nolint:contextcheck
-			httpresponse.WriteError(res, err.Error(), code)
+			httpresponse.WriteErrorCode(res, err.Error(), errcode.Of(err), code)
 			return
 		}
 		slog.DebugContext(ctx, msg) //nolint:contextcheck
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type HostRulesGetter interface {
+	Rules(ctx context.Context) ([]storage.HostRule, error)
+}
+
+type HostRuleAdder interface {
+	AddRule(ctx context.Context, rule *storage.HostRule) (int64, error)
+}
+
+type HostRuleDeleter interface {
+	DeleteRule(ctx context.Context, id int64) error
+}
+
+type RequestCreateHostRule struct {
+	List    string `json:"list"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+}
+
+type ResponseCreateHostRule struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+type ResponseGetHostRules struct {
+	Rules  []storage.HostRule `json:"rules"`
+	Status string             `json:"status"`
+}
+
+func NewGetHostRules(getter HostRulesGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		rules, err := getter.Rules(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting host rules: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetHostRules{
+			Rules:  rules,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+func NewCreateHostRule(adder HostRuleAdder) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestCreateHostRule
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		rule := storage.HostRule{
+			List:      request.List,
+			Type:      request.Type,
+			Pattern:   request.Pattern,
+			CreatedBy: username,
+		}
+		id, err := adder.AddRule(ctx, &rule)
+		if err != nil {
+			err = fmt.Errorf("adding host rule: %w", err)
+			switch {
+			case errors.Is(err, hostpolicy.ErrInvalidRule):
+				return ctx, http.StatusBadRequest, err
+			case errors.Is(err, storage.ErrHostRuleExists):
+				return ctx, http.StatusConflict, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		// Write json response
+		response := ResponseCreateHostRule{
+			ID:     id,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.WriteHeader(http.StatusCreated)
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusCreated, nil
+	}
+}
+
+func NewDeleteHostRule(deleter HostRuleDeleter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect id value: %w", err)
+		}
+
+		if err := deleter.DeleteRule(ctx, id); err != nil {
+			err = fmt.Errorf("deleting host rule: %w", err)
+			if errors.Is(err, storage.ErrHostRuleNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
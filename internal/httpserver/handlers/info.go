@@ -20,14 +20,19 @@ type ResponseInfo struct {
 	Date string `json:"date"`
 }
 
-func Info(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
-	ctx := req.Context()
-
-	response := ResponseInfo{
+// BuildInfo returns the version of the build set by the linker.
+func BuildInfo() ResponseInfo {
+	return ResponseInfo{
 		Tag:  tag,
 		Hash: hash,
 		Date: date,
 	}
+}
+
+func Info(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+	ctx := req.Context()
+
+	response := BuildInfo()
 	jsonResponse, err := json.Marshal(&response)
 	if err != nil {
 		return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
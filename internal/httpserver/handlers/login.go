@@ -3,26 +3,57 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/mrvin/url-shortener/internal/lockout"
 	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/session"
 	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// dummyHash is a bcrypt hash of the default cost matching no password.
+const dummyHash = "$2a$10$3hwD4ZO6gpk34AbILn9XR.thAIEqIsuhWuCfR7wcamoQ8aHuOcMXe"
+
 type UserGetter interface {
 	GetUser(ctx context.Context, name string) (*storage.User, error)
 }
 
+type SessionIssuer interface {
+	Issue(ctx context.Context, username, role string) (*session.Session, error)
+	SetCookies(res http.ResponseWriter, s *session.Session)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, keys ...string) (time.Duration, error)
+	Fail(ctx context.Context, keys ...string) (time.Duration, error)
+	Success(ctx context.Context, keys ...string) error
+}
+
 type RequestLogin struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
-func NewLogin(getter UserGetter) HandlerFunc {
+//nolint:tagliatelle
+type ResponseSession struct {
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Status    string    `json:"status"`
+}
+
+func NewLogin(getter UserGetter, issuer SessionIssuer, guard LoginGuard) HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
 		ctx := req.Context()
 
@@ -38,18 +69,83 @@ func NewLogin(getter UserGetter) HandlerFunc {
 		}
 		ctx = logger.WithUsername(ctx, request.Username)
 
+		keys := []string{lockout.UserKey(request.Username), lockout.IPKey(realip.Host(req))}
+		retryAfter, err := guard.Check(ctx, keys...)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("check lockout: %w", err)
+		}
+		if retryAfter > 0 {
+			httpresponse.SetRetryAfter(res, retryAfter)
+			return ctx, http.StatusTooManyRequests, ErrTooManyAttempts
+		}
+
 		user, err := getter.GetUser(ctx, request.Username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			CompareDummyPassword(request.Password)
+			return loginFailed(ctx, res, guard, keys, fmt.Errorf("getting user from storage: %w", err))
+		}
 		if err != nil {
 			return ctx, http.StatusInternalServerError, fmt.Errorf("getting user from storage: %w", err)
 		}
 
 		if err := bcrypt.CompareHashAndPassword([]byte(user.HashPassword), []byte(request.Password)); err != nil {
-			return ctx, http.StatusUnauthorized, fmt.Errorf("compare hash and password: %w", err)
+			return loginFailed(ctx, res, guard, keys, fmt.Errorf("compare hash and password: %w", err))
+		}
+		if err := guard.Success(ctx, keys[0]); err != nil {
+			slog.WarnContext(ctx, "Login user", slog.String("warn", err.Error()))
+		}
+
+		sess, err := issuer.Issue(ctx, user.Name, user.Role)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("issue session: %w", err)
 		}
 
-		// Write json response
-		httpresponse.WriteOK(res, http.StatusOK)
+		return writeSession(ctx, res, issuer, sess)
+	}
+}
+
+// CompareDummyPassword takes as long as checking the password of a user, so
+// that the time of the response to an unknown username does not tell that
+// the user does not exist.
+func CompareDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+}
 
-		return ctx, http.StatusOK, nil
+// loginFailed counts the failed attempt and answers 401 Unauthorized.
+func loginFailed(ctx context.Context, res http.ResponseWriter, guard LoginGuard, keys []string, err error) (context.Context, int, error) {
+	lockedFor, errFail := guard.Fail(ctx, keys...)
+	if errFail != nil {
+		slog.WarnContext(ctx, "Login user", slog.String("warn", errFail.Error()))
 	}
+	if lockedFor > 0 {
+		httpresponse.SetRetryAfter(res, lockedFor)
+	}
+
+	return ctx, http.StatusUnauthorized, err
+}
+
+// writeSession sets the session cookies and writes the session token
+// for API clients that use the Authorization: Bearer header.
+func writeSession(ctx context.Context, res http.ResponseWriter, issuer SessionIssuer, sess *session.Session) (context.Context, int, error) {
+	issuer.SetCookies(res, sess)
+
+	// Write json response
+	response := ResponseSession{
+		Username:  sess.Claims.Username,
+		Token:     sess.Token,
+		CSRFToken: sess.Claims.CSRF,
+		ExpiresAt: time.Unix(sess.Claims.ExpiresAt, 0).UTC(),
+		Status:    "OK",
+	}
+	jsonResponse, err := json.Marshal(&response)
+	if err != nil {
+		return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+	}
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	if _, err := res.Write(jsonResponse); err != nil {
+		return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+	}
+
+	return ctx, http.StatusOK, nil
 }
@@ -8,10 +8,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/mrvin/url-shortener/internal/session"
 	"github.com/mrvin/url-shortener/internal/storage"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type MockUserGetter struct {
@@ -23,6 +26,38 @@ func (m *MockUserGetter) GetUser(_ context.Context, name string) (*storage.User,
 	return args.Get(0).(*storage.User), args.Error(1)
 }
 
+type MockSessionIssuer struct {
+	mock.Mock
+}
+
+func (m *MockSessionIssuer) Issue(_ context.Context, username, role string) (*session.Session, error) {
+	args := m.Called(username, role)
+	return args.Get(0).(*session.Session), args.Error(1)
+}
+
+func (m *MockSessionIssuer) SetCookies(res http.ResponseWriter, s *session.Session) {
+	http.SetCookie(res, &http.Cookie{Name: session.CookieName, Value: s.Token})
+}
+
+type MockLoginGuard struct {
+	mock.Mock
+}
+
+func (m *MockLoginGuard) Check(_ context.Context, keys ...string) (time.Duration, error) {
+	args := m.Called(keys[0])
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockLoginGuard) Fail(_ context.Context, keys ...string) (time.Duration, error) {
+	args := m.Called(keys[0])
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockLoginGuard) Success(_ context.Context, keys ...string) error {
+	args := m.Called(keys[0])
+	return args.Error(0)
+}
+
 func TestLogin(t *testing.T) {
 	tests := []struct {
 		TestName                 string
@@ -31,6 +66,7 @@ func TestLogin(t *testing.T) {
 		StatusCode               int
 		Error                    error
 		User                     *storage.User
+		LockedFor                time.Duration
 		ExpectedStatus           string
 		ExpectedErrorDescription string
 	}{
@@ -72,10 +108,33 @@ func TestLogin(t *testing.T) {
 			ExpectedStatus:           "Error",
 			ExpectedErrorDescription: "getting user from storage: internal",
 		},
+		{
+			TestName:                 "User not found",
+			Username:                 "Eve",
+			Password:                 "qwerty",
+			StatusCode:               http.StatusUnauthorized,
+			Error:                    storage.ErrUserNotFound,
+			User:                     nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "getting user from storage: user not found",
+		},
+		{
+			TestName:                 "User is locked out",
+			Username:                 "Mallory",
+			Password:                 "qwerty",
+			StatusCode:               http.StatusTooManyRequests,
+			Error:                    nil,
+			User:                     nil,
+			LockedFor:                90 * time.Second,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "too many failed login attempts",
+		},
 	}
 
 	mockGetter := new(MockUserGetter)
-	handler := ErrorHandler("Login user", NewLogin(mockGetter))
+	mockIssuer := new(MockSessionIssuer)
+	mockGuard := new(MockLoginGuard)
+	handler := ErrorHandler("Login user", NewLogin(mockGetter, mockIssuer, mockGuard))
 	for _, test := range tests {
 		t.Run(test.TestName, func(t *testing.T) {
 			t.Parallel()
@@ -91,18 +150,33 @@ func TestLogin(t *testing.T) {
 			}
 
 			mockGetter.On("GetUser", test.Username).Return(test.User, test.Error)
+			userKey := "user:" + test.Username
+			mockGuard.On("Check", userKey).Return(test.LockedFor, nil)
+			mockGuard.On("Fail", userKey).Return(time.Duration(0), nil)
+			mockGuard.On("Success", userKey).Return(nil)
+			token := "token-" + test.Username
+			mockIssuer.On("Issue", test.Username, "user").Return(&session.Session{Token: token, Claims: session.Claims{CSRF: "csrf"}}, nil)
 
 			handler.ServeHTTP(res, req)
 
 			if res.Code != test.StatusCode {
 				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
 			}
-			if test.StatusCode == http.StatusCreated {
-				var response httpresponse.RequestOK
+			if test.LockedFor > 0 && res.Header().Get("Retry-After") != "90" {
+				t.Errorf(`expected Retry-After "90" but received "%s"`, res.Header().Get("Retry-After"))
+			}
+			if test.StatusCode == http.StatusOK {
+				var response ResponseSession
 				json.Unmarshal(res.Body.Bytes(), &response)
 				if response.Status != test.ExpectedStatus {
 					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
 				}
+				if response.Token != token {
+					t.Errorf(`expected token "%s" but received "%s"`, token, response.Token)
+				}
+				if cookies := res.Result().Cookies(); len(cookies) == 0 || cookies[0].Value != token {
+					t.Errorf("expected session cookie with token %q", token)
+				}
 			} else {
 				var response httpresponse.RequestError
 				json.Unmarshal(res.Body.Bytes(), &response)
@@ -116,3 +190,15 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestDummyHash(t *testing.T) {
+	// A malformed hash or a lower cost would be rejected faster than the
+	// password of a real user.
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	if err != nil {
+		t.Fatalf("cost: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("expected cost %d but received %d", bcrypt.DefaultCost, cost)
+	}
+}
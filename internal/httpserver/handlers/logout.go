@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/session"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type SessionRevoker interface {
+	Revoke(ctx context.Context, claims *session.Claims) error
+	ClearCookies(res http.ResponseWriter)
+}
+
+func NewLogout(revoker SessionRevoker) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// A client authenticated with Basic auth has no session to revoke.
+		claims, err := session.GetClaimsFromCtx(ctx)
+		if err != nil && !errors.Is(err, session.ErrNoSession) {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get session from ctx: %w", err)
+		}
+		if claims != nil {
+			if err := revoker.Revoke(ctx, claims); err != nil {
+				return ctx, http.StatusInternalServerError, fmt.Errorf("revoke session: %w", err)
+			}
+		}
+		revoker.ClearCookies(res)
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSessionRevoker struct {
+	mock.Mock
+}
+
+func (m *MockSessionRevoker) Revoke(_ context.Context, claims *session.Claims) error {
+	args := m.Called(claims.ID)
+	return args.Error(0)
+}
+
+func (m *MockSessionRevoker) ClearCookies(res http.ResponseWriter) {
+	http.SetCookie(res, &http.Cookie{Name: session.CookieName, MaxAge: -1})
+}
+
+func TestLogout(t *testing.T) {
+	mockRevoker := new(MockSessionRevoker)
+	handler := ErrorHandler("Logout user", NewLogout(mockRevoker))
+
+	t.Run("Success with session", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		ctx := session.WithClaims(context.Background(), &session.Claims{ID: "id"})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/users/logout", nil)
+		if err != nil {
+			t.Fatalf("cant create new request: %v", err)
+		}
+
+		mockRevoker.On("Revoke", "id").Return(nil).Once()
+
+		handler.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Errorf("expected status code %d but received %d", http.StatusOK, res.Code)
+		}
+		mockRevoker.AssertExpectations(t)
+		if cookies := res.Result().Cookies(); len(cookies) == 0 || cookies[0].MaxAge >= 0 {
+			t.Error("expected session cookie to be cleared")
+		}
+	})
+
+	t.Run("Success without session", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/users/logout", nil)
+		if err != nil {
+			t.Fatalf("cant create new request: %v", err)
+		}
+
+		handler.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Errorf("expected status code %d but received %d", http.StatusOK, res.Code)
+		}
+	})
+}
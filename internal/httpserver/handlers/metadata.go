@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/metadata"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type UserURLGetter interface {
+	GetUserURL(ctx context.Context, username, alias string) (string, error)
+}
+
+type MetadataRefresher interface {
+	Refresh(ctx context.Context, alias, rawURL string) (*storage.Metadata, error)
+}
+
+type ResponseRefreshMetadata struct {
+	Metadata *storage.Metadata `json:"metadata"`
+	Status   string            `json:"status"`
+}
+
+// NewRefreshMetadata fetches the metadata of the destination of the user's
+// link of /api/urls/metadata/{alias} again.
+func NewRefreshMetadata(getter UserURLGetter, rules AliasNormalizer, refresher MetadataRefresher) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		alias := rules.Normalize(req.PathValue("alias"))
+		ctx := logger.WithAlias(req.Context(), alias)
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		url, err := getter.GetUserURL(ctx, username, alias)
+		if err != nil {
+			err = fmt.Errorf("getting url from storage: %w", err)
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+		ctx = logger.WithURL(ctx, url)
+
+		pageMetadata, err := refresher.Refresh(ctx, alias, url)
+		if err != nil {
+			err = fmt.Errorf("refresh metadata: %w", err)
+			switch {
+			case errors.Is(err, metadata.ErrDisabled):
+				return ctx, http.StatusNotImplemented, err
+			case errors.Is(err, metadata.ErrFetch):
+				return ctx, http.StatusBadGateway, err
+			case errors.Is(err, storage.ErrAliasNotFound):
+				// The link was deleted or edited during the fetch.
+				return ctx, http.StatusConflict, err
+			default:
+				return ctx, http.StatusInternalServerError, err
+			}
+		}
+
+		// Write json response
+		response := ResponseRefreshMetadata{
+			Metadata: pageMetadata,
+			Status:   "OK",
+		}
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/aliases"
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/metadata"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMetadataCollector struct {
+	mock.Mock
+}
+
+func (m *MockMetadataCollector) Enqueue(alias, rawURL string) {
+	m.Called(alias, rawURL)
+}
+
+func newMockMetadataCollector() *MockMetadataCollector {
+	mockCollector := new(MockMetadataCollector)
+	mockCollector.On("Enqueue", mock.Anything, mock.Anything).Return()
+	return mockCollector
+}
+
+type MockUserURLGetter struct {
+	mock.Mock
+}
+
+func (m *MockUserURLGetter) GetUserURL(_ context.Context, username, alias string) (string, error) {
+	args := m.Called(username, alias)
+	return args.String(0), args.Error(1)
+}
+
+type MockMetadataRefresher struct {
+	mock.Mock
+}
+
+func (m *MockMetadataRefresher) Refresh(_ context.Context, alias, rawURL string) (*storage.Metadata, error) {
+	args := m.Called(alias, rawURL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Metadata), args.Error(1)
+}
+
+func TestRefreshMetadata(t *testing.T) {
+	fetchedAt := time.Date(2025, time.December, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		TestName                 string
+		Alias                    string
+		URL                      string
+		GetError                 error
+		Metadata                 *storage.Metadata
+		RefreshError             error
+		StatusCode               int
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName: "Success smoke test",
+			Alias:    "zn9edcu",
+			URL:      "https://en.wikipedia.org/wiki/Systems_design",
+			Metadata: &storage.Metadata{
+				Title:     "Systems design - Wikipedia",
+				Favicon:   "https://en.wikipedia.org/favicon.ico",
+				FetchedAt: fetchedAt,
+			},
+			StatusCode: http.StatusOK,
+		},
+		{
+			TestName:                 "Error alias not found",
+			Alias:                    "7OeLY0",
+			GetError:                 storage.ErrAliasNotFound,
+			StatusCode:               http.StatusNotFound,
+			ExpectedErrorDescription: "getting url from storage: alias not found",
+		},
+		{
+			TestName:                 "Error fetch",
+			Alias:                    "yc",
+			URL:                      "https://yandex.cloud/ru",
+			RefreshError:             metadata.ErrFetch,
+			StatusCode:               http.StatusBadGateway,
+			ExpectedErrorDescription: "refresh metadata: can't fetch destination page",
+		},
+		{
+			TestName:                 "Error disabled",
+			Alias:                    "gh",
+			URL:                      "https://github.com/",
+			RefreshError:             metadata.ErrDisabled,
+			StatusCode:               http.StatusNotImplemented,
+			ExpectedErrorDescription: "refresh metadata: fetching of page metadata is disabled",
+		},
+		{
+			TestName:                 "Error internal",
+			Alias:                    "Q41Tqc",
+			GetError:                 errors.New("internal"),
+			StatusCode:               http.StatusInternalServerError,
+			ExpectedErrorDescription: "getting url from storage: internal",
+		},
+		{
+			TestName: "Success alias named as the route",
+			Alias:    "metadata",
+			URL:      "https://example.com/",
+			Metadata: &storage.Metadata{
+				Title:     "Example Domain",
+				FetchedAt: fetchedAt,
+			},
+			StatusCode: http.StatusOK,
+		},
+	}
+
+	mockGetter := new(MockUserURLGetter)
+	mockRefresher := new(MockMetadataRefresher)
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodPost+" /api/urls/metadata/{alias...}", ErrorHandler("Refresh metadata", NewRefreshMetadata(mockGetter, newAliasRules(&aliases.Conf{}), mockRefresher)))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			path := "/api/urls/metadata/" + test.Alias
+			res := httptest.NewRecorder()
+			ctx := log.WithUsername(context.Background(), "Alice")
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockGetter.On("GetUserURL", "Alice", test.Alias).Return(test.URL, test.GetError)
+			mockRefresher.On("Refresh", test.Alias, test.URL).Return(test.Metadata, test.RefreshError)
+
+			mux.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if res.Code == http.StatusOK {
+				var response ResponseRefreshMetadata
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Metadata == nil || *response.Metadata != *test.Metadata {
+					t.Errorf("expected metadata %+v but received %+v", test.Metadata, response.Metadata)
+				}
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
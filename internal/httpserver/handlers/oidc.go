@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/oidc"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+// Page opened after a successful single sign-on.
+const ssoLandingPage = "/dashboard.html"
+
+type OIDCProvider interface {
+	AuthCodeURL(state, nonce, codeVerifier string) string
+	SetStateCookie(res http.ResponseWriter, st *oidc.State)
+	StateFromCookie(res http.ResponseWriter, req *http.Request) (*oidc.State, error)
+	Exchange(ctx context.Context, code, nonce, codeVerifier string) (*oidc.Identity, error)
+	Authorize(identity *oidc.Identity) (string, error)
+}
+
+type UserProvisioner interface {
+	UserGetter
+	UserCreator
+	UpdateRole(ctx context.Context, name, role string) error
+}
+
+func NewOIDCLogin(provider OIDCProvider) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		st, err := oidc.NewState()
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("new state: %w", err)
+		}
+		provider.SetStateCookie(res, st)
+
+		http.Redirect(res, req, provider.AuthCodeURL(st.State, st.Nonce, st.CodeVerifier), http.StatusFound)
+
+		return ctx, http.StatusFound, nil
+	}
+}
+
+func NewOIDCCallback(provider OIDCProvider, users UserProvisioner, issuer SessionIssuer) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		st, err := provider.StateFromCookie(res, req)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("get state: %w", err)
+		}
+		query := req.URL.Query()
+		if errCode := query.Get("error"); errCode != "" {
+			return ctx, http.StatusUnauthorized, fmt.Errorf("issuer error: %s: %s", errCode, query.Get("error_description"))
+		}
+
+		identity, err := provider.Exchange(ctx, query.Get("code"), st.Nonce, st.CodeVerifier)
+		if err != nil {
+			return ctx, http.StatusUnauthorized, fmt.Errorf("exchange code: %w", err)
+		}
+		ctx = logger.WithUsername(ctx, identity.Email)
+
+		role, err := provider.Authorize(identity)
+		if err != nil {
+			return ctx, http.StatusForbidden, fmt.Errorf("authorize: %w", err)
+		}
+
+		if code, err := provisionUser(ctx, users, identity.Email, role); err != nil {
+			return ctx, code, err
+		}
+
+		sess, err := issuer.Issue(ctx, identity.Email, role)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("issue session: %w", err)
+		}
+		issuer.SetCookies(res, sess)
+
+		http.Redirect(res, req, ssoLandingPage, http.StatusFound)
+
+		return ctx, http.StatusFound, nil
+	}
+}
+
+// provisionUser creates the user on the first single sign-on and keeps
+// the role in sync with the groups of the identity provider.
+func provisionUser(ctx context.Context, users UserProvisioner, name, role string) (int, error) {
+	user, err := users.GetUser(ctx, name)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		// Users of the identity provider have no local password.
+		user := storage.User{
+			Name:         name,
+			HashPassword: "",
+			Role:         role,
+			Provider:     storage.ProviderOIDC,
+		}
+		if err := users.CreateUser(ctx, &user); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("saving user to storage: %w", err)
+		}
+		return http.StatusOK, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("getting user from storage: %w", err)
+	}
+	if user.Provider != storage.ProviderOIDC {
+		return http.StatusConflict, fmt.Errorf("%w: registered with password", storage.ErrUserExists)
+	}
+	if user.Role != role {
+		if err := users.UpdateRole(ctx, name, role); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("updating role in storage: %w", err)
+		}
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/oidc"
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOIDCProvider struct {
+	mock.Mock
+}
+
+func (m *MockOIDCProvider) AuthCodeURL(state, _, _ string) string {
+	return "https://idp.example.com/authorize?state=" + state
+}
+
+func (m *MockOIDCProvider) SetStateCookie(_ http.ResponseWriter, _ *oidc.State) {}
+
+func (m *MockOIDCProvider) StateFromCookie(_ http.ResponseWriter, _ *http.Request) (*oidc.State, error) {
+	return &oidc.State{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}, nil
+}
+
+func (m *MockOIDCProvider) Exchange(_ context.Context, code, _, _ string) (*oidc.Identity, error) {
+	args := m.Called(code)
+	return args.Get(0).(*oidc.Identity), args.Error(1)
+}
+
+func (m *MockOIDCProvider) Authorize(identity *oidc.Identity) (string, error) {
+	args := m.Called(identity.Email)
+	return args.String(0), args.Error(1)
+}
+
+type MockUserProvisioner struct {
+	MockUserGetter
+}
+
+func (m *MockUserProvisioner) CreateUser(_ context.Context, user *storage.User) error {
+	args := m.Called(user.Name, user.Role, user.Provider)
+	return args.Error(0)
+}
+
+func (m *MockUserProvisioner) UpdateRole(_ context.Context, name, role string) error {
+	args := m.Called(name, role)
+	return args.Error(0)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	tests := []struct {
+		TestName   string
+		Email      string
+		Role       string
+		User       *storage.User
+		UserErr    error
+		StatusCode int
+		Setup      func(m *MockUserProvisioner, email, role string)
+	}{
+		{
+			TestName:   "Success first login provisions user",
+			Email:      "bob@example.com",
+			Role:       "user",
+			User:       nil,
+			UserErr:    storage.ErrUserNotFound,
+			StatusCode: http.StatusFound,
+			Setup: func(m *MockUserProvisioner, email, role string) {
+				m.On("CreateUser", email, role, storage.ProviderOIDC).Return(nil).Once()
+			},
+		},
+		{
+			TestName:   "Success admin group updates role",
+			Email:      "alice@example.com",
+			Role:       "admin",
+			User:       &storage.User{Name: "alice@example.com", Role: "user", Provider: storage.ProviderOIDC},
+			StatusCode: http.StatusFound,
+			Setup: func(m *MockUserProvisioner, email, role string) {
+				m.On("UpdateRole", email, role).Return(nil).Once()
+			},
+		},
+		{
+			TestName:   "Error local user with same name",
+			Email:      "jimmy@example.com",
+			Role:       "user",
+			User:       &storage.User{Name: "jimmy@example.com", Role: "user", Provider: storage.ProviderLocal},
+			StatusCode: http.StatusConflict,
+			Setup:      func(_ *MockUserProvisioner, _, _ string) {},
+		},
+	}
+
+	mockProvider := new(MockOIDCProvider)
+	mockUsers := new(MockUserProvisioner)
+	mockIssuer := new(MockSessionIssuer)
+	handler := ErrorHandler("OIDC callback", NewOIDCCallback(mockProvider, mockUsers, mockIssuer))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			code := "code-" + test.Email
+			mockProvider.On("Exchange", code).Return(&oidc.Identity{Email: test.Email}, nil)
+			mockProvider.On("Authorize", test.Email).Return(test.Role, nil)
+			mockUsers.On("GetUser", test.Email).Return(test.User, test.UserErr)
+			mockIssuer.On("Issue", test.Email, test.Role).Return(&session.Session{Token: "token"}, nil)
+			test.Setup(mockUsers, test.Email, test.Role)
+
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state=state&code="+code, nil)
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if test.StatusCode == http.StatusFound && res.Header().Get("Location") != ssoLandingPage {
+				t.Errorf("expected redirect to %s but received %s", ssoLandingPage, res.Header().Get("Location"))
+			}
+			mockUsers.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+// PreviewSuffix appended to an alias shows the preview page instead of
+// redirecting.
+const PreviewSuffix = "+"
+
+type URLInfoGetter interface {
+	GetURLInfo(ctx context.Context, alias string) (*storage.URL, error)
+}
+
+//nolint:tagliatelle
+type ResponsePreview struct {
+	Alias     string    `json:"alias"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Safe is false if the url is flagged as unsafe or its host is blocked.
+	Safe    bool   `json:"safe"`
+	Threat  string `json:"threat,omitempty"`
+	Blocked bool   `json:"blocked"`
+	Status  string `json:"status"`
+}
+
+//nolint:gochecknoglobals
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex, nofollow">
+    <title>Предпросмотр ссылки - URL Shortener</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.1.3/dist/css/bootstrap.min.css" rel="stylesheet">
+</head>
+<body>
+    <div class="container mt-5">
+        <div class="row justify-content-center">
+            <div class="col-md-8">
+                <div class="card">
+                    <div class="card-body">
+                        <h3 class="card-title">{{if .Title}}{{.Title}}{{else}}Предпросмотр ссылки{{end}}</h3>
+                        <p class="text-break">Короткая ссылка <code>/{{.Alias}}</code> ведет на:<br><code>{{.URL}}</code></p>
+                        <p class="text-muted">Создана: {{.CreatedAt.Format "02.01.2006"}}</p>
+                        {{if .Threat}}
+                        <div class="alert alert-danger mb-0">Ссылка отключена как небезопасная ({{.Threat}}).</div>
+                        {{else if .Blocked}}
+                        <div class="alert alert-danger mb-0">Переход по ссылке запрещен правилами сервиса.</div>
+                        {{else}}
+                        <a href="/{{.Alias}}" class="btn btn-primary" rel="noreferrer">Перейти по ссылке</a>
+                        {{end}}
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+</body>
+</html>
+`))
+
+// NewPreview describes where the alias leads without counting a click.
+func NewPreview(getter URLInfoGetter, rules AliasNormalizer, checker URLChecker) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		alias := rules.Normalize(req.PathValue("alias"))
+		ctx := logger.WithAlias(req.Context(), alias)
+
+		response, err := preview(ctx, getter, checker, alias)
+		if err != nil {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// NewPreviewPage renders the preview of /{alias}+ as an HTML page.
+func NewPreviewPage(getter URLInfoGetter, rules AliasNormalizer, checker URLChecker) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		alias := rules.Normalize(strings.TrimSuffix(req.PathValue("alias"), PreviewSuffix))
+		ctx := logger.WithAlias(req.Context(), alias)
+
+		response, err := preview(ctx, getter, checker, alias)
+		if err != nil {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		res.Header().Set("Cache-Control", "no-store")
+		if err := previewPage.Execute(res, response); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write preview page: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// WithPreview serves /{alias}+ with preview and other paths with next.
+func WithPreview(preview, next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, PreviewSuffix) {
+			preview(res, req)
+			return
+		}
+		next(res, req)
+	}
+}
+
+func preview(ctx context.Context, getter URLInfoGetter, checker URLChecker, alias string) (*ResponsePreview, error) {
+	url, err := getter.GetURLInfo(ctx, alias)
+	if err != nil {
+		return nil, fmt.Errorf("getting url from storage: %w", err)
+	}
+
+	target := storage.Target{URL: url.URLAt(url.URL, time.Now()), UTM: url.UTM}
+	destination, err := forwardURL(&target, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("forward url: %w", err)
+	}
+	blocked := checker.CheckURL(target.URL) != nil
+
+	return &ResponsePreview{
+		Alias:     alias,
+		URL:       destination,
+		Title:     url.Title,
+		CreatedAt: url.CreatedAt,
+		Safe:      url.Threat == "" && !blocked,
+		Threat:    url.Threat,
+		Blocked:   blocked,
+		Status:    "OK",
+	}, nil
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockURLInfoGetter struct {
+	mock.Mock
+}
+
+func (m *MockURLInfoGetter) GetURLInfo(_ context.Context, alias string) (*storage.URL, error) {
+	args := m.Called(alias)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.URL), args.Error(1)
+}
+
+func TestPreview(t *testing.T) {
+	createdAt := time.Date(2025, time.November, 29, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		TestName                 string
+		Alias                    string
+		URL                      *storage.URL
+		StatusCode               int
+		Error                    error
+		ExpectedResponse         ResponsePreview
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName: "Success smoke test",
+			Alias:    "spring",
+			URL: &storage.URL{
+				URL:       "https://example.com/spring?id=7",
+				Alias:     "spring",
+				Count:     120,
+				CreatedAt: createdAt,
+				UTM:       storage.UTM{Source: "newsletter"},
+				Title:     "Spring sale",
+			},
+			StatusCode: http.StatusOK,
+			Error:      nil,
+			ExpectedResponse: ResponsePreview{
+				Alias:     "spring",
+				URL:       "https://example.com/spring?id=7&utm_source=newsletter",
+				Title:     "Spring sale",
+				CreatedAt: createdAt,
+				Safe:      true,
+				Status:    "OK",
+			},
+		},
+		{
+			TestName: "Success flagged url",
+			Alias:    "setup",
+			URL: &storage.URL{
+				URL:       "https://malware.example/setup.exe",
+				Alias:     "setup",
+				CreatedAt: createdAt,
+				Threat:    "malware",
+			},
+			StatusCode: http.StatusOK,
+			Error:      nil,
+			ExpectedResponse: ResponsePreview{
+				Alias:     "setup",
+				URL:       "https://malware.example/setup.exe",
+				CreatedAt: createdAt,
+				Safe:      false,
+				Threat:    "malware",
+				Status:    "OK",
+			},
+		},
+		{
+			TestName: "Success blocked host",
+			Alias:    "login",
+			URL: &storage.URL{
+				URL:       "https://phishing.example/login",
+				Alias:     "login",
+				CreatedAt: createdAt,
+			},
+			StatusCode: http.StatusOK,
+			Error:      nil,
+			ExpectedResponse: ResponsePreview{
+				Alias:     "login",
+				URL:       "https://phishing.example/login",
+				CreatedAt: createdAt,
+				Safe:      false,
+				Blocked:   true,
+				Status:    "OK",
+			},
+		},
+		{
+			TestName:                 "Error alias not found",
+			Alias:                    "7OeLY0",
+			URL:                      nil,
+			StatusCode:               http.StatusNotFound,
+			Error:                    storage.ErrAliasNotFound,
+			ExpectedErrorDescription: "getting url from storage: alias not found",
+		},
+		{
+			TestName:                 "Error internal",
+			Alias:                    "Q41Tqc",
+			URL:                      nil,
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedErrorDescription: "getting url from storage: internal",
+		},
+	}
+
+	mockGetter := new(MockURLInfoGetter)
+	mockChecker := new(MockURLChecker)
+	mockChecker.On("CheckURL", "https://phishing.example/login").Return(hostpolicy.ErrBlocked)
+	mockChecker.On("CheckURL", mock.Anything).Return(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /api/urls/preview/{alias...}", ErrorHandler("Preview", NewPreview(mockGetter, newAliasRules(&aliases.Conf{}), mockChecker)))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/urls/preview/"+test.Alias, nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockGetter.On("GetURLInfo", test.Alias).Return(test.URL, test.Error)
+
+			mux.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if res.Code == http.StatusOK {
+				var response ResponsePreview
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response != test.ExpectedResponse {
+					t.Errorf("expected response %+v but received %+v", test.ExpectedResponse, response)
+				}
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestPreviewPage(t *testing.T) {
+	mockGetter := new(MockURLInfoGetter)
+	mockChecker := new(MockURLChecker)
+	mockChecker.On("CheckURL", mock.Anything).Return(nil)
+	mockDBURLGetter := new(MockDBURLGetter)
+	mockCacheURLGetter := new(MockCacheURLGetter)
+	rules := newAliasRules(&aliases.Conf{})
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /{alias...}", WithPreview(
+		ErrorHandler("Preview page", NewPreviewPage(mockGetter, rules, mockChecker)),
+		ErrorHandler("Redirect", NewRedirect(mockDBURLGetter, mockCacheURLGetter, rules, mockChecker, newMockCountryLocator(), newMockRedirectObserver(), http.StatusFound)),
+	))
+
+	alias := "zn9edcu"
+	url := "https://en.wikipedia.org/wiki/Systems_design"
+	mockGetter.On("GetURLInfo", alias).Return(&storage.URL{URL: url, Alias: alias, Title: "<Systems design>"}, nil)
+
+	res := httptest.NewRecorder()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias+PreviewSuffix, nil)
+	if err != nil {
+		t.Fatalf("create new request: %v", err)
+	}
+
+	mux.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Errorf("expected status code %d but received %d", http.StatusOK, res.Code)
+	}
+	body, _ := io.ReadAll(res.Body)
+	for _, expected := range []string{url, "&lt;Systems design&gt;", `href="/` + alias + `"`} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Errorf(`preview page does not contain "%s"`, expected)
+		}
+	}
+	mockDBURLGetter.AssertNotCalled(t, "GetURL", alias)
+	mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	mockCacheURLGetter.AssertNotCalled(t, "GetURL", alias)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/qr"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type QREncoder interface {
+	Defaults() qr.Options
+	ETag(content, format string, opts *qr.Options) string
+	Encode(content, format string, opts *qr.Options) ([]byte, error)
+}
+
+// NewQR renders the QR code of the short link of /api/urls/qr/{alias}.
+// The short link starts with publicURL or, if it is empty, with the scheme
+// and the host of the request.
+func NewQR(checker AliasChecker, rules AliasNormalizer, encoder QREncoder, publicURL string) HandlerFunc {
+	publicURL = strings.TrimSuffix(publicURL, "/")
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		alias := rules.Normalize(req.PathValue("alias"))
+		ctx := logger.WithAlias(req.Context(), alias)
+
+		exists, err := checker.CheckAlias(ctx, alias)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("check alias: %w", err)
+		}
+		if !exists {
+			return ctx, http.StatusNotFound, fmt.Errorf("check alias: %w", storage.ErrAliasNotFound)
+		}
+
+		query := req.URL.Query()
+		format := qrFormat(query.Get("format"), req.Header.Get("Accept"))
+		opts, err := qrOptions(encoder.Defaults(), query)
+		if err != nil {
+			return ctx, http.StatusBadRequest, err
+		}
+
+		base := publicURL
+		if base == "" {
+			scheme := "http"
+			if req.TLS != nil {
+				scheme = "https"
+			}
+			base = scheme + "://" + req.Host
+		}
+		content := base + "/" + url.PathEscape(alias)
+
+		// The image changes only with the options, so it is cached by the etag.
+		etag := encoder.ETag(content, format, opts)
+		res.Header().Set("ETag", etag)
+		res.Header().Set("Cache-Control", "public, max-age=86400")
+		res.Header().Set("Vary", "Accept")
+		if matchETag(req.Header.Get("If-None-Match"), etag) {
+			res.WriteHeader(http.StatusNotModified)
+			return ctx, http.StatusNotModified, nil
+		}
+
+		image, err := encoder.Encode(content, format, opts)
+		if err != nil {
+			err = fmt.Errorf("encode qr code: %w", err)
+			if errors.Is(err, qr.ErrInvalidOptions) {
+				res.Header().Del("ETag")
+				res.Header().Del("Cache-Control")
+				return ctx, http.StatusBadRequest, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		contentType := "image/png"
+		if format == qr.FormatSVG {
+			contentType = "image/svg+xml"
+		}
+		res.Header().Set("Content-Type", contentType)
+		if _, err := res.Write(image); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// qrFormat takes the format from the query, then from the Accept header,
+// PNG by default.
+func qrFormat(format, accept string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	if strings.Contains(accept, "image/svg+xml") {
+		return qr.FormatSVG
+	}
+
+	return qr.FormatPNG
+}
+
+func qrOptions(opts qr.Options, query url.Values) (*qr.Options, error) {
+	var err error
+	if size := query.Get("size"); size != "" {
+		if opts.Size, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("incorrect size value: %w", err)
+		}
+	}
+	if level := query.Get("level"); level != "" {
+		opts.Level = strings.ToUpper(level)
+	}
+	if margin := query.Get("margin"); margin != "" {
+		if opts.Margin, err = strconv.Atoi(margin); err != nil {
+			return nil, fmt.Errorf("incorrect margin value: %w", err)
+		}
+	}
+	if fg := query.Get("fg"); fg != "" {
+		opts.Foreground = fg
+	}
+	if bg := query.Get("bg"); bg != "" {
+		opts.Background = bg
+	}
+	if logo := query.Get("logo"); logo != "" {
+		if opts.Logo, err = strconv.ParseBool(logo); err != nil {
+			return nil, fmt.Errorf("incorrect logo value: %w", err)
+		}
+	}
+
+	return &opts, nil
+}
+
+// matchETag reports whether the If-None-Match header lists the etag.
+func matchETag(ifNoneMatch, etag string) bool {
+	for tag := range strings.SplitSeq(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/qr"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+func TestQR(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Path                     string
+		Accept                   string
+		IfNoneMatch              bool
+		StatusCode               int
+		ExpectedContentType      string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:            "Success png",
+			Path:                "/api/urls/qr/zn9edcu?size=300&level=h&fg=1a2b3c",
+			StatusCode:          http.StatusOK,
+			ExpectedContentType: "image/png",
+		},
+		{
+			TestName:            "Success svg format",
+			Path:                "/api/urls/qr/zn9edcu?format=svg&margin=0",
+			StatusCode:          http.StatusOK,
+			ExpectedContentType: "image/svg+xml",
+		},
+		{
+			TestName:            "Success svg accept",
+			Path:                "/api/urls/qr/zn9edcu",
+			Accept:              "image/svg+xml,image/*;q=0.8",
+			StatusCode:          http.StatusOK,
+			ExpectedContentType: "image/svg+xml",
+		},
+		{
+			TestName:    "Not modified",
+			Path:        "/api/urls/qr/zn9edcu",
+			IfNoneMatch: true,
+			StatusCode:  http.StatusNotModified,
+		},
+		{
+			TestName:                 "Error size too large",
+			Path:                     "/api/urls/qr/zn9edcu?size=5000",
+			StatusCode:               http.StatusBadRequest,
+			ExpectedErrorDescription: "encode qr code: invalid qr code options: size must be from 1 to 2048",
+		},
+		{
+			TestName:                 "Error incorrect size",
+			Path:                     "/api/urls/qr/zn9edcu?size=big",
+			StatusCode:               http.StatusBadRequest,
+			ExpectedErrorDescription: `incorrect size value: strconv.Atoi: parsing "big": invalid syntax`,
+		},
+		{
+			TestName:                 "Error alias not found",
+			Path:                     "/api/urls/qr/7OeLY0",
+			StatusCode:               http.StatusNotFound,
+			ExpectedErrorDescription: "check alias: alias not found",
+		},
+		{
+			TestName:                 "Error internal",
+			Path:                     "/api/urls/qr/Q41Tqc",
+			StatusCode:               http.StatusInternalServerError,
+			ExpectedErrorDescription: "check alias: internal",
+		},
+		{
+			TestName:            "Success alias named as a route",
+			Path:                "/api/urls/qr/check",
+			StatusCode:          http.StatusOK,
+			ExpectedContentType: "image/png",
+		},
+	}
+
+	generator, err := qr.New(&qr.Conf{})
+	if err != nil {
+		t.Fatalf("new qr generator: %v", err)
+	}
+	mockChecker := new(MockAliasChecker)
+	mockChecker.On("CheckAlias", "zn9edcu").Return(true, nil)
+	mockChecker.On("CheckAlias", "check").Return(true, nil)
+	mockChecker.On("CheckAlias", "7OeLY0").Return(false, nil)
+	mockChecker.On("CheckAlias", "Q41Tqc").Return(false, errors.New("internal"))
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /api/urls/qr/{alias...}", ErrorHandler("QR code", NewQR(mockChecker, newAliasRules(&aliases.Conf{}), generator, "https://sho.rt")))
+
+	opts := generator.Defaults()
+	etag := generator.ETag("https://sho.rt/zn9edcu", qr.FormatPNG, &opts)
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, test.Path, nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+			if test.Accept != "" {
+				req.Header.Set("Accept", test.Accept)
+			}
+			if test.IfNoneMatch {
+				req.Header.Set("If-None-Match", `"other", W/`+etag)
+			}
+
+			mux.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			switch res.Code {
+			case http.StatusOK:
+				if contentType := res.Header().Get("Content-Type"); contentType != test.ExpectedContentType {
+					t.Errorf("expected content type %s but received %s", test.ExpectedContentType, contentType)
+				}
+				if res.Header().Get("ETag") == "" {
+					t.Errorf("expected etag")
+				}
+				if test.ExpectedContentType == "image/png" {
+					if _, err := png.Decode(res.Body); err != nil {
+						t.Errorf("decode png: %v", err)
+					}
+				}
+			case http.StatusNotModified:
+				if res.Header().Get("ETag") != etag {
+					t.Errorf("expected etag %s but received %s", etag, res.Header().Get("ETag"))
+				}
+				if res.Body.Len() != 0 {
+					t.Errorf("expected empty body")
+				}
+			default:
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
@@ -6,57 +6,286 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/metrics"
 	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/useragent"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
 )
 
 type DBURLGetter interface {
-	GetURL(ctx context.Context, alias string) (string, error)
+	GetURL(ctx context.Context, alias string) (*storage.Target, error)
 	CountIncrement(alias string) error
+	CountCountry(alias, country string) error
+	CountVariant(alias, url string) error
 }
 
 type CacheURLGetter interface {
-	GetURL(ctx context.Context, alias string) (string, error)
-	SetURL(ctx context.Context, alias, url string) error
+	GetURL(ctx context.Context, alias string) (*storage.Target, error)
+	SetURL(ctx context.Context, alias string, target *storage.Target) error
 }
 
-func NewRedirect(st DBURLGetter, cache CacheURLGetter) HandlerFunc {
+// CountryLocator tells the country code of a client address, an empty string
+// if it is not known.
+type CountryLocator interface {
+	Country(addr netip.Addr) string
+}
+
+// RedirectObserver counts the redirects, the lookups of the cache and the
+// clicks waiting to be written to the storage.
+type RedirectObserver interface {
+	ObserveRedirect(code int)
+	ObserveCache(result string)
+	AddPendingClicks(delta int)
+}
+
+// RedirectTypes are the status codes a link may redirect with.
+//
+//nolint:gochecknoglobals
+var RedirectTypes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusSeeOther,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// ErrDotSegment is returned for a forwarded path with "." or ".." segments,
+// which could lead outside of the path of the link.
+var ErrDotSegment = errors.New("dot segment in forwarded path")
+
+// NewRedirect redirects to the target of the alias with the status code of
+// the link, or with defaultType if the link has none. For a link that
+// forwards the path, /alias/rest/of/path is redirected to url/rest/of/path.
+// The click is counted, by the country of the client too if it is known, only
+// once the link is active and its destination is allowed.
+func NewRedirect(st DBURLGetter, cache CacheURLGetter, rules AliasValidator, checker URLChecker, locator CountryLocator, observer RedirectObserver, defaultType int) HandlerFunc {
+	if !slices.Contains(RedirectTypes, defaultType) {
+		defaultType = http.StatusFound
+	}
 	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
-		alias := req.PathValue("alias")
+		alias := rules.Normalize(req.PathValue("alias"))
 		ctx := logger.WithAlias(req.Context(), alias)
 		msg := "Redirect"
 
-		url, err := cache.GetURL(ctx, alias)
+		rest := ""
+		target, err := getTarget(ctx, st, cache, rules, observer, alias)
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			// The escaped path is split so that an encoded slash stays in its segment.
+			escapedAlias, escapedRest, found := strings.Cut(strings.TrimPrefix(req.URL.EscapedPath(), "/"), "/")
+			if prefix, errUnescape := url.PathUnescape(escapedAlias); found && errUnescape == nil {
+				prefix = rules.Normalize(prefix)
+				prefixTarget, errPrefix := getTarget(logger.WithAlias(ctx, prefix), st, cache, rules, observer, prefix)
+				switch {
+				case errPrefix == nil && prefixTarget.ForwardPath:
+					alias, target, rest, err = prefix, prefixTarget, escapedRest, nil
+					ctx = logger.WithAlias(ctx, alias)
+				case errPrefix != nil && !errors.Is(errPrefix, storage.ErrAliasNotFound):
+					err = errPrefix
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, storage.ErrAliasNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+		ctx = logger.WithURL(ctx, target.URL)
+
+		now := time.Now()
+		if status, err := checkActive(&target.Schedule, now); err != nil {
+			res.Header().Set("Cache-Control", "no-store")
+			return ctx, status, err
+		}
+
+		// Flagged urls are never cached, see safety.Scanner.Flag.
+		if target.Threat != "" {
+			if err := writeWarning(res, target.URL, target.Threat); err != nil {
+				slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
+			}
+			return ctx, http.StatusForbidden, nil
+		}
+
+		// The destination depends on the device, so must be cached by it,
+		// and on the client address, which shared caches can not vary by.
+		routed := *target
+		routed.URL = target.URLAt(target.URL, now)
+		agent := useragent.Parse(req.UserAgent())
+		country := locator.Country(realip.Addr(req))
+		variant := ""
+		cacheControl := ""
+		if len(target.Targets) != 0 {
+			res.Header().Add("Vary", "User-Agent")
+			if hasCountryRule(target) {
+				cacheControl = "private"
+			}
+		}
+		if targeted, ok := matchTarget(target, agent, country); ok {
+			routed.URL = targeted
+		} else if len(target.Variants) != 0 && agent.Device != useragent.DeviceBot {
+			// Every click must reach the split to be counted.
+			variant = variantURL(res, req, alias, target)
+			routed.URL = variant
+			cacheControl = "no-store"
+		}
+		if cacheControl = withMaxAge(cacheControl, &target.Schedule, now); cacheControl != "" {
+			res.Header().Set("Cache-Control", cacheControl)
+		}
+
+		// Hosts blocked after the url was created must not be redirected to.
+		if err := checker.CheckURL(routed.URL); err != nil {
+			return ctx, checkURLStatus(err), fmt.Errorf("check url: %w", err)
+		}
+
+		location, err := forwardURL(&routed, rest, req.URL.RawQuery)
 		if err != nil {
-			err = fmt.Errorf("getting url from cache: %w", err)
+			return ctx, http.StatusBadRequest, fmt.Errorf("forward url: %w", err)
+		}
+
+		// Only the clicks actually redirected are counted.
+		countClick(ctx, observer, func() error { return st.CountIncrement(alias) })
+		if country != "" {
+			countClick(ctx, observer, func() error { return st.CountCountry(alias, country) })
+		}
+		if variant != "" {
+			countClick(ctx, observer, func() error { return st.CountVariant(alias, variant) })
+		}
+
+		// redirect to found url
+		code := target.RedirectType
+		if code == 0 {
+			code = defaultType
+		}
+		http.Redirect(res, req, location, code)
+		observer.ObserveRedirect(code)
+
+		return ctx, code, nil
+	}
+}
+
+// getTarget looks the alias up in the cache and then in the storage, caching
+// the url found unless it is flagged. A string that can not be an alias, like
+// a path with a slash, is not found without a lookup.
+func getTarget(ctx context.Context, st DBURLGetter, cache CacheURLGetter, rules AliasValidator, observer RedirectObserver, alias string) (*storage.Target, error) {
+	msg := "Redirect"
+
+	if err := rules.Validate(alias); err != nil {
+		return nil, fmt.Errorf("%w: %w", storage.ErrAliasNotFound, err)
+	}
+
+	target, err := cache.GetURL(ctx, alias)
+	switch {
+	case err != nil:
+		observer.ObserveCache(metrics.CacheError)
+		err = fmt.Errorf("getting url from cache: %w", err)
+		slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
+	case target != nil:
+		observer.ObserveCache(metrics.CacheHit)
+		return target, nil
+	default:
+		observer.ObserveCache(metrics.CacheMiss)
+	}
+
+	target, err = st.GetURL(ctx, alias)
+	if err != nil {
+		return nil, fmt.Errorf("getting url from storage: %w", err)
+	}
+	if target.Threat == "" {
+		if err := cache.SetURL(ctx, alias, target); err != nil {
 			slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
 		}
-		if url == "" {
-			url, err = st.GetURL(ctx, alias)
+	}
+
+	return target, nil
+}
+
+// countClick writes the click to the storage in the background, keeping
+// track of the writes not finished yet.
+func countClick(ctx context.Context, observer RedirectObserver, count func() error) {
+	observer.AddPendingClicks(1)
+	go func() {
+		defer observer.AddPendingClicks(-1)
+		if err := count(); err != nil {
+			slog.WarnContext(ctx, "Redirect", slog.String("warn", err.Error()))
+		}
+	}()
+}
+
+// forwardURL appends the escaped rest of the request path to the url of the
+// target and merges the campaign parameters of the target and the raw query
+// of the request into it, as far as the target forwards them. Parameters
+// merged later replace the parameters with the same name, the others are kept
+// as they are encoded.
+func forwardURL(target *storage.Target, rest, rawQuery string) (string, error) {
+	if !target.ForwardQuery {
+		rawQuery = ""
+	}
+	utm := utmQuery(&target.UTM)
+	if rest == "" && rawQuery == "" && utm == "" {
+		return target.URL, nil
+	}
+
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+	if rest != "" {
+		for segment := range strings.SplitSeq(rest, "/") {
+			segment, err := url.PathUnescape(segment)
 			if err != nil {
-				err = fmt.Errorf("getting url from storage: %w", err)
-				if errors.Is(err, storage.ErrAliasNotFound) {
-					return ctx, http.StatusNotFound, err
-				}
-				return ctx, http.StatusInternalServerError, err
+				return "", fmt.Errorf("unescape path: %w", err)
 			}
-			ctx = logger.WithURL(ctx, url)
-			if err := cache.SetURL(ctx, alias, url); err != nil {
-				slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
+			if segment == "." || segment == ".." {
+				return "", fmt.Errorf("%w: %q", ErrDotSegment, rest)
 			}
-		} else {
-			ctx = logger.WithURL(ctx, url)
-			go func() {
-				if err := st.CountIncrement(alias); err != nil {
-					slog.WarnContext(ctx, msg, slog.String("warn", err.Error()))
-				}
-			}()
 		}
+		u = u.JoinPath(rest)
+	}
+	if utm != "" || rawQuery != "" {
+		u.RawQuery = mergeQuery(mergeQuery(u.RawQuery, utm), rawQuery)
+		u.ForceQuery = false
+	}
 
-		// redirect to found url
-		http.Redirect(res, req, url, http.StatusFound)
+	return u.String(), nil
+}
 
-		return ctx, http.StatusFound, nil
+// mergeQuery merges the raw query src into the raw query dst without
+// re-encoding either of them.
+func mergeQuery(dst, src string) string {
+	params := make([]string, 0)
+	keys := make(map[string]struct{})
+	for param := range strings.SplitSeq(src, "&") {
+		if param == "" {
+			continue
+		}
+		keys[queryKey(param)] = struct{}{}
+		params = append(params, param)
 	}
+	merged := make([]string, 0)
+	for param := range strings.SplitSeq(dst, "&") {
+		if param == "" {
+			continue
+		}
+		if _, ok := keys[queryKey(param)]; !ok {
+			merged = append(merged, param)
+		}
+	}
+
+	return strings.Join(append(merged, params...), "&")
+}
+
+func queryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+
+	return key
 }
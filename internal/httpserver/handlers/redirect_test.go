@@ -5,11 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+	"time"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	"github.com/mrvin/url-shortener/internal/storage"
 	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
 	"github.com/stretchr/testify/mock"
@@ -19,9 +24,12 @@ type MockDBURLGetter struct {
 	mock.Mock
 }
 
-func (m *MockDBURLGetter) GetURL(_ context.Context, alias string) (string, error) {
+func (m *MockDBURLGetter) GetURL(_ context.Context, alias string) (*storage.Target, error) {
 	args := m.Called(alias)
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Target), args.Error(1)
 }
 
 func (m *MockDBURLGetter) CountIncrement(alias string) error {
@@ -29,25 +37,82 @@ func (m *MockDBURLGetter) CountIncrement(alias string) error {
 	return args.Error(0)
 }
 
+func (m *MockDBURLGetter) CountCountry(alias, country string) error {
+	args := m.Called(alias, country)
+	return args.Error(0)
+}
+
+func (m *MockDBURLGetter) CountVariant(alias, url string) error {
+	args := m.Called(alias, url)
+	return args.Error(0)
+}
+
+type MockCountryLocator struct {
+	mock.Mock
+}
+
+func (m *MockCountryLocator) Country(addr netip.Addr) string {
+	args := m.Called(addr.String())
+	return args.String(0)
+}
+
+func newMockCountryLocator() *MockCountryLocator {
+	mockLocator := new(MockCountryLocator)
+	mockLocator.On("Country", "81.2.69.160").Return("GB")
+	mockLocator.On("Country", "2.125.160.216").Return("DE")
+	mockLocator.On("Country", mock.Anything).Return("")
+	return mockLocator
+}
+
+type MockRedirectObserver struct {
+	mock.Mock
+}
+
+func (m *MockRedirectObserver) ObserveRedirect(code int) {
+	m.Called(code)
+}
+
+func (m *MockRedirectObserver) ObserveCache(result string) {
+	m.Called(result)
+}
+
+func (m *MockRedirectObserver) AddPendingClicks(delta int) {
+	m.Called(delta)
+}
+
+func newMockRedirectObserver() *MockRedirectObserver {
+	mockObserver := new(MockRedirectObserver)
+	mockObserver.On("ObserveRedirect", mock.Anything).Return()
+	mockObserver.On("ObserveCache", mock.Anything).Return()
+	mockObserver.On("AddPendingClicks", mock.Anything).Return()
+	return mockObserver
+}
+
 type MockCacheURLGetter struct {
 	mock.Mock
 }
 
-func (m *MockCacheURLGetter) GetURL(_ context.Context, alias string) (string, error) {
+func (m *MockCacheURLGetter) GetURL(_ context.Context, alias string) (*storage.Target, error) {
 	args := m.Called(alias)
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Target), args.Error(1)
 }
 
-func (m *MockCacheURLGetter) SetURL(_ context.Context, alias, url string) error {
-	args := m.Called(alias, url)
+func (m *MockCacheURLGetter) SetURL(_ context.Context, alias string, target *storage.Target) error {
+	args := m.Called(alias, target.URL)
 	return args.Error(0)
 }
 
 func TestRedirect(t *testing.T) {
 	mockDBURLGetter := new(MockDBURLGetter)
 	mockCacheURLGetter := new(MockCacheURLGetter)
+	mockChecker := new(MockURLChecker)
+	mockChecker.On("CheckURL", "https://phishing.example/login").Return(hostpolicy.ErrBlocked)
+	mockChecker.On("CheckURL", mock.Anything).Return(nil)
 	mux := http.NewServeMux()
-	mux.HandleFunc(http.MethodGet+" /{alias...}", ErrorHandler("Redirect", NewRedirect(mockDBURLGetter, mockCacheURLGetter)))
+	mux.HandleFunc(http.MethodGet+" /{alias...}", ErrorHandler("Redirect", NewRedirect(mockDBURLGetter, mockCacheURLGetter, newAliasRules(&aliases.Conf{}), mockChecker, newMockCountryLocator(), newMockRedirectObserver(), http.StatusFound)))
 
 	t.Run("Success smoke test and cache miss", func(t *testing.T) {
 		t.Parallel()
@@ -61,9 +126,10 @@ func TestRedirect(t *testing.T) {
 			t.Fatalf("create new request: %v", err)
 		}
 
-		mockCacheURLGetter.On("GetURL", alias).Return("", nil)
-		mockDBURLGetter.On("GetURL", alias).Return(url, nil)
+		mockCacheURLGetter.On("GetURL", alias).Return(nil, nil)
+		mockDBURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url}, nil)
 		mockCacheURLGetter.On("SetURL", alias, url).Return(nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
 
 		mux.ServeHTTP(res, req)
 
@@ -90,7 +156,7 @@ func TestRedirect(t *testing.T) {
 			t.Fatalf("create new request: %v", err)
 		}
 
-		mockCacheURLGetter.On("GetURL", alias).Return(url, nil)
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url}, nil)
 		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
 
 		mux.ServeHTTP(res, req)
@@ -105,6 +171,439 @@ func TestRedirect(t *testing.T) {
 		}
 	})
 
+	t.Run("Success redirect type of link and cache miss", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "promo-2025"
+		url := "https://www.youtube.com/@promo"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(nil, nil)
+		mockDBURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url, RedirectType: http.StatusMovedPermanently}, nil)
+		mockCacheURLGetter.On("SetURL", alias, url).Return(nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusMovedPermanently
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+	})
+
+	t.Run("Success redirect type of link and cache hit", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "api-docs"
+		url := "https://example.com/api/v1/docs"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url, RedirectType: http.StatusTemporaryRedirect}, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusTemporaryRedirect
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		if location := res.Header().Get("Location"); location != url {
+			t.Errorf(`expected location "%s" but received "%s"`, url, location)
+		}
+	})
+
+	t.Run("Success case-insensitive alias", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "promo"
+		url := "https://www.youtube.com/"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/Promo", nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url}, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		handler := ErrorHandler("Redirect", NewRedirect(mockDBURLGetter, mockCacheURLGetter, newAliasRules(&aliases.Conf{CaseInsensitive: true}), mockChecker, newMockCountryLocator(), newMockRedirectObserver(), http.StatusFound))
+		mux := http.NewServeMux()
+		mux.HandleFunc(http.MethodGet+" /{alias...}", handler)
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusFound
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if !bytes.Contains(body, []byte(url)) {
+			t.Errorf(`response does not contain "%s"`, url)
+		}
+	})
+
+	t.Run("Success device targeting", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "app"
+		target := &storage.Target{
+			URL: "https://example.com/app",
+			Targets: []storage.TargetRule{
+				{OS: "ios", URL: "https://apps.apple.com/app/id123"},
+				{OS: "android", Device: "mobile", URL: "https://play.google.com/store/apps/details?id=com.example"},
+			},
+		}
+		mockCacheURLGetter.On("GetURL", alias).Return(target, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		tests := []struct {
+			userAgent string
+			location  string
+		}{
+			{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Mobile/15E148", "https://apps.apple.com/app/id123"},
+			{"Mozilla/5.0 (Linux; Android 14; Pixel 8) Chrome/126.0.0.0 Mobile Safari/537.36", "https://play.google.com/store/apps/details?id=com.example"},
+			{"Mozilla/5.0 (Linux; Android 13; SM-X700) Chrome/126.0.0.0 Safari/537.36", "https://example.com/app"},
+			{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/126.0.0.0 Safari/537.36", "https://example.com/app"},
+		}
+		for _, test := range tests {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+			if err != nil {
+				t.Fatalf("create new request: %v", err)
+			}
+			req.Header.Set("User-Agent", test.userAgent)
+
+			mux.ServeHTTP(res, req)
+
+			if location := res.Header().Get("Location"); location != test.location {
+				t.Errorf(`%s: expected location "%s" but received "%s"`, test.userAgent, test.location, location)
+			}
+			if vary := res.Header().Get("Vary"); vary != "User-Agent" {
+				t.Errorf(`expected vary "User-Agent" but received "%s"`, vary)
+			}
+		}
+	})
+
+	t.Run("Success geo targeting", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "shop"
+		target := &storage.Target{
+			URL: "https://example.com/shop",
+			Targets: []storage.TargetRule{
+				{Country: "GB", Device: "mobile", URL: "https://m.example.co.uk/shop"},
+				{Country: "GB", URL: "https://example.co.uk/shop"},
+				{Country: "DE", URL: "https://example.de/shop"},
+			},
+		}
+		mockCacheURLGetter.On("GetURL", alias).Return(target, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+		counted := make(chan string, 4)
+		mockDBURLGetter.On("CountCountry", alias, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			counted <- args.String(1)
+		})
+
+		tests := []struct {
+			remoteAddr string
+			userAgent  string
+			location   string
+			country    string
+		}{
+			{"81.2.69.160:52140", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/126.0.0.0 Safari/537.36", "https://example.co.uk/shop", "GB"},
+			{"81.2.69.160:52141", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Mobile/15E148", "https://m.example.co.uk/shop", "GB"},
+			{"2.125.160.216:40000", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", "https://example.de/shop", "DE"},
+			{"81.2.69.160:52142", "TelegramBot (like TwitterBot)", "https://example.com/shop", "GB"},
+			{"8.8.8.8:53000", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", "https://example.com/shop", ""},
+		}
+		for _, test := range tests {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+			if err != nil {
+				t.Fatalf("create new request: %v", err)
+			}
+			req.RemoteAddr = test.remoteAddr
+			req.Header.Set("User-Agent", test.userAgent)
+
+			mux.ServeHTTP(res, req)
+
+			if location := res.Header().Get("Location"); location != test.location {
+				t.Errorf(`%s: expected location "%s" but received "%s"`, test.remoteAddr, test.location, location)
+			}
+			if cacheControl := res.Header().Get("Cache-Control"); cacheControl != "private" {
+				t.Errorf(`expected cache control "private" but received "%s"`, cacheControl)
+			}
+			if test.country == "" {
+				continue
+			}
+			select {
+			case country := <-counted:
+				if country != test.country {
+					t.Errorf(`%s: expected click from "%s" but received "%s"`, test.remoteAddr, test.country, country)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%s: click from %s not counted", test.remoteAddr, test.country)
+			}
+		}
+	})
+
+	t.Run("Success A/B split", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "landing"
+		target := &storage.Target{
+			URL: "https://example.com/landing",
+			Variants: []storage.Variant{
+				{URL: "https://example.com/landing-a", Weight: 1},
+				{URL: "https://example.com/landing-b", Weight: 1},
+			},
+		}
+		mockCacheURLGetter.On("GetURL", alias).Return(target, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+		counted := make(chan string, 1)
+		mockDBURLGetter.On("CountVariant", alias, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			counted <- args.String(1)
+		})
+
+		locations := make(map[string]int)
+		for range 50 {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+			if err != nil {
+				t.Fatalf("create new request: %v", err)
+			}
+
+			mux.ServeHTTP(res, req)
+
+			location := res.Header().Get("Location")
+			locations[location]++
+			if cacheControl := res.Header().Get("Cache-Control"); cacheControl != "no-store" {
+				t.Errorf(`expected cache control "no-store" but received "%s"`, cacheControl)
+			}
+			if cookie := res.Header().Get("Set-Cookie"); cookie != "" {
+				t.Errorf(`expected no cookie but received "%s"`, cookie)
+			}
+			select {
+			case url := <-counted:
+				if url != location {
+					t.Errorf(`expected click of "%s" but received "%s"`, location, url)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("click of %s not counted", location)
+			}
+		}
+		if len(locations) != 2 || locations["https://example.com/landing-a"] == 0 || locations["https://example.com/landing-b"] == 0 {
+			t.Errorf("expected both variants but received %v", locations)
+		}
+	})
+
+	t.Run("Success sticky variant", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "sticky"
+		target := &storage.Target{
+			URL: "https://example.com/sticky",
+			Variants: []storage.Variant{
+				{URL: "https://example.com/sticky-a", Weight: 1},
+				{URL: "https://example.com/sticky-b", Weight: 1},
+				{URL: "https://example.com/sticky-c", Weight: 1},
+			},
+			Sticky: true,
+		}
+		mockCacheURLGetter.On("GetURL", alias).Return(target, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+		mockDBURLGetter.On("CountVariant", alias, mock.Anything).Return(nil)
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+		mux.ServeHTTP(res, req)
+
+		location := res.Header().Get("Location")
+		cookies := res.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != VariantCookie || cookies[0].Path != "/"+alias {
+			t.Fatalf("expected variant cookie with path /%s but received %v", alias, cookies)
+		}
+		for range 10 {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+			if err != nil {
+				t.Fatalf("create new request: %v", err)
+			}
+			req.AddCookie(cookies[0])
+
+			mux.ServeHTTP(res, req)
+
+			if sticky := res.Header().Get("Location"); sticky != location {
+				t.Errorf(`expected location "%s" but received "%s"`, location, sticky)
+			}
+			if cookie := res.Header().Get("Set-Cookie"); cookie != "" {
+				t.Errorf(`expected no new cookie but received "%s"`, cookie)
+			}
+		}
+
+		// Bots get the url of the link.
+		res = httptest.NewRecorder()
+		req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+		req.Header.Set("User-Agent", "TelegramBot (like TwitterBot)")
+		mux.ServeHTTP(res, req)
+		if location := res.Header().Get("Location"); location != target.URL {
+			t.Errorf(`expected location "%s" but received "%s"`, target.URL, location)
+		}
+	})
+
+	t.Run("Success scheduled change", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "event"
+		now := time.Now()
+		target := &storage.Target{
+			URL: "https://example.com/register",
+			Schedule: storage.Schedule{
+				Changes: []storage.ScheduledChange{
+					{At: now.Add(-time.Hour), URL: "https://example.com/live"},
+					{At: now.Add(time.Hour), URL: "https://example.com/recording"},
+				},
+			},
+		}
+		mockCacheURLGetter.On("GetURL", alias).Return(target, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mux.ServeHTTP(res, req)
+
+		if location := res.Header().Get("Location"); location != "https://example.com/live" {
+			t.Errorf(`expected location "https://example.com/live" but received "%s"`, location)
+		}
+		var maxAge int
+		if _, err := fmt.Sscanf(res.Header().Get("Cache-Control"), "max-age=%d", &maxAge); err != nil || maxAge <= 0 || maxAge > 3600 {
+			t.Errorf(`expected max age until the next change but received "%s"`, res.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("Error link not active yet", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "soon"
+		from := time.Now().Add(time.Hour)
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: "https://example.com/soon", Schedule: storage.Schedule{ActiveFrom: &from}}, nil)
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mux.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d but received %d", http.StatusNotFound, res.Code)
+		}
+		var response httpresponse.RequestError
+		json.Unmarshal(res.Body.Bytes(), &response)
+		if expected := "link is not active yet: active from " + from.Format(time.RFC3339); response.Error != expected {
+			t.Errorf(`expected description "%s" but received "%s"`, expected, response.Error)
+		}
+		mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	})
+
+	t.Run("Error link expired", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "past"
+		until := time.Now().Add(-time.Hour)
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: "https://example.com/past", Schedule: storage.Schedule{ActiveUntil: &until}}, nil)
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mux.ServeHTTP(res, req)
+
+		if res.Code != http.StatusGone {
+			t.Errorf("expected status code %d but received %d", http.StatusGone, res.Code)
+		}
+		if cacheControl := res.Header().Get("Cache-Control"); cacheControl != "no-store" {
+			t.Errorf(`expected cache control "no-store" but received "%s"`, cacheControl)
+		}
+		mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	})
+
+	t.Run("Success forward path and query", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "guide"
+		url := "https://docs.example/guide?lang=en#top"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias+"/intro/a%2Fb?lang=ru&ref=tw", nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url, ForwardQuery: true, ForwardPath: true}, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		mux.ServeHTTP(res, req)
+
+		// The full path is not a valid alias, so only the prefix is looked up.
+		mockCacheURLGetter.AssertNotCalled(t, "GetURL", alias+"/intro/a/b")
+		mockDBURLGetter.AssertNotCalled(t, "GetURL", alias+"/intro/a/b")
+
+		status := http.StatusFound
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		expectedLocation := "https://docs.example/guide/intro/a%2Fb?lang=ru&ref=tw#top"
+		if location := res.Header().Get("Location"); location != expectedLocation {
+			t.Errorf(`expected location "%s" but received "%s"`, expectedLocation, location)
+		}
+	})
+
+	t.Run("Error path of link not forwarding it", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "wiki"
+		url := "https://en.wikipedia.org/wiki"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias+"/Go?x=1", nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url, ForwardQuery: true}, nil)
+		mockDBURLGetter.On("CountIncrement", alias).Return(nil)
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusNotFound
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+	})
+
 	t.Run("Error alias not found", func(t *testing.T) {
 		t.Parallel()
 
@@ -116,8 +615,8 @@ func TestRedirect(t *testing.T) {
 			t.Fatalf("create new request: %v", err)
 		}
 
-		mockCacheURLGetter.On("GetURL", alias).Return("", nil)
-		mockDBURLGetter.On("GetURL", alias).Return("", storage.ErrAliasNotFound)
+		mockCacheURLGetter.On("GetURL", alias).Return(nil, nil)
+		mockDBURLGetter.On("GetURL", alias).Return(nil, storage.ErrAliasNotFound)
 
 		mux.ServeHTTP(res, req)
 
@@ -138,6 +637,86 @@ func TestRedirect(t *testing.T) {
 		}
 	})
 
+	t.Run("Error invalid alias is not looked up", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "lockout:failures:user:alice"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusNotFound
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		mockCacheURLGetter.AssertNotCalled(t, "GetURL", alias)
+		mockDBURLGetter.AssertNotCalled(t, "GetURL", alias)
+		mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	})
+
+	t.Run("Flagged url shows warning", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "setup"
+		url := "https://malware.example/setup.exe"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(nil, nil)
+		mockDBURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url, Threat: "malware"}, nil)
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusForbidden
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		if location := res.Header().Get("Location"); location != "" {
+			t.Errorf("unexpected redirect to %q", location)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if !bytes.Contains(body, []byte("malware")) {
+			t.Errorf("warning page does not contain the threat")
+		}
+		mockCacheURLGetter.AssertNotCalled(t, "SetURL", alias, url)
+		mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	})
+
+	t.Run("Error blocked host", func(t *testing.T) {
+		t.Parallel()
+
+		alias := "login"
+		url := "https://phishing.example/login"
+
+		res := httptest.NewRecorder()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/"+alias, nil)
+		if err != nil {
+			t.Fatalf("create new request: %v", err)
+		}
+
+		mockCacheURLGetter.On("GetURL", alias).Return(&storage.Target{URL: url}, nil)
+
+		mux.ServeHTTP(res, req)
+
+		status := http.StatusForbidden
+		if res.Code != status {
+			t.Errorf("expected status code %d but received %d", status, res.Code)
+		}
+		if location := res.Header().Get("Location"); location != "" {
+			t.Errorf("unexpected redirect to %q", location)
+		}
+		mockDBURLGetter.AssertNotCalled(t, "CountIncrement", alias)
+	})
+
 	t.Run("Error internal", func(t *testing.T) {
 		t.Parallel()
 
@@ -149,8 +728,8 @@ func TestRedirect(t *testing.T) {
 			t.Fatalf("create new request: %v", err)
 		}
 
-		mockCacheURLGetter.On("GetURL", alias).Return("", nil)
-		mockDBURLGetter.On("GetURL", alias).Return("", errors.New("internal"))
+		mockCacheURLGetter.On("GetURL", alias).Return(nil, nil)
+		mockDBURLGetter.On("GetURL", alias).Return(nil, errors.New("internal"))
 
 		mux.ServeHTTP(res, req)
 
@@ -172,3 +751,95 @@ func TestRedirect(t *testing.T) {
 	})
 
 }
+
+func TestForwardURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      storage.Target
+		rest        string
+		rawQuery    string
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			name:        "Nothing forwarded",
+			target:      storage.Target{URL: "https://example.com/a?b=1"},
+			rest:        "",
+			rawQuery:    "c=2",
+			expectedURL: "https://example.com/a?b=1",
+		},
+		{
+			name:        "Query appended",
+			target:      storage.Target{URL: "https://example.com/a", ForwardQuery: true},
+			rawQuery:    "q=go+lang&empty=&flag",
+			expectedURL: "https://example.com/a?q=go+lang&empty=&flag",
+		},
+		{
+			name:        "Query merged keeps encoding of destination",
+			target:      storage.Target{URL: "https://example.com/?b=%D1%8F&a=1&a=2", ForwardQuery: true},
+			rawQuery:    "a=3&c=%2526",
+			expectedURL: "https://example.com/?b=%D1%8F&a=3&c=%2526",
+		},
+		{
+			name:        "Query key compared unescaped",
+			target:      storage.Target{URL: "https://example.com/?utm%5Fsource=mail", ForwardQuery: true},
+			rawQuery:    "utm_source=tw",
+			expectedURL: "https://example.com/?utm_source=tw",
+		},
+		{
+			name:        "Path joined to root",
+			target:      storage.Target{URL: "https://example.com/", ForwardPath: true},
+			rest:        "docs/intro",
+			expectedURL: "https://example.com/docs/intro",
+		},
+		{
+			name:        "Path keeps trailing slash and encoding",
+			target:      storage.Target{URL: "https://example.com/base/", ForwardPath: true},
+			rest:        "%D0%BF%D1%83%D1%82%D1%8C/a%2Fb%20c/",
+			expectedURL: "https://example.com/base/%D0%BF%D1%83%D1%82%D1%8C/a%2Fb%20c/",
+		},
+		{
+			name:        "Path and query with fragment",
+			target:      storage.Target{URL: "https://example.com/base?x=1#frag", ForwardPath: true, ForwardQuery: true},
+			rest:        "page",
+			rawQuery:    "y=2",
+			expectedURL: "https://example.com/base/page?x=1&y=2#frag",
+		},
+		{
+			name: "Campaign parameters replace destination ones",
+			target: storage.Target{
+				URL: "https://example.com/?utm_source=old&id=7",
+				UTM: storage.UTM{Source: "newsletter", Campaign: "spring sale"},
+			},
+			expectedURL: "https://example.com/?id=7&utm_campaign=spring+sale&utm_source=newsletter",
+		},
+		{
+			name: "Query of request replaces campaign parameters",
+			target: storage.Target{
+				URL:          "https://example.com/",
+				ForwardQuery: true,
+				UTM:          storage.UTM{Source: "newsletter", Medium: "email"},
+			},
+			rawQuery:    "utm_source=tw",
+			expectedURL: "https://example.com/?utm_medium=email&utm_source=tw",
+		},
+		{
+			name:        "Error dot segment",
+			target:      storage.Target{URL: "https://example.com/base", ForwardPath: true},
+			rest:        "a/%2E%2E/admin",
+			expectedErr: ErrDotSegment,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forwarded, err := forwardURL(&test.target, test.rest, test.rawQuery)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf(`expected error "%v" but received "%v"`, test.expectedErr, err)
+			}
+			if forwarded != test.expectedURL {
+				t.Errorf(`expected url "%s" but received "%s"`, test.expectedURL, forwarded)
+			}
+		})
+	}
+}
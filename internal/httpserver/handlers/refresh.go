@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type SessionRefresher interface {
+	SessionIssuer
+	Refresh(ctx context.Context, claims *session.Claims, role string) (*session.Session, error)
+}
+
+// NewRefresh reissues the session with the role the user has now, so that a
+// demoted user does not keep the old role by refreshing.
+func NewRefresh(getter UserGetter, refresher SessionRefresher) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		claims, err := session.GetClaimsFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusUnauthorized, fmt.Errorf("get session from ctx: %w", err)
+		}
+
+		user, err := getter.GetUser(ctx, claims.Username)
+		if err != nil {
+			err = fmt.Errorf("getting user from storage: %w", err)
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return ctx, http.StatusUnauthorized, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		sess, err := refresher.Refresh(ctx, claims, user.Role)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("refresh session: %w", err)
+		}
+
+		return writeSession(ctx, res, refresher, sess)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/session"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type MockSessionRefresher struct {
+	MockSessionIssuer
+}
+
+func (m *MockSessionRefresher) Refresh(_ context.Context, claims *session.Claims, role string) (*session.Session, error) {
+	args := m.Called(claims.Username, role)
+	return args.Get(0).(*session.Session), args.Error(1)
+}
+
+func TestRefresh(t *testing.T) {
+	mockGetter := new(MockUserGetter)
+	mockGetter.On("GetUser", "Alice").Return(&storage.User{Name: "Alice", Role: "user"}, nil)
+	mockGetter.On("GetUser", "Bob").Return((*storage.User)(nil), storage.ErrUserNotFound)
+	mockRefresher := new(MockSessionRefresher)
+	mockRefresher.On("Refresh", "Alice", "user").Return(&session.Session{Token: "token", Claims: session.Claims{Username: "Alice", Role: "user"}}, nil)
+	handler := ErrorHandler("Refresh session", NewRefresh(mockGetter, mockRefresher))
+
+	tests := []struct {
+		TestName   string
+		Claims     *session.Claims
+		StatusCode int
+	}{
+		{"Success demoted admin gets current role", &session.Claims{ID: "id", Username: "Alice", Role: "admin"}, http.StatusOK},
+		{"Error deleted user", &session.Claims{ID: "id", Username: "Bob", Role: "user"}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			ctx := session.WithClaims(context.Background(), test.Claims)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/users/refresh", nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+		})
+	}
+	mockRefresher.AssertNotCalled(t, "Refresh", "Alice", "admin")
+	mockRefresher.AssertNotCalled(t, "Refresh", "Bob", "user")
+}
@@ -58,6 +58,7 @@ func NewRegistration(creator UserCreator) HandlerFunc {
 			Name:         request.Username,
 			HashPassword: string(hashPassword),
 			Role:         "user",
+			Provider:     storage.ProviderLocal,
 		}
 
 		if err = creator.CreateUser(ctx, &user); err != nil {
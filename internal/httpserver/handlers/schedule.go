@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+var (
+	ErrLinkInactive    = errors.New("link is not active yet")
+	ErrLinkExpired     = errors.New("link is no longer active")
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+// RequestScheduledChange replaces the url of the link from At on.
+type RequestScheduledChange struct {
+	At  time.Time `json:"at"  validate:"required"`
+	URL string    `json:"url" validate:"required,url"`
+}
+
+// RequestSchedule is the time the link is active and the changes of its url.
+//
+//nolint:tagliatelle
+type RequestSchedule struct {
+	ActiveFrom  *time.Time               `json:"active_from,omitempty"`
+	ActiveUntil *time.Time               `json:"active_until,omitempty"`
+	Schedule    []RequestScheduledChange `json:"schedule,omitempty"    validate:"max=20,dive"`
+}
+
+// checkSchedule validates the activation window and the urls of the changes
+// the same way as the url of the link and returns the schedule with the
+// changes sorted by the time and normalized urls.
+func checkSchedule(
+	ctx context.Context,
+	request *RequestSchedule,
+	requestHost string,
+	destinations DestinationValidator,
+	checker URLChecker,
+	safetyChecker SafetyChecker,
+) (storage.Schedule, int, error) {
+	var schedule storage.Schedule
+	if request.ActiveFrom != nil {
+		from := request.ActiveFrom.UTC()
+		schedule.ActiveFrom = &from
+	}
+	if request.ActiveUntil != nil {
+		until := request.ActiveUntil.UTC()
+		schedule.ActiveUntil = &until
+	}
+	if schedule.ActiveFrom != nil && schedule.ActiveUntil != nil && !schedule.ActiveUntil.After(*schedule.ActiveFrom) {
+		return storage.Schedule{}, http.StatusBadRequest, fmt.Errorf("%w: active_until is not after active_from", ErrInvalidSchedule)
+	}
+	if len(request.Schedule) == 0 {
+		return schedule, http.StatusOK, nil
+	}
+
+	schedule.Changes = make([]storage.ScheduledChange, 0, len(request.Schedule))
+	for _, change := range request.Schedule {
+		url, status, err := checkDestination(ctx, "scheduled", change.URL, requestHost, destinations, checker, safetyChecker)
+		if err != nil {
+			return storage.Schedule{}, status, err
+		}
+		schedule.Changes = append(schedule.Changes, storage.ScheduledChange{At: change.At.UTC(), URL: url})
+	}
+	slices.SortStableFunc(schedule.Changes, func(a, b storage.ScheduledChange) int {
+		return a.At.Compare(b.At)
+	})
+	for i := 1; i < len(schedule.Changes); i++ {
+		if schedule.Changes[i].At.Equal(schedule.Changes[i-1].At) {
+			return storage.Schedule{}, http.StatusBadRequest, fmt.Errorf("%w: two changes at %s", ErrInvalidSchedule, schedule.Changes[i].At.Format(time.RFC3339))
+		}
+	}
+
+	return schedule, http.StatusOK, nil
+}
+
+// checkActive returns the status code and the error for a link outside of
+// its activation window.
+func checkActive(schedule *storage.Schedule, now time.Time) (int, error) {
+	if schedule.ActiveFrom != nil && now.Before(*schedule.ActiveFrom) {
+		return http.StatusNotFound, fmt.Errorf("%w: active from %s", ErrLinkInactive, schedule.ActiveFrom.Format(time.RFC3339))
+	}
+	if schedule.ActiveUntil != nil && !now.Before(*schedule.ActiveUntil) {
+		return http.StatusGone, ErrLinkExpired
+	}
+
+	return http.StatusOK, nil
+}
+
+// withMaxAge limits the time the redirect may be cached to the next change of
+// the schedule. A cache control forbidding to store it is kept as it is.
+func withMaxAge(cacheControl string, schedule *storage.Schedule, now time.Time) string {
+	next := schedule.NextChange(now)
+	if next.IsZero() || cacheControl == "no-store" {
+		return cacheControl
+	}
+	maxAge := "max-age=" + strconv.FormatInt(int64(next.Sub(now)/time.Second), 10)
+
+	return strings.TrimPrefix(cacheControl+", "+maxAge, ", ")
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/useragent"
+)
+
+var ErrEmptyTargetRule = errors.New("target rule matches neither os, device nor country")
+
+// RequestTargetRule sends clients with the operating system, the device type
+// and from the country to the url. At least one of them must be set.
+type RequestTargetRule struct {
+	OS      string `json:"os,omitempty"      validate:"omitempty,oneof=ios android windows macos linux chromeos"`
+	Device  string `json:"device,omitempty"  validate:"omitempty,oneof=mobile tablet desktop"`
+	Country string `json:"country,omitempty" validate:"omitempty,iso3166_1_alpha2"`
+	URL     string `json:"url"               validate:"required,url"`
+}
+
+// checkTargets validates the urls of the targeting rules the same way as the
+// fallback url and returns the rules with normalized urls.
+func checkTargets(
+	ctx context.Context,
+	rules []RequestTargetRule,
+	requestHost string,
+	destinations DestinationValidator,
+	checker URLChecker,
+	safetyChecker SafetyChecker,
+) ([]storage.TargetRule, int, error) {
+	if len(rules) == 0 {
+		return nil, http.StatusOK, nil
+	}
+	targets := make([]storage.TargetRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.OS == "" && rule.Device == "" && rule.Country == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrEmptyTargetRule, rule.URL)
+		}
+		url, status, err := checkDestination(ctx, "target", rule.URL, requestHost, destinations, checker, safetyChecker)
+		if err != nil {
+			return nil, status, err
+		}
+		targets = append(targets, storage.TargetRule{OS: rule.OS, Device: rule.Device, Country: rule.Country, URL: url})
+	}
+
+	return targets, http.StatusOK, nil
+}
+
+// checkDestination normalizes and checks another destination of a link the
+// same way as its url. Kind names the destination in errors.
+func checkDestination(
+	ctx context.Context,
+	kind, rawURL, requestHost string,
+	destinations DestinationValidator,
+	checker URLChecker,
+	safetyChecker SafetyChecker,
+) (string, int, error) {
+	url, err := destinations.Normalize(rawURL)
+	if err != nil {
+		return "", http.StatusBadRequest, fmt.Errorf("normalize %s url: %w", kind, err)
+	}
+	if err := destinations.Check(ctx, url, requestHost); err != nil {
+		return "", http.StatusBadRequest, fmt.Errorf("invalid %s destination: %w", kind, err)
+	}
+	if err := checker.CheckURL(url); err != nil {
+		return "", checkURLStatus(err), fmt.Errorf("check %s url: %w", kind, err)
+	}
+	if err := checkSafety(ctx, safetyChecker, url); err != nil {
+		return "", http.StatusForbidden, fmt.Errorf("check %s url safety: %w", kind, err)
+	}
+
+	return url, http.StatusOK, nil
+}
+
+// matchTarget returns the url of the first rule matching the client. Bots
+// match no rule, so that link previews show the same page to everyone.
+func matchTarget(target *storage.Target, agent useragent.Agent, country string) (string, bool) {
+	if agent.Device == useragent.DeviceBot {
+		return "", false
+	}
+	for _, rule := range target.Targets {
+		if (rule.OS == "" || rule.OS == agent.OS) &&
+			(rule.Device == "" || rule.Device == agent.Device) &&
+			(rule.Country == "" || rule.Country == country) {
+			return rule.URL, true
+		}
+	}
+
+	return "", false
+}
+
+// hasCountryRule tells whether a rule of the target matches by the country.
+func hasCountryRule(target *storage.Target) bool {
+	for _, rule := range target.Targets {
+		if rule.Country != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+
+	"github.com/mrvin/url-shortener/internal/lockout"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type Unlocker interface {
+	Unlock(ctx context.Context, key string) error
+}
+
+type RequestUnlock struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+func NewUnlock(unlocker Unlocker) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestUnlock
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		// Validation
+		if request.Username == "" && request.IP == "" {
+			return ctx, http.StatusBadRequest, errors.New("invalid request: username or ip required")
+		}
+		var keys []string
+		if request.Username != "" {
+			keys = append(keys, lockout.UserKey(request.Username))
+		}
+		if request.IP != "" {
+			addr, err := netip.ParseAddr(request.IP)
+			if err != nil {
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: ip: %w", err)
+			}
+			keys = append(keys, lockout.IPKey(addr.Unmap().String()))
+		}
+
+		for _, key := range keys {
+			if err := unlocker.Unlock(ctx, key); err != nil {
+				return ctx, http.StatusInternalServerError, fmt.Errorf("unlock: %w", err)
+			}
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
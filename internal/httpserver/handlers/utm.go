@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+type UTMDefaultsGetter interface {
+	GetUTMDefaults(ctx context.Context, username string) (*storage.UTM, error)
+}
+
+type UTMDefaultsSetter interface {
+	SetUTMDefaults(ctx context.Context, username string, defaults *storage.UTM) error
+}
+
+type CampaignStatsGetter interface {
+	GetCampaignStats(ctx context.Context, username string, filter *storage.UTM) ([]storage.CampaignStats, error)
+}
+
+// RequestUTM is the campaign parameters of a link in a request.
+//
+//nolint:tagliatelle
+type RequestUTM struct {
+	Source   string `json:"utm_source,omitempty"   validate:"max=100"`
+	Medium   string `json:"utm_medium,omitempty"   validate:"max=100"`
+	Campaign string `json:"utm_campaign,omitempty" validate:"max=100"`
+	Term     string `json:"utm_term,omitempty"     validate:"max=100"`
+	Content  string `json:"utm_content,omitempty"  validate:"max=100"`
+}
+
+type ResponseGetUTMDefaults struct {
+	storage.UTM
+	Status string `json:"status"`
+}
+
+type ResponseGetCampaignStats struct {
+	Links     uint64                  `json:"links"`
+	Clicks    uint64                  `json:"clicks"`
+	Campaigns []storage.CampaignStats `json:"campaigns"`
+	Status    string                  `json:"status"`
+}
+
+func NewGetUTMDefaults(getter UTMDefaultsGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		defaults, err := getter.GetUTMDefaults(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting utm defaults from storage: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetUTMDefaults{
+			UTM:    *defaults,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+func NewSetUTMDefaults(setter UTMDefaultsSetter) HandlerFunc {
+	validate := validator.New()
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestUTM
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		// Validation
+		if err := validate.Struct(request); err != nil {
+			var vErrors validator.ValidationErrors
+			if errors.As(err, &vErrors) {
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s value: %v", vErrors[0].Tag(), vErrors[0].Value())
+			}
+			return ctx, http.StatusInternalServerError, fmt.Errorf("validation: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		defaults := storage.UTM(request)
+		if err := setter.SetUTMDefaults(ctx, username, &defaults); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("saving utm defaults to storage: %w", err)
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// NewGetCampaignStats returns the number of links and clicks of the user in
+// total and by campaign, filtered by the utm_* query parameters.
+func NewGetCampaignStats(getter CampaignStatsGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		campaigns, err := getter.GetCampaignStats(ctx, username, utmFilter(req.URL.Query()))
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting campaign stats from storage: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetCampaignStats{
+			Campaigns: campaigns,
+			Status:    "OK",
+		}
+		for _, campaign := range campaigns {
+			response.Links += campaign.Links
+			response.Clicks += campaign.Clicks
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// withUTMDefaults fills the parameters missing in the request with the
+// defaults of the user.
+func withUTMDefaults(request RequestUTM, defaults *storage.UTM) storage.UTM {
+	utm := storage.UTM(request)
+	fill := func(value *string, def string) {
+		if *value == "" {
+			*value = def
+		}
+	}
+	fill(&utm.Source, defaults.Source)
+	fill(&utm.Medium, defaults.Medium)
+	fill(&utm.Campaign, defaults.Campaign)
+	fill(&utm.Term, defaults.Term)
+	fill(&utm.Content, defaults.Content)
+
+	return utm
+}
+
+func utmFilter(query url.Values) *storage.UTM {
+	return &storage.UTM{
+		Source:   query.Get("utm_source"),
+		Medium:   query.Get("utm_medium"),
+		Campaign: query.Get("utm_campaign"),
+		Term:     query.Get("utm_term"),
+		Content:  query.Get("utm_content"),
+	}
+}
+
+// utmQuery encodes the non-empty campaign parameters as a raw query.
+func utmQuery(utm *storage.UTM) string {
+	query := make(url.Values)
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("utm_source", utm.Source)
+	set("utm_medium", utm.Medium)
+	set("utm_campaign", utm.Campaign)
+	set("utm_term", utm.Term)
+	set("utm_content", utm.Content)
+
+	return query.Encode()
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockUTMDefaultsSetter struct {
+	mock.Mock
+}
+
+func (m *MockUTMDefaultsSetter) SetUTMDefaults(_ context.Context, username string, defaults *storage.UTM) error {
+	args := m.Called(username, *defaults)
+	return args.Error(0)
+}
+
+type MockCampaignStatsGetter struct {
+	mock.Mock
+}
+
+func (m *MockCampaignStatsGetter) GetCampaignStats(_ context.Context, username string, filter *storage.UTM) ([]storage.CampaignStats, error) {
+	args := m.Called(username, *filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.CampaignStats), args.Error(1)
+}
+
+func TestSetUTMDefaults(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		Request                  string
+		Defaults                 storage.UTM
+		StatusCode               int
+		Error                    error
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:                 "Success smoke test",
+			Username:                 "Bob",
+			Request:                  `{"utm_source":"newsletter","utm_medium":"email"}`,
+			Defaults:                 storage.UTM{Source: "newsletter", Medium: "email"},
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error invalid json",
+			Username:                 "Bob",
+			Request:                  `{"utm_source":`,
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "unmarshal body request: unexpected end of JSON input",
+		},
+		{
+			TestName:                 "Error internal",
+			Username:                 "Alice",
+			Request:                  `{"utm_campaign":"spring"}`,
+			Defaults:                 storage.UTM{Campaign: "spring"},
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "saving utm defaults to storage: internal",
+		},
+	}
+
+	mockSetter := new(MockUTMDefaultsSetter)
+	handler := ErrorHandler("Set utm defaults", NewSetUTMDefaults(mockSetter))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/api/users/utm", bytes.NewReader([]byte(test.Request)))
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockSetter.On("SetUTMDefaults", test.Username, test.Defaults).Return(test.Error)
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			var response httpresponse.RequestError
+			json.Unmarshal(res.Body.Bytes(), &response)
+			if response.Status != test.ExpectedStatus {
+				t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+			}
+			if response.Error != test.ExpectedErrorDescription {
+				t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+			}
+		})
+	}
+}
+
+func TestGetCampaignStats(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		Filter                   string
+		ExpectedFilter           storage.UTM
+		Campaigns                []storage.CampaignStats
+		StatusCode               int
+		Error                    error
+		ExpectedLinks            uint64
+		ExpectedClicks           uint64
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:       "Success smoke test",
+			Username:       "Bob",
+			Filter:         "",
+			ExpectedFilter: storage.UTM{},
+			Campaigns: []storage.CampaignStats{
+				{Source: "newsletter", Medium: "email", Campaign: "spring", Links: 2, Clicks: 120},
+				{Source: "", Medium: "", Campaign: "", Links: 5, Clicks: 30},
+			},
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			ExpectedLinks:            7,
+			ExpectedClicks:           150,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:       "Success filter by medium",
+			Username:       "Carol",
+			Filter:         "?utm_medium=email",
+			ExpectedFilter: storage.UTM{Medium: "email"},
+			Campaigns: []storage.CampaignStats{
+				{Source: "newsletter", Medium: "email", Campaign: "spring", Links: 1, Clicks: 12},
+			},
+			StatusCode:               http.StatusOK,
+			Error:                    nil,
+			ExpectedLinks:            1,
+			ExpectedClicks:           12,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Error internal",
+			Username:                 "Alice",
+			Filter:                   "",
+			ExpectedFilter:           storage.UTM{},
+			Campaigns:                nil,
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "getting campaign stats from storage: internal",
+		},
+	}
+
+	mockGetter := new(MockCampaignStatsGetter)
+	handler := ErrorHandler("Get campaign stats", NewGetCampaignStats(mockGetter))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/api/urls/stats"+test.Filter, nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockGetter.On("GetCampaignStats", test.Username, test.ExpectedFilter).Return(test.Campaigns, test.Error)
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if res.Code == http.StatusOK {
+				var response ResponseGetCampaignStats
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if !slices.Equal(response.Campaigns, test.Campaigns) {
+					t.Errorf("expected campaigns %v but received %v", test.Campaigns, response.Campaigns)
+				}
+				if response.Links != test.ExpectedLinks || response.Clicks != test.ExpectedClicks {
+					t.Errorf("expected %d links and %d clicks but received %d and %d",
+						test.ExpectedLinks, test.ExpectedClicks, response.Links, response.Clicks)
+				}
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+// VariantCookie keeps the variant of a sticky link chosen for the client.
+// Its path is the path of the link, so that every link has its own.
+const VariantCookie = "variant"
+
+const variantCookieMaxAge = 30 * 24 * 60 * 60 // in seconds
+
+var ErrDuplicateVariant = errors.New("duplicate variant url")
+
+// RequestVariant is a destination of an A/B split with its weight.
+type RequestVariant struct {
+	URL    string `json:"url"    validate:"required,url"`
+	Weight int    `json:"weight" validate:"min=1,max=1000"`
+}
+
+// checkVariants validates the urls of the variants the same way as the url
+// of the link and returns the variants with normalized urls.
+func checkVariants(
+	ctx context.Context,
+	variants []RequestVariant,
+	requestHost string,
+	destinations DestinationValidator,
+	checker URLChecker,
+	safetyChecker SafetyChecker,
+) ([]storage.Variant, int, error) {
+	if len(variants) == 0 {
+		return nil, http.StatusOK, nil
+	}
+	checked := make([]storage.Variant, 0, len(variants))
+	seen := make(map[string]struct{}, len(variants))
+	for _, variant := range variants {
+		destination, status, err := checkDestination(ctx, "variant", variant.URL, requestHost, destinations, checker, safetyChecker)
+		if err != nil {
+			return nil, status, err
+		}
+		// Clicks are counted by the url of the variant.
+		if _, ok := seen[destination]; ok {
+			return nil, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrDuplicateVariant, destination)
+		}
+		seen[destination] = struct{}{}
+		checked = append(checked, storage.Variant{URL: destination, Weight: variant.Weight, Count: 0})
+	}
+
+	return checked, http.StatusOK, nil
+}
+
+// variantURL chooses the variant of the target for the client: the one kept
+// in the cookie for sticky links, otherwise a random one by the weights.
+// For sticky links the choice is kept in the cookie.
+func variantURL(res http.ResponseWriter, req *http.Request, alias string, target *storage.Target) string {
+	if target.Sticky {
+		if cookie, err := req.Cookie(VariantCookie); err == nil {
+			for _, variant := range target.Variants {
+				if variantKey(variant.URL) == cookie.Value {
+					return variant.URL
+				}
+			}
+		}
+	}
+
+	total := 0
+	for _, variant := range target.Variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return target.URL
+	}
+	chosen := chooseVariant(target.Variants, rand.IntN(total)) //nolint:gosec
+
+	if target.Sticky {
+		http.SetCookie(res, &http.Cookie{
+			Name:     VariantCookie,
+			Value:    variantKey(chosen),
+			Path:     "/" + url.PathEscape(alias),
+			MaxAge:   variantCookieMaxAge,
+			HttpOnly: true,
+			Secure:   req.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return chosen
+}
+
+// chooseVariant returns the url of the variant the point n of the range from
+// zero to the sum of the weights falls on.
+func chooseVariant(variants []storage.Variant, n int) string {
+	for _, variant := range variants {
+		if n < variant.Weight {
+			return variant.URL
+		}
+		n -= variant.Weight
+	}
+
+	return variants[len(variants)-1].URL
+}
+
+// variantKey identifies the variant in the cookie without revealing the url,
+// it stays the same when other variants are added or removed.
+func variantKey(url string) string {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
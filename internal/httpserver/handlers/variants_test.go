@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+func TestChooseVariant(t *testing.T) {
+	variants := []storage.Variant{
+		{URL: "https://example.com/a", Weight: 70},
+		{URL: "https://example.com/b", Weight: 30},
+	}
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{0, "https://example.com/a"},
+		{69, "https://example.com/a"},
+		{70, "https://example.com/b"},
+		{99, "https://example.com/b"},
+	}
+	for _, test := range tests {
+		if url := chooseVariant(variants, test.n); url != test.expected {
+			t.Errorf("%d: expected %q but received %q", test.n, test.expected, url)
+		}
+	}
+}
+
+func TestVariantKey(t *testing.T) {
+	a := variantKey("https://example.com/a")
+	if a != variantKey("https://example.com/a") {
+		t.Error("expected the same key for the same url")
+	}
+	if a == variantKey("https://example.com/b") {
+		t.Error("expected different keys for different urls")
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+//nolint:gochecknoglobals
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex, nofollow">
+    <title>Небезопасная ссылка - URL Shortener</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.1.3/dist/css/bootstrap.min.css" rel="stylesheet">
+</head>
+<body>
+    <div class="container mt-5">
+        <div class="row justify-content-center">
+            <div class="col-md-8">
+                <div class="alert alert-danger">
+                    <h3 class="alert-heading">Ссылка отключена как небезопасная</h3>
+                    <p>Сайт, на который ведет эта короткая ссылка, помечен как опасный ({{.Threat}}).
+                    Он может украсть ваши данные или установить вредоносное ПО.</p>
+                    <hr>
+                    <p class="mb-0 text-break">Адрес назначения: <code>{{.URL}}</code></p>
+                </div>
+                <a href="/" class="btn btn-primary">Вернуться в безопасное место</a>
+            </div>
+        </div>
+    </div>
+</body>
+</html>
+`))
+
+type warning struct {
+	URL    string
+	Threat string
+}
+
+// writeWarning shows the warning page instead of redirecting to an unsafe url.
+func writeWarning(res http.ResponseWriter, url, threat string) error {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusForbidden)
+	if err := warningPage.Execute(res, warning{URL: url, Threat: threat}); err != nil {
+		return fmt.Errorf("write warning page: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/webhook"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+const maxWebhooks = 10
+
+var ErrTooManyWebhooks = fmt.Errorf("too many webhooks, at most %d", maxWebhooks)
+
+// EventPublisher queues the events of links for the webhooks of their owners.
+type EventPublisher interface {
+	Publish(ctx context.Context, event string, link *webhook.Link) error
+}
+
+type WebhookCreator interface {
+	CreateWebhook(ctx context.Context, webhook *storage.Webhook) (int64, error)
+	WebhooksGetter
+}
+
+type WebhooksGetter interface {
+	GetWebhooks(ctx context.Context, username string) ([]storage.Webhook, error)
+}
+
+type WebhookDeleter interface {
+	DeleteWebhook(ctx context.Context, username string, id int64) error
+}
+
+type DeliveriesGetter interface {
+	GetWebhook(ctx context.Context, username string, id int64) (*storage.Webhook, error)
+	GetDeliveries(ctx context.Context, username string, webhookID int64, limit, offset uint64) ([]storage.Delivery, error)
+}
+
+type Redeliverer interface {
+	Redeliver(ctx context.Context, username string, webhookID, id int64) error
+}
+
+type RequestCreateWebhook struct {
+	URL    string   `json:"url"    validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,max=7,unique,dive,oneof=link.created link.updated link.deleted link.expired link.clicks link.broken link.recovered"`
+}
+
+// ResponseCreateWebhook holds the secret signing the payloads, it is not
+// shown again.
+type ResponseCreateWebhook struct {
+	ID     int64  `json:"id"`
+	Secret string `json:"secret"`
+	Status string `json:"status"`
+}
+
+type ResponseGetWebhooks struct {
+	Webhooks []storage.Webhook `json:"webhooks"`
+	Status   string            `json:"status"`
+}
+
+type ResponseGetDeliveries struct {
+	Deliveries []storage.Delivery `json:"deliveries"`
+	Status     string             `json:"status"`
+}
+
+func NewCreateWebhook(creator WebhookCreator) HandlerFunc {
+	validate := validator.New()
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		// Read json request
+		var request RequestCreateWebhook
+		body, err := io.ReadAll(req.Body)
+		defer req.Body.Close()
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("read body request: %w", err)
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("unmarshal body request: %w", err)
+		}
+
+		// Validation
+		if err := validate.Struct(request); err != nil {
+			var vErrors validator.ValidationErrors
+			if errors.As(err, &vErrors) {
+				return ctx, http.StatusBadRequest, fmt.Errorf("invalid request: tag: %s value: %v", vErrors[0].Tag(), vErrors[0].Value())
+			}
+			return ctx, http.StatusInternalServerError, fmt.Errorf("validation: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		webhooks, err := creator.GetWebhooks(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting webhooks from storage: %w", err)
+		}
+		if len(webhooks) >= maxWebhooks {
+			return ctx, http.StatusConflict, ErrTooManyWebhooks
+		}
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("new secret: %w", err)
+		}
+		hook := storage.Webhook{
+			Username: username,
+			URL:      request.URL,
+			Secret:   secret,
+			Events:   request.Events,
+		}
+		id, err := creator.CreateWebhook(ctx, &hook)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("saving webhook to storage: %w", err)
+		}
+
+		// Write json response
+		response := ResponseCreateWebhook{
+			ID:     id,
+			Secret: secret,
+			Status: "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.WriteHeader(http.StatusCreated)
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusCreated, nil
+	}
+}
+
+func NewGetWebhooks(getter WebhooksGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		webhooks, err := getter.GetWebhooks(ctx, username)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting webhooks from storage: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetWebhooks{
+			Webhooks: webhooks,
+			Status:   "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+func NewDeleteWebhook(deleter WebhookDeleter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect id value: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		if err := deleter.DeleteWebhook(ctx, username, id); err != nil {
+			err = fmt.Errorf("deleting webhook from storage: %w", err)
+			if errors.Is(err, storage.ErrWebhookNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		httpresponse.WriteOK(res, http.StatusOK)
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// NewGetDeliveries returns the log of the deliveries of the webhook, the
+// newest first.
+func NewGetDeliveries(getter DeliveriesGetter) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect id value: %w", err)
+		}
+		limit := uint64(defaultLimit)
+		if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+			limit, err = strconv.ParseUint(limitStr, 10, 64)
+			if err != nil {
+				return ctx, http.StatusBadRequest, fmt.Errorf("incorrect limit value: %w", err)
+			}
+		}
+		offset := uint64(defaultOffset)
+		if offsetStr := req.URL.Query().Get("offset"); offsetStr != "" {
+			offset, err = strconv.ParseUint(offsetStr, 10, 64)
+			if err != nil {
+				return ctx, http.StatusBadRequest, fmt.Errorf("incorrect offset value: %w", err)
+			}
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		if _, err := getter.GetWebhook(ctx, username, id); err != nil {
+			err = fmt.Errorf("getting webhook from storage: %w", err)
+			if errors.Is(err, storage.ErrWebhookNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+		deliveries, err := getter.GetDeliveries(ctx, username, id, limit, offset)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("getting deliveries from storage: %w", err)
+		}
+
+		// Write json response
+		response := ResponseGetDeliveries{
+			Deliveries: deliveries,
+			Status:     "OK",
+		}
+
+		jsonResponse, err := json.Marshal(&response)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("marshal response: %w", err)
+		}
+
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if _, err := res.Write(jsonResponse); err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("write response: %w", err)
+		}
+
+		return ctx, http.StatusOK, nil
+	}
+}
+
+// NewRedeliver queues the delivery to be sent again with the next batch.
+func NewRedeliver(redeliverer Redeliverer) HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) (context.Context, int, error) {
+		ctx := req.Context()
+
+		webhookID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect id value: %w", err)
+		}
+		id, err := strconv.ParseInt(req.PathValue("delivery"), 10, 64)
+		if err != nil {
+			return ctx, http.StatusBadRequest, fmt.Errorf("incorrect delivery value: %w", err)
+		}
+
+		username, err := logger.GetUsernameFromCtx(ctx)
+		if err != nil {
+			return ctx, http.StatusInternalServerError, fmt.Errorf("get user name from ctx: %w", err)
+		}
+
+		if err := redeliverer.Redeliver(ctx, username, webhookID, id); err != nil {
+			err = fmt.Errorf("redeliver: %w", err)
+			if errors.Is(err, storage.ErrDeliveryNotFound) {
+				return ctx, http.StatusNotFound, err
+			}
+			return ctx, http.StatusInternalServerError, err
+		}
+
+		httpresponse.WriteOK(res, http.StatusAccepted)
+
+		return ctx, http.StatusAccepted, nil
+	}
+}
+
+// publish queues the event of the link, a failure is logged and does not
+// fail the request.
+func publish(ctx context.Context, publisher EventPublisher, event string, link *webhook.Link) {
+	if err := publisher.Publish(ctx, event, link); err != nil {
+		slog.WarnContext(ctx, "Publish event", slog.String("event", event), slog.String("warn", err.Error()))
+	}
+}
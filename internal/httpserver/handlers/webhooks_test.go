@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/webhook"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEventPublisher struct {
+	mock.Mock
+}
+
+func (m *MockEventPublisher) Publish(_ context.Context, event string, link *webhook.Link) error {
+	args := m.Called(event, link.Alias)
+	return args.Error(0)
+}
+
+func newMockEventPublisher() *MockEventPublisher {
+	mockPublisher := new(MockEventPublisher)
+	mockPublisher.On("Publish", mock.Anything, mock.Anything).Return(nil)
+	return mockPublisher
+}
+
+type MockWebhookCreator struct {
+	mock.Mock
+}
+
+func (m *MockWebhookCreator) CreateWebhook(_ context.Context, webhook *storage.Webhook) (int64, error) {
+	args := m.Called(webhook.Username, webhook.URL)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockWebhookCreator) GetWebhooks(_ context.Context, username string) ([]storage.Webhook, error) {
+	args := m.Called(username)
+	return args.Get(0).([]storage.Webhook), args.Error(1)
+}
+
+type MockRedeliverer struct {
+	mock.Mock
+}
+
+func (m *MockRedeliverer) Redeliver(_ context.Context, username string, webhookID, id int64) error {
+	args := m.Called(username, webhookID, id)
+	return args.Error(0)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		URL                      string
+		Events                   []string
+		StatusCode               int
+		Error                    error
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:                 "Normal",
+			Username:                 "Alice",
+			URL:                      "https://hooks.example.com/links",
+			Events:                   []string{webhook.EventCreated, webhook.EventClicks},
+			StatusCode:               http.StatusCreated,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Unknown event",
+			Username:                 "Alice",
+			URL:                      "https://hooks.example.com/links",
+			Events:                   []string{"link.viewed"},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: oneof value: link.viewed",
+		},
+		{
+			TestName:                 "Repeated event",
+			Username:                 "Alice",
+			URL:                      "https://hooks.example.com/links",
+			Events:                   []string{webhook.EventCreated, webhook.EventCreated},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: unique value: [link.created link.created]",
+		},
+		{
+			TestName:                 "Invalid url",
+			Username:                 "Alice",
+			URL:                      "ftp://hooks.example.com",
+			Events:                   []string{webhook.EventCreated},
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "invalid request: tag: http_url value: ftp://hooks.example.com",
+		},
+		{
+			TestName:                 "Too many webhooks",
+			Username:                 "Bob",
+			URL:                      "https://hooks.example.com/links",
+			Events:                   []string{webhook.EventCreated},
+			StatusCode:               http.StatusConflict,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: ErrTooManyWebhooks.Error(),
+		},
+		{
+			TestName:                 "Error internal",
+			Username:                 "Carol",
+			URL:                      "https://hooks.example.com/links",
+			Events:                   []string{webhook.EventDeleted},
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "saving webhook to storage: internal",
+		},
+	}
+
+	mockCreator := new(MockWebhookCreator)
+	mockCreator.On("GetWebhooks", "Bob").Return(make([]storage.Webhook, maxWebhooks), nil)
+	mockCreator.On("GetWebhooks", mock.Anything).Return([]storage.Webhook{}, nil)
+	handler := ErrorHandler("Create webhook", NewCreateWebhook(mockCreator))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			dataRequest, err := json.Marshal(RequestCreateWebhook{URL: test.URL, Events: test.Events})
+			if err != nil {
+				t.Fatalf("cant marshal json: %v", err)
+			}
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/webhooks", bytes.NewReader(dataRequest))
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockCreator.On("CreateWebhook", test.Username, test.URL).Return(int64(1), test.Error)
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if test.StatusCode == http.StatusCreated {
+				var response ResponseCreateWebhook
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				if response.ID != 1 {
+					t.Errorf("expected id 1 but received %d", response.ID)
+				}
+				if len(response.Secret) != 64 {
+					t.Errorf(`expected secret of 64 characters but received "%s"`, response.Secret)
+				}
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	tests := []struct {
+		TestName                 string
+		Username                 string
+		Path                     string
+		StatusCode               int
+		Error                    error
+		ExpectedStatus           string
+		ExpectedErrorDescription string
+	}{
+		{
+			TestName:                 "Normal",
+			Username:                 "Alice",
+			Path:                     "/api/webhooks/1/deliveries/10/redeliver",
+			StatusCode:               http.StatusAccepted,
+			Error:                    nil,
+			ExpectedStatus:           "OK",
+			ExpectedErrorDescription: "",
+		},
+		{
+			TestName:                 "Delivery not found",
+			Username:                 "Bob",
+			Path:                     "/api/webhooks/1/deliveries/10/redeliver",
+			StatusCode:               http.StatusNotFound,
+			Error:                    storage.ErrDeliveryNotFound,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "redeliver: delivery not found",
+		},
+		{
+			TestName:                 "Incorrect delivery",
+			Username:                 "Alice",
+			Path:                     "/api/webhooks/1/deliveries/last/redeliver",
+			StatusCode:               http.StatusBadRequest,
+			Error:                    nil,
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: `incorrect delivery value: strconv.ParseInt: parsing "last": invalid syntax`,
+		},
+		{
+			TestName:                 "Error internal",
+			Username:                 "Carol",
+			Path:                     "/api/webhooks/1/deliveries/10/redeliver",
+			StatusCode:               http.StatusInternalServerError,
+			Error:                    errors.New("internal"),
+			ExpectedStatus:           "Error",
+			ExpectedErrorDescription: "redeliver: internal",
+		},
+	}
+
+	mockRedeliverer := new(MockRedeliverer)
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodPost+" /api/webhooks/{id}/deliveries/{delivery}/redeliver", ErrorHandler("Redeliver", NewRedeliver(mockRedeliverer)))
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			t.Parallel()
+
+			res := httptest.NewRecorder()
+			ctx := log.WithUsername(context.Background(), test.Username)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, test.Path, nil)
+			if err != nil {
+				t.Fatalf("cant create new request: %v", err)
+			}
+
+			mockRedeliverer.On("Redeliver", test.Username, int64(1), int64(10)).Return(test.Error)
+
+			mux.ServeHTTP(res, req)
+
+			if res.Code != test.StatusCode {
+				t.Errorf("expected status code %d but received %d", test.StatusCode, res.Code)
+			}
+			if test.StatusCode == http.StatusAccepted {
+				var response httpresponse.RequestOK
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+			} else {
+				var response httpresponse.RequestError
+				json.Unmarshal(res.Body.Bytes(), &response)
+				if response.Status != test.ExpectedStatus {
+					t.Errorf(`expected status "%s" but received "%s"`, test.ExpectedStatus, response.Status)
+				}
+				if response.Error != test.ExpectedErrorDescription {
+					t.Errorf(`expected description "%s" but received "%s"`, test.ExpectedErrorDescription, response.Error)
+				}
+			}
+		})
+	}
+}
@@ -6,34 +6,65 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
+	"net/netip"
+	"strings"
 	"time"
 
+	"github.com/mrvin/url-shortener/internal/aliases"
 	"github.com/mrvin/url-shortener/internal/cache"
+	"github.com/mrvin/url-shortener/internal/credcache"
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/geoip"
+	"github.com/mrvin/url-shortener/internal/hostpolicy"
 	"github.com/mrvin/url-shortener/internal/httpserver/handlers"
-	log "github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/internal/lockout"
+	"github.com/mrvin/url-shortener/internal/metadata"
+	"github.com/mrvin/url-shortener/internal/metrics"
+	"github.com/mrvin/url-shortener/internal/oidc"
+	"github.com/mrvin/url-shortener/internal/qr"
+	"github.com/mrvin/url-shortener/internal/ratelimit"
+	"github.com/mrvin/url-shortener/internal/reserved"
+	"github.com/mrvin/url-shortener/internal/safety"
+	"github.com/mrvin/url-shortener/internal/session"
 	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/internal/webhook"
 	"github.com/mrvin/url-shortener/pkg/http/logger"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const readTimeout = 5   // in second
 const writeTimeout = 10 // in second
 const idleTimeout = 1   // in minute
 
+// untracedPaths are polled by health checks and scrapers, their spans would
+// only be noise.
+//
+//nolint:gochecknoglobals
+var untracedPaths = map[string]bool{
+	"/api/health": true,
+	"/metrics":    true,
+}
+
 type ConfTLS struct {
 	CertFile string
 	KeyFile  string
 }
 
 type Conf struct {
-	Host        string
-	Port        string
-	IsTLS       bool
-	TLS         ConfTLS
-	DocFilePath string
+	Host           string
+	Port           string
+	IsTLS          bool
+	TLS            ConfTLS
+	DocFilePath    string
+	TrustedProxies []netip.Prefix
+	// Status code of redirects of links without their own redirect type.
+	RedirectType int
+	// Base url of short links like "https://sho.rt", the scheme and the
+	// host of the request if empty.
+	PublicURL string
 }
 
 type Server struct {
@@ -42,8 +73,38 @@ type Server struct {
 	conf *Conf
 }
 
-func New(conf *Conf, st storage.Storage, c cache.Cacher) *Server {
+func New(
+	conf *Conf,
+	st storage.Storage,
+	c cache.Cacher,
+	sessions *session.Manager,
+	credentials *credcache.Cache,
+	provider *oidc.Provider,
+	guard *lockout.Guard,
+	limiter *ratelimit.Limiter,
+	rules *aliases.Rules,
+	filter *reserved.Filter,
+	destinations *destination.Validator,
+	policy *hostpolicy.Policy,
+	safetyChecker safety.Checker,
+	scanner *safety.Scanner,
+	generator *qr.Generator,
+	collector *metadata.Collector,
+	locator *geoip.DB,
+	dispatcher *webhook.Dispatcher,
+	m *metrics.Metrics,
+) *Server {
 	mux := http.NewServeMux()
+	a := authenticator{users: st, sessions: sessions, credentials: credentials, guard: guard}
+	// public limits the route group per client address.
+	public := func(group string, next http.HandlerFunc) http.HandlerFunc {
+		return limiter.ByIP(group, next)
+	}
+	// private limits the route group per client address before
+	// authentication and per user after it.
+	private := func(group string, next http.HandlerFunc) http.HandlerFunc {
+		return limiter.ByIP(group, a.auth(limiter.ByUser(group, next)))
+	}
 
 	// docs
 	mux.HandleFunc(http.MethodGet+" /api/openapi.yaml", handlers.NewAPIDocs(conf.DocFilePath))
@@ -51,25 +112,67 @@ func New(conf *Conf, st storage.Storage, c cache.Cacher) *Server {
 	// info
 	mux.HandleFunc(http.MethodGet+" /api/health", handlers.Health)
 	mux.HandleFunc(http.MethodGet+" /api/info", handlers.ErrorHandler("Info", handlers.Info))
+	mux.HandleFunc(http.MethodGet+" /api/config", handlers.ErrorHandler("Config", handlers.NewConfig(provider != nil)))
+	if m.Enabled() {
+		mux.HandleFunc(http.MethodGet+" /metrics", m.Handler())
+	}
 
 	// users
-	mux.HandleFunc(http.MethodPost+" /api/users", handlers.ErrorHandler("Registration user", handlers.NewRegistration(st)))
-	mux.HandleFunc(http.MethodPost+" /api/users/login", handlers.ErrorHandler("Login user", handlers.NewLogin(st)))
+	mux.HandleFunc(http.MethodPost+" /api/users", public(ratelimit.GroupAuth, handlers.ErrorHandler("Registration user", handlers.NewRegistration(st))))
+	mux.HandleFunc(http.MethodPost+" /api/users/login", public(ratelimit.GroupAuth, handlers.ErrorHandler("Login user", handlers.NewLogin(st, sessions, guard))))
+	mux.HandleFunc(http.MethodPost+" /api/users/refresh", private(ratelimit.GroupAPI, handlers.ErrorHandler("Refresh session", handlers.NewRefresh(st, sessions))))
+	mux.HandleFunc(http.MethodPut+" /api/users/password", private(ratelimit.GroupAPI, handlers.ErrorHandler("Change password", handlers.NewChangePassword(st, credentials, sessions))))
+	mux.HandleFunc(http.MethodPost+" /api/users/logout", private(ratelimit.GroupAPI, handlers.ErrorHandler("Logout user", handlers.NewLogout(sessions))))
+	mux.HandleFunc(http.MethodGet+" /api/users/utm", private(ratelimit.GroupAPI, handlers.ErrorHandler("Get utm defaults", handlers.NewGetUTMDefaults(st))))
+	mux.HandleFunc(http.MethodPut+" /api/users/utm", private(ratelimit.GroupAPI, handlers.ErrorHandler("Set utm defaults", handlers.NewSetUTMDefaults(st))))
+	if provider != nil {
+		mux.HandleFunc(http.MethodGet+" /api/users/oidc/login", public(ratelimit.GroupAuth, handlers.ErrorHandler("OIDC login", handlers.NewOIDCLogin(provider))))
+		mux.HandleFunc(http.MethodGet+" /api/users/oidc/callback", public(ratelimit.GroupAuth, handlers.ErrorHandler("OIDC callback", handlers.NewOIDCCallback(provider, st, sessions))))
+	}
 
-	// urls
-	mux.HandleFunc(http.MethodPost+" /api/urls", auth(handlers.ErrorHandler("Save url", handlers.NewSaveURL(st)), st))
-	mux.HandleFunc(http.MethodGet+" /api/urls", auth(handlers.ErrorHandler("Get urls", handlers.NewGetURLs(st)), st))
-	mux.HandleFunc(http.MethodGet+" /api/urls/check/{alias...}", handlers.ErrorHandler("Check alias", handlers.NewCheckAlias(st)))
-	mux.HandleFunc(http.MethodDelete+" /api/urls/{alias...}", auth(handlers.ErrorHandler("Delete url", handlers.NewDeleteURL(st, c)), st))
-	mux.HandleFunc(http.MethodGet+" /{alias...}", handlers.ErrorHandler("Redirect", handlers.NewRedirect(st, c)))
+	// admin
+	admin := func(next http.HandlerFunc) http.HandlerFunc {
+		return limiter.ByIP(ratelimit.GroupAPI, a.admin(limiter.ByUser(ratelimit.GroupAPI, next)))
+	}
+	mux.HandleFunc(http.MethodPost+" /api/admin/unlock", admin(handlers.ErrorHandler("Unlock", handlers.NewUnlock(guard))))
+	mux.HandleFunc(http.MethodPost+" /api/admin/urls/flag", admin(handlers.ErrorHandler("Flag url", handlers.NewFlagURL(scanner))))
+	mux.HandleFunc(http.MethodGet+" /api/admin/hosts", admin(handlers.ErrorHandler("Get host rules", handlers.NewGetHostRules(policy))))
+	mux.HandleFunc(http.MethodPost+" /api/admin/hosts", admin(handlers.ErrorHandler("Create host rule", handlers.NewCreateHostRule(policy))))
+	mux.HandleFunc(http.MethodDelete+" /api/admin/hosts/{id}", admin(handlers.ErrorHandler("Delete host rule", handlers.NewDeleteHostRule(policy))))
+	mux.HandleFunc(http.MethodGet+" /api/admin/aliases/terms", admin(handlers.ErrorHandler("Get alias terms", handlers.NewGetAliasTerms(filter))))
+	mux.HandleFunc(http.MethodPost+" /api/admin/aliases/terms", admin(handlers.ErrorHandler("Create alias term", handlers.NewCreateAliasTerm(filter))))
+	mux.HandleFunc(http.MethodDelete+" /api/admin/aliases/terms/{id}", admin(handlers.ErrorHandler("Delete alias term", handlers.NewDeleteAliasTerm(filter))))
 
-	loggerServer := logger.Logger{Inner: mux}
+	// urls
+	mux.HandleFunc(http.MethodPost+" /api/urls", private(ratelimit.GroupCreate, handlers.ErrorHandler("Save url", handlers.NewSaveURL(st, rules, filter, destinations, policy, safetyChecker, collector, dispatcher))))
+	mux.HandleFunc(http.MethodGet+" /api/urls", private(ratelimit.GroupAPI, handlers.ErrorHandler("Get urls", handlers.NewGetURLs(st))))
+	mux.HandleFunc(http.MethodGet+" /api/urls/stats", private(ratelimit.GroupAPI, handlers.ErrorHandler("Get campaign stats", handlers.NewGetCampaignStats(st))))
+	mux.HandleFunc(http.MethodGet+" /api/urls/check/{alias...}", public(ratelimit.GroupCheck, handlers.ErrorHandler("Check alias", handlers.NewCheckAlias(st, rules, filter))))
+	mux.HandleFunc(http.MethodPut+" /api/urls/{alias...}", private(ratelimit.GroupAPI, handlers.ErrorHandler("Edit url", handlers.NewEditURL(st, c, rules, destinations, policy, safetyChecker, collector, dispatcher))))
+	mux.HandleFunc(http.MethodPost+" /api/urls/metadata/{alias...}", private(ratelimit.GroupAPI, handlers.ErrorHandler("Refresh metadata", handlers.NewRefreshMetadata(st, rules, collector))))
+	mux.HandleFunc(http.MethodDelete+" /api/urls/{alias...}", private(ratelimit.GroupAPI, handlers.ErrorHandler("Delete url", handlers.NewDeleteURL(st, c, rules, dispatcher))))
+	mux.HandleFunc(http.MethodGet+" /api/urls/qr/{alias...}", public(ratelimit.GroupCheck, handlers.ErrorHandler("QR code", handlers.NewQR(st, rules, generator, conf.PublicURL))))
+	mux.HandleFunc(http.MethodGet+" /api/urls/preview/{alias...}", public(ratelimit.GroupRedirect, handlers.ErrorHandler("Preview", handlers.NewPreview(st, rules, policy))))
+	mux.HandleFunc(http.MethodGet+" /{alias...}", public(ratelimit.GroupRedirect, handlers.WithPreview(
+		handlers.ErrorHandler("Preview page", handlers.NewPreviewPage(st, rules, policy)),
+		handlers.ErrorHandler("Redirect", handlers.NewRedirect(st, c, rules, policy, locator, m, conf.RedirectType)),
+	)))
+
+	// webhooks
+	mux.HandleFunc(http.MethodGet+" /api/webhooks", private(ratelimit.GroupAPI, handlers.ErrorHandler("Get webhooks", handlers.NewGetWebhooks(st))))
+	mux.HandleFunc(http.MethodPost+" /api/webhooks", private(ratelimit.GroupAPI, handlers.ErrorHandler("Create webhook", handlers.NewCreateWebhook(st))))
+	mux.HandleFunc(http.MethodDelete+" /api/webhooks/{id}", private(ratelimit.GroupAPI, handlers.ErrorHandler("Delete webhook", handlers.NewDeleteWebhook(st))))
+	mux.HandleFunc(http.MethodGet+" /api/webhooks/{id}/deliveries", private(ratelimit.GroupAPI, handlers.ErrorHandler("Get deliveries", handlers.NewGetDeliveries(st))))
+	mux.HandleFunc(http.MethodPost+" /api/webhooks/{id}/deliveries/{delivery}/redeliver", private(ratelimit.GroupAPI, handlers.ErrorHandler("Redeliver", handlers.NewRedeliver(st))))
+
+	loggerServer := logger.Logger{Inner: m.Middleware(routeSpan(mux))}
+	handler := realip.New(conf.TrustedProxies).Middleware(withTracing(&loggerServer))
 
 	return &Server{
 		//nolint:exhaustruct
 		http.Server{
 			Addr:         net.JoinHostPort(conf.Host, conf.Port),
-			Handler:      &loggerServer,
+			Handler:      handler,
 			ReadTimeout:  readTimeout * time.Second,
 			WriteTimeout: writeTimeout * time.Second,
 			IdleTimeout:  idleTimeout * time.Minute,
@@ -78,13 +181,39 @@ func New(conf *Conf, st storage.Storage, c cache.Cacher) *Server {
 	}
 }
 
-func (s *Server) Run(ctx context.Context) {
-	ctx, cancel := signal.NotifyContext(
-		ctx,
-		os.Interrupt,    // SIGINT, (Control-C)
-		syscall.SIGTERM, // systemd
-		syscall.SIGQUIT,
+// withTracing starts a span for the request, continuing the trace of the
+// W3C trace context of the request if any.
+func withTracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			if req.Pattern != "" {
+				return req.Pattern
+			}
+			return req.Method
+		}),
+		otelhttp.WithFilter(func(req *http.Request) bool { return !untracedPaths[req.URL.Path] }),
 	)
+}
+
+// routeSpan names the span of the request after the pattern of the route,
+// which is known only once the mux has matched it.
+func routeSpan(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mux.ServeHTTP(res, req)
+		if req.Pattern == "" {
+			return
+		}
+		span := trace.SpanFromContext(req.Context())
+		span.SetName(req.Pattern)
+		if _, route, found := strings.Cut(req.Pattern, " "); found {
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+	})
+}
+
+// Run serves requests until the context is canceled or the server fails.
+func (s *Server) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
 
 	go func() {
 		defer cancel()
@@ -114,33 +243,3 @@ func (s *Server) Run(ctx context.Context) {
 	}
 	slog.Info("Stop http server")
 }
-
-type UserGetter interface {
-	GetUser(ctx context.Context, name string) (*storage.User, error)
-}
-
-func auth(next http.HandlerFunc, getter UserGetter) http.HandlerFunc {
-	handler := func(res http.ResponseWriter, req *http.Request) {
-		username, password, ok := req.BasicAuth()
-		if !ok {
-			http.Error(res, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		ctx := req.Context()
-		user, err := getter.GetUser(ctx, username)
-		if err != nil {
-			http.Error(res, "Unauthorized", http.StatusInternalServerError)
-			return
-		}
-		if err := bcrypt.CompareHashAndPassword([]byte(user.HashPassword), []byte(password)); err != nil {
-			http.Error(res, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		ctx = log.WithUsername(ctx, username)
-
-		next(res, req.WithContext(ctx)) // Pass request to next handler
-	}
-
-	return http.HandlerFunc(handler)
-}
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrvin/url-shortener/pkg/http/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceID trace.TraceID
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /{alias...}", func(_ http.ResponseWriter, req *http.Request) {
+		traceID = trace.SpanContextFromContext(req.Context()).TraceID()
+	})
+	mux.HandleFunc(http.MethodGet+" /api/health", func(http.ResponseWriter, *http.Request) {})
+	// The logger passes a copy of the request on, as in New.
+	handler := withTracing(&logger.Logger{Inner: routeSpan(mux)})
+
+	tests := []struct {
+		path         string
+		traceparent  string
+		expectedName string
+		expectedSpan bool
+	}{
+		{"/zn9edcu", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "GET /{alias...}", true},
+		{"/zn9edcu", "", "GET /{alias...}", true},
+		{"/api/health", "", "", false},
+	}
+	for _, test := range tests {
+		recorder.Reset()
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.traceparent != "" {
+			req.Header.Set("traceparent", test.traceparent)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		if !test.expectedSpan {
+			if len(spans) != 0 {
+				t.Errorf("%s: expected no spans but received %d", test.path, len(spans))
+			}
+			continue
+		}
+		if len(spans) != 1 {
+			t.Fatalf("%s: expected 1 span but received %d", test.path, len(spans))
+		}
+		span := spans[0]
+		if span.Name() != test.expectedName {
+			t.Errorf("%s: expected span name %q but received %q", test.path, test.expectedName, span.Name())
+		}
+		if span.SpanContext().TraceID() != traceID {
+			t.Errorf("%s: expected trace id %s in the handler but received %s", test.path, span.SpanContext().TraceID(), traceID)
+		}
+		if test.traceparent != "" && span.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: expected the trace of the caller but received %s", test.path, span.Parent().TraceID())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultMaxFailures = 5
+	defaultWindow      = 15 * time.Minute
+	defaultBase        = time.Minute
+	defaultMax         = time.Hour
+	// How long the lockout level is remembered after the last lockout.
+	levelTTL = 24 * time.Hour
+)
+
+type Conf struct {
+	MaxFailures int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// "redis" or "memory".
+	Store string
+}
+
+// Store keeps failure counters. Every method must be atomic
+// so that several instances can share one store.
+type Store interface {
+	// IncrFailures increments the failure counter, which is reset
+	// once the window passes since the first failure.
+	IncrFailures(ctx context.Context, key string, window time.Duration) (int64, error)
+	// IncrLevel increments the number of lockouts in a row.
+	IncrLevel(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Lock locks the key for the duration and resets the failure counter.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns the remaining lockout time or zero.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// ResetFailures resets the failure counter.
+	ResetFailures(ctx context.Context, key string) error
+	// Unlock removes the lockout, the failure counter and the level.
+	Unlock(ctx context.Context, key string) error
+}
+
+// Guard locks usernames and client addresses out after too many failed
+// login attempts. Every next lockout in a row is twice as long as the
+// previous one, up to MaxLockout.
+type Guard struct {
+	conf  Conf
+	store Store
+}
+
+func New(conf *Conf, store Store) *Guard {
+	c := *conf
+	if c.MaxFailures <= 0 {
+		c.MaxFailures = defaultMaxFailures
+	}
+	if c.Window <= 0 {
+		c.Window = defaultWindow
+	}
+	if c.BaseLockout <= 0 {
+		c.BaseLockout = defaultBase
+	}
+	if c.MaxLockout < c.BaseLockout {
+		c.MaxLockout = max(defaultMax, c.BaseLockout)
+	}
+
+	return &Guard{conf: c, store: store}
+}
+
+func UserKey(username string) string {
+	return "user:" + username
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns the longest remaining lockout of the keys.
+func (g *Guard) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		d, err := g.store.LockedFor(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("check lockout %s: %w", key, err)
+		}
+		retryAfter = max(retryAfter, d)
+	}
+
+	return retryAfter, nil
+}
+
+// Fail counts a failed attempt for every key and locks the keys that
+// reached the limit. It returns the longest lockout started by this call.
+func (g *Guard) Fail(ctx context.Context, keys ...string) (time.Duration, error) {
+	var lockedFor time.Duration
+	for _, key := range keys {
+		failures, err := g.store.IncrFailures(ctx, key, g.conf.Window)
+		if err != nil {
+			return 0, fmt.Errorf("count failure %s: %w", key, err)
+		}
+		// Only the attempt that reaches the limit locks, so concurrent
+		// failures do not raise the level more than once.
+		if failures != int64(g.conf.MaxFailures) {
+			continue
+		}
+		level, err := g.store.IncrLevel(ctx, key, levelTTL)
+		if err != nil {
+			return 0, fmt.Errorf("increment lockout level %s: %w", key, err)
+		}
+		d := g.duration(level)
+		if err := g.store.Lock(ctx, key, d); err != nil {
+			return 0, fmt.Errorf("lock %s: %w", key, err)
+		}
+		slog.WarnContext(ctx, "Lockout",
+			slog.Bool("audit", true),
+			slog.String("key", key),
+			slog.Int64("level", level),
+			slog.String("duration", d.String()),
+		)
+		lockedFor = max(lockedFor, d)
+	}
+
+	return lockedFor, nil
+}
+
+// Success resets the failure counters of the keys.
+func (g *Guard) Success(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := g.store.ResetFailures(ctx, key); err != nil {
+			return fmt.Errorf("reset failures %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Unlock removes the lockout of the key.
+func (g *Guard) Unlock(ctx context.Context, key string) error {
+	if err := g.store.Unlock(ctx, key); err != nil {
+		return fmt.Errorf("unlock %s: %w", key, err)
+	}
+	slog.WarnContext(ctx, "Unlock", slog.Bool("audit", true), slog.String("key", key))
+
+	return nil
+}
+
+func (g *Guard) duration(level int64) time.Duration {
+	d := g.conf.BaseLockout
+	for i := int64(1); i < level && d < g.conf.MaxLockout; i++ {
+		d *= 2
+	}
+
+	return min(d, g.conf.MaxLockout)
+}
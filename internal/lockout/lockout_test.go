@@ -0,0 +1,50 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	g := New(&Conf{MaxFailures: 3, Window: time.Minute, BaseLockout: time.Minute, MaxLockout: 3 * time.Minute}, NewMemoryStore())
+	key := UserKey("Bob")
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for i, want := range expected {
+		var lockedFor time.Duration
+		for range 3 {
+			d, err := g.Fail(ctx, key)
+			if err != nil {
+				t.Fatalf("fail: %v", err)
+			}
+			lockedFor = max(lockedFor, d)
+		}
+		if lockedFor != want {
+			t.Errorf("lockout %d: expected %v but received %v", i+1, want, lockedFor)
+		}
+		retryAfter, err := g.Check(ctx, key, IPKey("127.0.0.1"))
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		if retryAfter <= 0 || retryAfter > want {
+			t.Errorf("lockout %d: expected retry after in (0, %v] but received %v", i+1, want, retryAfter)
+		}
+	}
+
+	if err := g.Unlock(ctx, key); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if retryAfter, _ := g.Check(ctx, key); retryAfter != 0 {
+		t.Errorf("expected no lockout after unlock but received %v", retryAfter)
+	}
+
+	// Success resets the failure counter.
+	g.Fail(ctx, key)
+	g.Fail(ctx, key)
+	g.Success(ctx, key)
+	if lockedFor, _ := g.Fail(ctx, key); lockedFor != 0 {
+		t.Errorf("expected no lockout after success but received %v", lockedFor)
+	}
+}
@@ -0,0 +1,132 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type counter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps failure counters in process memory.
+// It is used when counters need not be shared between instances.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	failures map[string]counter
+	levels   map[string]counter
+	locks    map[string]time.Time
+
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		failures:  make(map[string]counter),
+		levels:    make(map[string]counter),
+		locks:     make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) IncrFailures(_ context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(window)
+
+	return incr(s.failures, key, window), nil
+}
+
+func (s *MemoryStore) IncrLevel(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return incr(s.levels, key, ttl), nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(d)
+	delete(s.failures, key)
+
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	d := time.Until(until)
+	if d <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+
+	return d, nil
+}
+
+func (s *MemoryStore) ResetFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Unlock(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.levels, key)
+	delete(s.locks, key)
+
+	return nil
+}
+
+// sweep removes expired entries at most once per interval.
+func (s *MemoryStore) sweep(interval time.Duration) {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < interval {
+		return
+	}
+	s.lastSweep = now
+	for key, c := range s.failures {
+		if now.After(c.expiresAt) {
+			delete(s.failures, key)
+		}
+	}
+	for key, c := range s.levels {
+		if now.After(c.expiresAt) {
+			delete(s.levels, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+func incr(counters map[string]counter, key string, ttl time.Duration) int64 {
+	now := time.Now()
+	c, ok := counters[key]
+	if !ok || now.After(c.expiresAt) {
+		c = counter{value: 0, expiresAt: now.Add(ttl)}
+	}
+	c.value++
+	counters[key] = c
+
+	return c.value
+}
@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"os"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey int
@@ -14,6 +16,7 @@ type contextKey int
 const (
 	contextKeyRequestID contextKey = iota
 	contextKeyUsername
+	contextKeyRole
 	contextKeyAlias
 	contextKeyURL
 )
@@ -25,6 +28,8 @@ type Conf struct {
 	Level    string
 }
 
+// ContextHandler adds the values of the request and the ids of the trace and
+// the span in the context to the records.
 type ContextHandler struct {
 	slog.Handler
 }
@@ -75,6 +80,10 @@ func WithUsername(ctx context.Context, username string) context.Context {
 	return context.WithValue(ctx, contextKeyUsername, username)
 }
 
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, contextKeyRole, role)
+}
+
 func WithAlias(ctx context.Context, alias string) context.Context {
 	return context.WithValue(ctx, contextKeyAlias, alias)
 }
@@ -95,6 +104,18 @@ func GetUsernameFromCtx(ctx context.Context) (string, error) {
 	return username, nil
 }
 
+func GetRoleFromCtx(ctx context.Context) (string, error) {
+	if ctx == nil {
+		return "", errors.New("ctx is nil")
+	}
+	role, ok := ctx.Value(contextKeyRole).(string)
+	if !ok {
+		return "", errors.New("no role in ctx")
+	}
+
+	return role, nil
+}
+
 func (h ContextHandler) Handle(ctx context.Context, r slog.Record) error {
 	if requestID, ok := ctx.Value(contextKeyRequestID).(string); ok {
 		r.Add("requestID", requestID)
@@ -108,6 +129,18 @@ func (h ContextHandler) Handle(ctx context.Context, r slog.Record) error {
 	if url, ok := ctx.Value(contextKeyURL).(string); ok {
 		r.Add("url", url)
 	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		r.Add("traceID", spanContext.TraceID().String())
+		r.Add("spanID", spanContext.SpanID().String())
+	}
 
 	return h.Handler.Handle(ctx, r) //nolint:wrapcheck
 }
+
+func (h ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,278 @@
+// Package metadata fetches the title, the description, the Open Graph image
+// and the favicon of destination pages.
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/errcode"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultMaxSize      = 512 << 10
+	defaultMaxRedirects = 5
+	defaultQueueSize    = 1000
+
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxURLLength         = 2048
+
+	userAgent = "url-shortener-metadata/1.0"
+)
+
+var (
+	ErrFetch    = errcode.New("metadata_fetch", "can't fetch destination page")
+	ErrDisabled = errcode.New("metadata_disabled", "fetching of page metadata is disabled")
+)
+
+type Conf struct {
+	// Fetch metadata of destinations of created and edited links.
+	Enabled bool
+	// Time limit of the whole fetch, redirects included.
+	Timeout time.Duration
+	// How many bytes of the page are read at most.
+	MaxSize int64
+	// How many redirects of the destination are followed.
+	MaxRedirects int
+	// How many links may wait for the fetch, the rest are skipped.
+	QueueSize int
+}
+
+type MetadataSetter interface {
+	SetMetadata(ctx context.Context, alias, url string, metadata *storage.Metadata) error
+}
+
+type job struct {
+	alias string
+	url   string
+}
+
+// Collector fetches metadata of destinations in the background as links are
+// created and edited, and on demand.
+type Collector struct {
+	enabled bool
+	client  *http.Client
+	maxSize int64
+	st      MetadataSetter
+	queue   chan job
+}
+
+func New(conf *Conf, st MetadataSetter) *Collector {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	maxSize := conf.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	maxRedirects := conf.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	return &Collector{
+		enabled: conf.Enabled,
+		client:  destination.NewClient(timeout, maxRedirects, false),
+		maxSize: maxSize,
+		st:      st,
+		queue:   make(chan job, queueSize),
+	}
+}
+
+// Enqueue schedules fetching of the metadata of the url of the alias. It
+// never blocks: if the queue is full, the link is skipped and can be
+// refreshed later.
+func (c *Collector) Enqueue(alias, rawURL string) {
+	if !c.enabled {
+		return
+	}
+	select {
+	case c.queue <- job{alias: alias, url: rawURL}:
+	default:
+		slog.Warn("Fetch metadata", slog.String("alias", alias), slog.String("warn", "queue is full"))
+	}
+}
+
+// Run fetches metadata of the queued links until the context is canceled.
+func (c *Collector) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-c.queue:
+			if _, err := c.Refresh(ctx, job.alias, job.url); err != nil {
+				slog.WarnContext(ctx, "Fetch metadata", slog.String("alias", job.alias), slog.String("warn", err.Error()))
+			}
+		}
+	}
+}
+
+// Refresh fetches and stores the metadata of the url of the alias.
+func (c *Collector) Refresh(ctx context.Context, alias, rawURL string) (*storage.Metadata, error) {
+	if !c.enabled {
+		return nil, ErrDisabled
+	}
+	metadata, err := c.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.st.SetMetadata(ctx, alias, rawURL, metadata); err != nil {
+		return nil, fmt.Errorf("saving metadata to storage: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// Fetch reads the head of the page at the url. Pages other than HTML get
+// only the favicon of the site.
+func (c *Collector) Fetch(ctx context.Context, rawURL string) (*storage.Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %w", ErrFetch, err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetch, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrFetch, res.StatusCode)
+	}
+
+	// Relative links are resolved against the page after redirects.
+	base := res.Request.URL
+	metadata := storage.Metadata{FetchedAt: time.Now().UTC()}
+	contentType := res.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		body, err := charset.NewReader(io.LimitReader(res.Body, c.maxSize), contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: decode page: %w", ErrFetch, err)
+		}
+		parse(body, base, &metadata)
+	}
+	if metadata.Favicon == "" {
+		metadata.Favicon = resolve(base, "/favicon.ico")
+	}
+
+	return &metadata, nil
+}
+
+// parse reads the title, the meta tags and the icon links up to the body of
+// the page.
+func parse(body io.Reader, base *url.URL, metadata *storage.Metadata) {
+	var ogTitle, ogDescription string
+	tokenizer := html.NewTokenizer(body)
+loop:
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom.String() {
+			case "body":
+				break loop
+			case "title":
+				if metadata.Title == "" && tokenizer.Next() == html.TextToken {
+					metadata.Title = clean(string(tokenizer.Text()), maxTitleLength)
+				}
+			case "meta":
+				name := strings.ToLower(attr(&token, "property"))
+				if name == "" {
+					name = strings.ToLower(attr(&token, "name"))
+				}
+				content := attr(&token, "content")
+				switch name {
+				case "description":
+					metadata.Description = clean(content, maxDescriptionLength)
+				case "og:title":
+					ogTitle = clean(content, maxTitleLength)
+				case "og:description":
+					ogDescription = clean(content, maxDescriptionLength)
+				case "og:image":
+					if metadata.Image == "" {
+						metadata.Image = resolve(base, content)
+					}
+				}
+			case "link":
+				if metadata.Favicon != "" {
+					continue
+				}
+				for rel := range strings.FieldsSeq(strings.ToLower(attr(&token, "rel"))) {
+					if rel == "icon" {
+						metadata.Favicon = resolve(base, attr(&token, "href"))
+						break
+					}
+				}
+			}
+		case html.EndTagToken:
+			if tokenizer.Token().DataAtom.String() == "head" {
+				break loop
+			}
+		default:
+		}
+	}
+	if metadata.Title == "" {
+		metadata.Title = ogTitle
+	}
+	if metadata.Description == "" {
+		metadata.Description = ogDescription
+	}
+}
+
+func attr(token *html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// clean collapses white space and cuts the text to the number of characters.
+func clean(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+
+	return string([]rune(text)[:length])
+}
+
+// resolve returns the absolute http or https url of the reference, empty if
+// it is not one.
+func resolve(base *url.URL, ref string) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || ref == "" {
+		return ""
+	}
+	if str := u.String(); len(str) <= maxURLLength {
+		return str
+	}
+
+	return ""
+}
@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>
+		Systems   design
+	</title>
+	<meta name="description" content="Process of defining the architecture">
+	<meta property="og:title" content="Systems design - Wikipedia">
+	<meta property="og:image" content="/static/og.png">
+	<link rel="stylesheet" href="/style.css">
+	<link rel="Shortcut Icon" href="https://cdn.example.com/favicon.png">
+</head>
+<body>
+	<meta property="og:description" content="ignored">
+</body>
+</html>`
+
+type setter struct {
+	alias    string
+	url      string
+	metadata *storage.Metadata
+}
+
+func (s *setter) SetMetadata(_ context.Context, alias, url string, metadata *storage.Metadata) error {
+	s.alias, s.url, s.metadata = alias, url, metadata
+	return nil
+}
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(res http.ResponseWriter, _ *http.Request) {
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		res.Write([]byte(page))
+	})
+	mux.HandleFunc("/og", func(res http.ResponseWriter, _ *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(`<head><meta property="og:title" content="Only og"><meta property="og:description" content="Og description">`))
+	})
+	mux.HandleFunc("/cp1251", func(res http.ResponseWriter, _ *http.Request) {
+		res.Header().Set("Content-Type", "text/html; charset=windows-1251")
+		res.Write([]byte("<title>\xcf\xf0\xe8\xe2\xe5\xf2</title>"))
+	})
+	mux.HandleFunc("/large", func(res http.ResponseWriter, _ *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte("<head><!--" + strings.Repeat("x", 2048) + "--><title>Too far</title>"))
+	})
+	mux.HandleFunc("/file.pdf", func(res http.ResponseWriter, _ *http.Request) {
+		res.Header().Set("Content-Type", "application/pdf")
+		res.Write([]byte("%PDF-1.4 <title>Not html</title>"))
+	})
+	mux.Handle("/moved", http.RedirectHandler("/page", http.StatusMovedPermanently))
+	mux.Handle("/loop", http.RedirectHandler("/loop", http.StatusFound))
+	mux.Handle("/missing", http.NotFoundHandler())
+
+	return httptest.NewServer(mux)
+}
+
+func TestFetch(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	collector := New(&Conf{Enabled: true, MaxSize: 1024}, &setter{})
+	collector.client = destination.NewClient(time.Second, 2, true)
+	tests := []struct {
+		path     string
+		expected storage.Metadata
+	}{
+		{"/page", storage.Metadata{
+			Title:       "Systems design",
+			Description: "Process of defining the architecture",
+			Image:       server.URL + "/static/og.png",
+			Favicon:     "https://cdn.example.com/favicon.png",
+		}},
+		{"/moved", storage.Metadata{
+			Title:       "Systems design",
+			Description: "Process of defining the architecture",
+			Image:       server.URL + "/static/og.png",
+			Favicon:     "https://cdn.example.com/favicon.png",
+		}},
+		{"/og", storage.Metadata{Title: "Only og", Description: "Og description", Favicon: server.URL + "/favicon.ico"}},
+		{"/cp1251", storage.Metadata{Title: "Привет", Favicon: server.URL + "/favicon.ico"}},
+		{"/large", storage.Metadata{Favicon: server.URL + "/favicon.ico"}},
+		{"/file.pdf", storage.Metadata{Favicon: server.URL + "/favicon.ico"}},
+	}
+	for _, test := range tests {
+		metadata, err := collector.Fetch(context.Background(), server.URL+test.path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.path, err)
+			continue
+		}
+		if metadata.FetchedAt.IsZero() {
+			t.Errorf("%s: fetched at is not set", test.path)
+		}
+		metadata.FetchedAt = time.Time{}
+		if *metadata != test.expected {
+			t.Errorf("%s: expected %+v but received %+v", test.path, test.expected, *metadata)
+		}
+	}
+
+	for _, path := range []string{"/loop", "/missing"} {
+		if _, err := collector.Fetch(context.Background(), server.URL+path); !errors.Is(err, ErrFetch) {
+			t.Errorf("%s: expected %v but received %v", path, ErrFetch, err)
+		}
+	}
+}
+
+func TestPrivateAddress(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	collector := New(&Conf{Enabled: true}, &setter{})
+	_, err := collector.Fetch(context.Background(), server.URL+"/page")
+	if !errors.Is(err, ErrFetch) || !errors.Is(err, destination.ErrPrivateAddress) {
+		t.Errorf("expected %v but received %v", destination.ErrPrivateAddress, err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	st := &setter{}
+	collector := New(&Conf{Enabled: true}, st)
+	collector.client = destination.NewClient(time.Second, 2, true)
+	metadata, err := collector.Refresh(context.Background(), "zn9edcu", server.URL+"/page")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if st.alias != "zn9edcu" || st.url != server.URL+"/page" || st.metadata != metadata {
+		t.Errorf("metadata is not stored: %+v", st)
+	}
+
+	if _, err := New(&Conf{}, st).Refresh(context.Background(), "zn9edcu", server.URL+"/page"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("expected %v but received %v", ErrDisabled, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package metrics collects the metrics of requests, redirects, the cache and
+// the storage and exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/mrvin/url-shortener/pkg/http/realip"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "url_shortener"
+
+// Results of a lookup of the cache.
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// unmatched is the route of requests not matched by any pattern.
+const unmatched = "unmatched"
+
+type Conf struct {
+	// Expose the metrics on /metrics.
+	Enabled bool
+	// Networks allowed to read the metrics, any if empty.
+	AllowedNets []netip.Prefix
+}
+
+// DBStater reports the statistics of the pool of connections to the
+// database.
+type DBStater interface {
+	Stats() sql.DBStats
+}
+
+// Metrics holds the metrics of the service in its own registry.
+type Metrics struct {
+	conf     Conf
+	registry *prometheus.Registry
+
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	redirects     *prometheus.CounterVec
+	cache         *prometheus.CounterVec
+	pendingClicks prometheus.Gauge
+}
+
+func New(conf *Conf) *Metrics {
+	m := &Metrics{
+		conf:     *conf,
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by route pattern and status code.",
+		}, []string{"route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "status"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Number of redirects to destinations by status code.",
+		}, []string{"code"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "lookups_total",
+			Help:      "Number of lookups of links in the cache by result: hit, miss or error.",
+		}, []string{"result"}),
+		pendingClicks: prometheus.NewGauge(prometheus.GaugeOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "clicks",
+			Name:      "pending",
+			Help:      "Number of clicks waiting to be written to the storage.",
+		}),
+	}
+	for _, result := range []string{CacheHit, CacheMiss, CacheError} {
+		m.cache.WithLabelValues(result)
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}), //nolint:exhaustruct
+		m.requests,
+		m.duration,
+		m.redirects,
+		m.cache,
+		m.pendingClicks,
+	)
+
+	return m
+}
+
+// Enabled tells whether the metrics are exposed.
+func (m *Metrics) Enabled() bool {
+	return m.conf.Enabled
+}
+
+// SetBuildInfo exposes the version of the build as the labels of a constant
+// metric.
+func (m *Metrics) SetBuildInfo(tag, hash, date string) {
+	info := prometheus.NewGauge(prometheus.GaugeOpts{ //nolint:exhaustruct
+		Namespace:   namespace,
+		Name:        "build_info",
+		Help:        "Version of the build, always 1.",
+		ConstLabels: prometheus.Labels{"tag": tag, "hash": hash, "date": date},
+	})
+	info.Set(1)
+	m.registry.MustRegister(info)
+}
+
+// RegisterDB exposes the statistics of the pool of connections to the
+// database, read on every scrape.
+func (m *Metrics) RegisterDB(db DBStater) {
+	gauge := func(name, help string, value func(stats *sql.DBStats) float64) {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			stats := db.Stats()
+			return value(&stats)
+		}))
+	}
+	counter := func(name, help string, value func(stats *sql.DBStats) float64) {
+		m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			stats := db.Stats()
+			return value(&stats)
+		}))
+	}
+
+	gauge("max_open_connections", "Maximum number of open connections.",
+		func(stats *sql.DBStats) float64 { return float64(stats.MaxOpenConnections) })
+	gauge("open_connections", "Number of open connections, in use and idle.",
+		func(stats *sql.DBStats) float64 { return float64(stats.OpenConnections) })
+	gauge("in_use_connections", "Number of connections in use.",
+		func(stats *sql.DBStats) float64 { return float64(stats.InUse) })
+	gauge("idle_connections", "Number of idle connections.",
+		func(stats *sql.DBStats) float64 { return float64(stats.Idle) })
+	counter("wait_count_total", "Number of waits for a connection.",
+		func(stats *sql.DBStats) float64 { return float64(stats.WaitCount) })
+	counter("wait_duration_seconds_total", "Time spent waiting for a connection.",
+		func(stats *sql.DBStats) float64 { return stats.WaitDuration.Seconds() })
+	counter("max_idle_closed_total", "Number of connections closed as too many idle.",
+		func(stats *sql.DBStats) float64 { return float64(stats.MaxIdleClosed) })
+	counter("max_idle_time_closed_total", "Number of connections closed as idle for too long.",
+		func(stats *sql.DBStats) float64 { return float64(stats.MaxIdleTimeClosed) })
+	counter("max_lifetime_closed_total", "Number of connections closed as open for too long.",
+		func(stats *sql.DBStats) float64 { return float64(stats.MaxLifetimeClosed) })
+}
+
+// ObserveRedirect counts a redirect with the status code.
+func (m *Metrics) ObserveRedirect(code int) {
+	m.redirects.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// ObserveCache counts a lookup of the cache with the result.
+func (m *Metrics) ObserveCache(result string) {
+	m.cache.WithLabelValues(result).Inc()
+}
+
+// AddPendingClicks changes the number of clicks waiting to be written.
+func (m *Metrics) AddPendingClicks(delta int) {
+	m.pendingClicks.Add(float64(delta))
+}
+
+// Middleware counts the requests and observes their duration by the pattern
+// of the route and the status code. It must wrap the ServeMux itself: the
+// mux sets the pattern on the request it is given.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		srw := &statusResponseWriter{ResponseWriter: res, statusCode: http.StatusOK}
+		next.ServeHTTP(srw, req)
+
+		route := req.Pattern
+		if route == "" {
+			route = unmatched
+		}
+		status := strconv.Itoa(srw.statusCode)
+		m.requests.WithLabelValues(route, status).Inc()
+		m.duration.WithLabelValues(route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Handler serves the metrics to the clients from the allowed networks.
+func (m *Metrics) Handler() http.HandlerFunc {
+	handler := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}) //nolint:exhaustruct
+	return func(res http.ResponseWriter, req *http.Request) {
+		if !m.allowed(realip.Addr(req)) {
+			httpresponse.WriteError(res, "metrics are not allowed from this address", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(res, req)
+	}
+}
+
+func (m *Metrics) allowed(addr netip.Addr) bool {
+	if len(m.conf.AllowedNets) == 0 {
+		return true
+	}
+	for _, prefix := range m.conf.AllowedNets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck
+}
+
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
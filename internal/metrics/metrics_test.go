@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+type fakeDB struct{}
+
+func (fakeDB) Stats() sql.DBStats {
+	return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 2, Idle: 1} //nolint:exhaustruct
+}
+
+func scrape(t *testing.T, m *Metrics, remoteAddr string) (int, string) {
+	t.Helper()
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = remoteAddr
+	m.Handler().ServeHTTP(res, req)
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	return res.Code, string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New(&Conf{Enabled: true}) //nolint:exhaustruct
+	m.SetBuildInfo("v1.0.0", "57a38a4", "2025-11-21.15:06:09")
+	m.RegisterDB(fakeDB{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodGet+" /{alias...}", func(res http.ResponseWriter, req *http.Request) {
+		if req.PathValue("alias") == "missing" {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.Redirect(res, req, "https://example.com", http.StatusFound)
+	})
+	handler := m.Middleware(mux)
+	for _, path := range []string{"/zn9edcu", "/yc", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/zn9edcu", nil))
+
+	m.ObserveRedirect(http.StatusFound)
+	m.ObserveCache(CacheHit)
+	m.ObserveCache(CacheHit)
+	m.AddPendingClicks(3)
+	m.AddPendingClicks(-1)
+
+	code, body := scrape(t, m, "192.0.2.1:1234")
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d but received %d", http.StatusOK, code)
+	}
+	expected := []string{
+		`url_shortener_http_requests_total{route="GET /{alias...}",status="302"} 2`,
+		`url_shortener_http_requests_total{route="GET /{alias...}",status="404"} 1`,
+		`url_shortener_http_requests_total{route="unmatched",status="405"} 1`,
+		`url_shortener_http_request_duration_seconds_count{route="GET /{alias...}",status="302"} 2`,
+		`url_shortener_redirects_total{code="302"} 1`,
+		`url_shortener_cache_lookups_total{result="hit"} 2`,
+		`url_shortener_cache_lookups_total{result="miss"} 0`,
+		`url_shortener_clicks_pending 2`,
+		`url_shortener_db_open_connections 3`,
+		`url_shortener_db_in_use_connections 2`,
+		`url_shortener_build_info{date="2025-11-21.15:06:09",hash="57a38a4",tag="v1.0.0"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in metrics", line)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	m := New(&Conf{Enabled: true, AllowedNets: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+	tests := []struct {
+		remoteAddr string
+		expected   int
+	}{
+		{"10.1.2.3:1234", http.StatusOK},
+		{"[::ffff:10.1.2.3]:1234", http.StatusOK},
+		{"192.0.2.1:1234", http.StatusForbidden},
+		{"[2001:db8::1]:1234", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if code, _ := scrape(t, m, test.remoteAddr); code != test.expected {
+			t.Errorf("%s: expected status code %d but received %d", test.remoteAddr, test.expected, code)
+		}
+	}
+}
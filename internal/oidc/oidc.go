@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNoIDToken       = errors.New("no id_token in token response")
+	ErrNoEmail         = errors.New("no email in id token")
+	ErrInvalidNonce    = errors.New("invalid nonce")
+	ErrEmailUnverified = errors.New("email is not verified")
+	ErrDomainForbidden = errors.New("email domain is not allowed")
+	ErrGroupForbidden  = errors.New("user is not in an allowed group")
+	ErrInvalidState    = errors.New("invalid state")
+)
+
+const defaultGroupsClaim = "groups"
+
+const stateCookieName = "oidc_state"
+const stateTTL = 10 * time.Minute
+const lenRandom = 32
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type Conf struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	AllowedDomains []string
+	AllowedGroups  []string
+	AdminGroup     string
+	GroupsClaim    string
+}
+
+// Identity is the user identity asserted by the ID token.
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// Provider runs the OpenID Connect authorization code flow with PKCE.
+type Provider struct {
+	conf *Conf
+
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// New discovers the issuer configuration from its
+// /.well-known/openid-configuration document.
+func New(ctx context.Context, conf *Conf) (*Provider, error) {
+	provider, err := gooidc.NewProvider(ctx, conf.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover issuer: %w", err)
+	}
+	if conf.GroupsClaim == "" {
+		conf.GroupsClaim = defaultGroupsClaim
+	}
+
+	return &Provider{
+		conf: conf,
+		oauth2: oauth2.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: conf.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  conf.RedirectURL,
+			Scopes:       []string{gooidc.ScopeOpenID, "email", "profile", "groups"},
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: conf.ClientID}), //nolint:exhaustruct
+	}, nil
+}
+
+// AuthCodeURL returns the URL of the issuer login page.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth2.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// Exchange trades the authorization code for tokens and verifies the ID token.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrNoIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrInvalidNonce
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("parse id token claims: %w", err)
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return nil, ErrNoEmail
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, ErrEmailUnverified
+	}
+
+	return &Identity{
+		Subject: idToken.Subject,
+		Email:   strings.ToLower(email),
+		Groups:  stringSlice(claims[p.conf.GroupsClaim]),
+	}, nil
+}
+
+// Authorize checks the identity against the allowed domains and groups and
+// returns the role of the user: admin if the user is in the admin group.
+func (p *Provider) Authorize(identity *Identity) (string, error) {
+	if len(p.conf.AllowedDomains) != 0 {
+		_, domain, _ := strings.Cut(identity.Email, "@")
+		if !slices.ContainsFunc(p.conf.AllowedDomains, func(allowed string) bool {
+			return strings.EqualFold(allowed, domain)
+		}) {
+			return "", fmt.Errorf("%w: %q", ErrDomainForbidden, domain)
+		}
+	}
+	isAdmin := p.conf.AdminGroup != "" && slices.Contains(identity.Groups, p.conf.AdminGroup)
+	if len(p.conf.AllowedGroups) != 0 && !isAdmin {
+		if !slices.ContainsFunc(identity.Groups, func(group string) bool {
+			return slices.Contains(p.conf.AllowedGroups, group)
+		}) {
+			return "", ErrGroupForbidden
+		}
+	}
+	if isAdmin {
+		return RoleAdmin, nil
+	}
+
+	return RoleUser, nil
+}
+
+// State is the per-login data kept in a short-lived cookie between
+// the redirect to the issuer and the callback.
+type State struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+func NewState() (*State, error) {
+	var values [2]string
+	for i := range values {
+		b := make([]byte, lenRandom)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("read random: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return &State{State: values[0], Nonce: values[1], CodeVerifier: oauth2.GenerateVerifier()}, nil
+}
+
+func (p *Provider) SetStateCookie(res http.ResponseWriter, st *State) {
+	http.SetCookie(res, &http.Cookie{ //nolint:exhaustruct
+		Name:     stateCookieName,
+		Value:    st.State + "." + st.Nonce + "." + st.CodeVerifier,
+		Path:     p.callbackPath(),
+		MaxAge:   int(stateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.conf.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// StateFromCookie returns the state saved by SetStateCookie if it matches
+// the state returned by the issuer, and removes the cookie.
+func (p *Provider) StateFromCookie(res http.ResponseWriter, req *http.Request) (*State, error) {
+	cookie, err := req.Cookie(stateCookieName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidState, err)
+	}
+	http.SetCookie(res, &http.Cookie{ //nolint:exhaustruct
+		Name:   stateCookieName,
+		Path:   p.callbackPath(),
+		MaxAge: -1,
+	})
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 { //nolint:mnd
+		return nil, ErrInvalidState
+	}
+	st := State{State: parts[0], Nonce: parts[1], CodeVerifier: parts[2]}
+	if subtle.ConstantTimeCompare([]byte(st.State), []byte(req.URL.Query().Get("state"))) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	return &st, nil
+}
+
+func (p *Provider) callbackPath() string {
+	u, err := url.Parse(p.conf.RedirectURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// stringSlice converts the groups claim, which may be a list or a single string.
+func stringSlice(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		groups := make([]string, 0, len(v))
+		for _, elem := range v {
+			if group, ok := elem.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	default:
+		return nil
+	}
+}
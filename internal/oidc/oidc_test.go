@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const testClientID = "url-shortener"
+
+// mockIssuer is a minimal OpenID Connect issuer: discovery, JWKS and
+// a token endpoint that returns an ID token with the configured claims.
+type mockIssuer struct {
+	*httptest.Server
+
+	key    *rsa.PrivateKey
+	claims map[string]any
+	nonce  string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(res http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(res).Encode(map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /keys", func(res http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(res).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", func(res http.ResponseWriter, req *http.Request) {
+		if req.FormValue("code") != "valid-code" || req.FormValue("code_verifier") == "" {
+			http.Error(res, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken(t),
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+func (m *mockIssuer) idToken(t *testing.T) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	claims := map[string]any{
+		"iss":   m.URL,
+		"aud":   testClientID,
+		"sub":   "1234",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": m.nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	token, _ := jws.CompactSerialize()
+
+	return token
+}
+
+func TestProvider(t *testing.T) {
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+	p, err := New(ctx, &Conf{
+		Issuer:         issuer.URL,
+		ClientID:       testClientID,
+		ClientSecret:   "secret",
+		RedirectURL:    "http://localhost/api/users/oidc/callback",
+		AllowedDomains: []string{"example.com"},
+		AllowedGroups:  []string{"staff"},
+		AdminGroup:     "admins",
+	})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	st, err := NewState()
+	if err != nil {
+		t.Fatalf("new state: %v", err)
+	}
+	authURL, err := url.Parse(p.AuthCodeURL(st.State, st.Nonce, st.CodeVerifier))
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	if q := authURL.Query(); q.Get("state") != st.State || q.Get("nonce") != st.Nonce || q.Get("code_challenge") == "" {
+		t.Errorf("auth url missing state, nonce or code challenge: %s", authURL)
+	}
+
+	tests := []struct {
+		TestName     string
+		Code         string
+		Nonce        string
+		Claims       map[string]any
+		ExpectedRole string
+		ExpectedErr  error
+	}{
+		{
+			TestName:     "Success user",
+			Code:         "valid-code",
+			Nonce:        st.Nonce,
+			Claims:       map[string]any{"email": "Bob@example.com", "groups": []string{"staff"}},
+			ExpectedRole: RoleUser,
+		},
+		{
+			TestName:     "Success admin",
+			Code:         "valid-code",
+			Nonce:        st.Nonce,
+			Claims:       map[string]any{"email": "alice@example.com", "groups": []string{"admins"}},
+			ExpectedRole: RoleAdmin,
+		},
+		{
+			TestName:    "Error domain",
+			Code:        "valid-code",
+			Nonce:       st.Nonce,
+			Claims:      map[string]any{"email": "eve@evil.com", "groups": []string{"staff"}},
+			ExpectedErr: ErrDomainForbidden,
+		},
+		{
+			TestName:    "Error group",
+			Code:        "valid-code",
+			Nonce:       st.Nonce,
+			Claims:      map[string]any{"email": "jimmy@example.com", "groups": "guests"},
+			ExpectedErr: ErrGroupForbidden,
+		},
+		{
+			TestName:    "Error nonce",
+			Code:        "valid-code",
+			Nonce:       "other",
+			Claims:      map[string]any{"email": "bob@example.com"},
+			ExpectedErr: ErrInvalidNonce,
+		},
+		{
+			TestName:    "Error unverified email",
+			Code:        "valid-code",
+			Nonce:       st.Nonce,
+			Claims:      map[string]any{"email": "bob@example.com", "email_verified": false},
+			ExpectedErr: ErrEmailUnverified,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			issuer.claims = test.Claims
+			issuer.nonce = test.Nonce
+
+			identity, err := p.Exchange(ctx, test.Code, st.Nonce, st.CodeVerifier)
+			if err == nil {
+				var role string
+				role, err = p.Authorize(identity)
+				if err == nil && role != test.ExpectedRole {
+					t.Errorf("expected role %q but received %q", test.ExpectedRole, role)
+				}
+			}
+			if !errors.Is(err, test.ExpectedErr) {
+				t.Errorf("expected error %v but received %v", test.ExpectedErr, err)
+			}
+		})
+	}
+
+	t.Run("Error invalid code", func(t *testing.T) {
+		if _, err := p.Exchange(ctx, "invalid-code", st.Nonce, st.CodeVerifier); err == nil {
+			t.Error("expected error for invalid code")
+		}
+	})
+}
+
+func TestStateCookie(t *testing.T) {
+	p := &Provider{conf: &Conf{RedirectURL: "https://sho.rt/api/users/oidc/callback"}}
+	st, _ := NewState()
+
+	res := httptest.NewRecorder()
+	p.SetStateCookie(res, st)
+	cookie := res.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.Path != "/api/users/oidc/callback" {
+		t.Errorf("unexpected state cookie %+v", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state="+st.State, nil)
+	req.AddCookie(cookie)
+	got, err := p.StateFromCookie(httptest.NewRecorder(), req)
+	if err != nil || *got != *st {
+		t.Errorf("expected state %+v but received %+v, %v", st, got, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users/oidc/callback?state=forged", nil)
+	req.AddCookie(cookie)
+	if _, err := p.StateFromCookie(httptest.NewRecorder(), req); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected %v but received %v", ErrInvalidState, err)
+	}
+}
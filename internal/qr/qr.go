@@ -0,0 +1,284 @@
+// Package qr renders QR codes of short links as PNG and SVG images.
+package qr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mrvin/url-shortener/pkg/errcode"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+const (
+	defaultSize    = 256
+	defaultMaxSize = 2048
+	defaultMargin  = 4
+	maxMargin      = 32
+	// Share of the code width covered by the logo, small enough to be
+	// restored with the highest error correction level.
+	logoRatio = 5
+)
+
+var ErrInvalidOptions = errcode.New("qr_invalid_options", "invalid qr code options")
+
+//nolint:gochecknoglobals
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+type Conf struct {
+	// Defaults of the options, 256 pixels, level M, black on white if zero.
+	Size  int
+	Level string
+	// Margin in modules, 4 if nil; zero draws the code without a margin.
+	Margin     *int
+	Foreground string
+	Background string
+	// Largest size allowed in a request, 2048 pixels if zero.
+	MaxSize int
+	// PNG image drawn in the centre of the code on request, none if empty.
+	Logo string
+}
+
+// Options of a QR code image. Colors are hex RGB like "1a2b3c".
+type Options struct {
+	Size       int
+	Level      string
+	Margin     int
+	Foreground string
+	Background string
+	Logo       bool
+}
+
+type Generator struct {
+	defaults Options
+	maxSize  int
+	logo     image.Image
+	// logoPNG is the logo embedded in SVG images.
+	logoPNG []byte
+}
+
+func New(conf *Conf) (*Generator, error) {
+	g := &Generator{
+		defaults: Options{
+			Size:       conf.Size,
+			Level:      strings.ToUpper(conf.Level),
+			Margin:     defaultMargin,
+			Foreground: strings.TrimPrefix(conf.Foreground, "#"),
+			Background: strings.TrimPrefix(conf.Background, "#"),
+		},
+		maxSize: conf.MaxSize,
+	}
+	if g.maxSize <= 0 {
+		g.maxSize = defaultMaxSize
+	}
+	if g.defaults.Size <= 0 {
+		g.defaults.Size = min(defaultSize, g.maxSize)
+	}
+	if g.defaults.Level == "" {
+		g.defaults.Level = "M"
+	}
+	if conf.Margin != nil {
+		g.defaults.Margin = *conf.Margin
+	}
+	if g.defaults.Foreground == "" {
+		g.defaults.Foreground = "000000"
+	}
+	if g.defaults.Background == "" {
+		g.defaults.Background = "ffffff"
+	}
+	if err := g.validate(&g.defaults); err != nil {
+		return nil, fmt.Errorf("default options: %w", err)
+	}
+
+	if conf.Logo != "" {
+		logoPNG, err := os.ReadFile(conf.Logo)
+		if err != nil {
+			return nil, fmt.Errorf("read logo: %w", err)
+		}
+		logo, err := png.Decode(bytes.NewReader(logoPNG))
+		if err != nil {
+			return nil, fmt.Errorf("decode logo: %w", err)
+		}
+		g.logo, g.logoPNG = logo, logoPNG
+	}
+
+	return g, nil
+}
+
+// Defaults returns the options used for what a request does not set.
+func (g *Generator) Defaults() Options {
+	return g.defaults
+}
+
+// ETag identifies the image of the content with the options, it does not
+// change as long as neither do.
+func (g *Generator) ETag(content, format string, opts *Options) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%s\x00%d\x00%s\x00%s\x00%t\x00",
+		content, format, opts.Size, opts.Level, opts.Margin, opts.Foreground, opts.Background, opts.Logo && g.logo != nil)
+	if opts.Logo {
+		hash.Write(g.logoPNG)
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// Encode renders the content as a QR code image in the format.
+func (g *Generator) Encode(content, format string, opts *Options) ([]byte, error) {
+	if err := g.validate(opts); err != nil {
+		return nil, err
+	}
+	level := levels[opts.Level]
+	logo := opts.Logo && g.logo != nil
+	if logo {
+		level = qrcode.Highest
+	}
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr code: %w", err)
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+	fg, _ := parseColor(opts.Foreground)
+	bg, _ := parseColor(opts.Background)
+
+	switch format {
+	case FormatPNG:
+		return g.png(bitmap, opts, fg, bg, logo)
+	case FormatSVG:
+		return g.svg(bitmap, opts, fg, bg, logo), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidOptions, format)
+	}
+}
+
+func (g *Generator) validate(opts *Options) error {
+	if opts.Size <= 0 || opts.Size > g.maxSize {
+		return fmt.Errorf("%w: size must be from 1 to %d", ErrInvalidOptions, g.maxSize)
+	}
+	if _, ok := levels[opts.Level]; !ok {
+		return fmt.Errorf("%w: level must be one of L, M, Q, H", ErrInvalidOptions)
+	}
+	if opts.Margin < 0 || opts.Margin > maxMargin {
+		return fmt.Errorf("%w: margin must be from 0 to %d", ErrInvalidOptions, maxMargin)
+	}
+	if _, err := parseColor(opts.Foreground); err != nil {
+		return fmt.Errorf("%w: foreground: %w", ErrInvalidOptions, err)
+	}
+	if _, err := parseColor(opts.Background); err != nil {
+		return fmt.Errorf("%w: background: %w", ErrInvalidOptions, err)
+	}
+
+	return nil
+}
+
+// png draws the code fitting the modules with the margin into the size,
+// the rest is filled with the background.
+func (g *Generator) png(bitmap [][]bool, opts *Options, fg, bg color.RGBA, logo bool) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := max(opts.Size/modules, 1)
+	size := max(opts.Size, modules*scale)
+	offset := (size-modules*scale)/2 + opts.Margin*scale
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				module := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+				draw.Draw(img, module, &image.Uniform{C: fg}, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if logo {
+		codeSize := len(bitmap) * scale
+		logoSize := codeSize / logoRatio
+		start := offset + (codeSize-logoSize)/2
+		area := image.Rect(start, start, start+logoSize, start+logoSize)
+		draw.Draw(img, area, &image.Uniform{C: bg}, image.Point{}, draw.Src)
+		drawScaled(img, area, g.logo)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// svg draws the code in module units scaled to the size by the viewer.
+func (g *Generator) svg(bitmap [][]bool, opts *Options, fg, bg color.RGBA, logo bool) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexColor(bg))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(fg))
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/>`)
+	if logo {
+		logoSize := float64(len(bitmap)) / logoRatio
+		start := float64(opts.Margin) + (float64(len(bitmap))-logoSize)/2
+		size := strconv.FormatFloat(logoSize, 'f', 2, 64)
+		fmt.Fprintf(&buf, `<rect x="%.2f" y="%.2f" width="%s" height="%s" fill="%s"/>`, start, start, size, size, hexColor(bg))
+		fmt.Fprintf(&buf, `<image x="%.2f" y="%.2f" width="%s" height="%s" href="data:image/png;base64,%s"/>`,
+			start, start, size, size, base64.StdEncoding.EncodeToString(g.logoPNG))
+	}
+	buf.WriteString(`</svg>`)
+
+	return buf.Bytes()
+}
+
+// drawScaled draws src over the area of dst with the nearest-neighbour
+// scaling.
+func drawScaled(dst draw.Image, area image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	for y := range area.Dy() {
+		for x := range area.Dx() {
+			scaled.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/area.Dx(), bounds.Min.Y+y*bounds.Dy()/area.Dy()))
+		}
+	}
+	draw.Draw(dst, area, scaled, image.Point{}, draw.Over)
+}
+
+func parseColor(str string) (color.RGBA, error) {
+	rgb, err := hex.DecodeString(strings.TrimPrefix(str, "#"))
+	if err != nil || len(rgb) != 3 {
+		return color.RGBA{}, errors.New("color must be hex RGB like 1a2b3c")
+	}
+
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,158 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const content = "https://sho.rt/zn9edcu"
+
+func TestEncode(t *testing.T) {
+	g, err := New(&Conf{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	opts := g.Defaults()
+
+	data, err := g.Encode(content, FormatPNG, &opts)
+	if err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if size := img.Bounds().Dx(); size != defaultSize {
+		t.Errorf("expected png size %d but received %d", defaultSize, size)
+	}
+	if c := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA); c != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("expected white margin but received %v", c)
+	}
+
+	data, err = g.Encode(content, FormatSVG, &opts)
+	if err != nil {
+		t.Fatalf("encode svg: %v", err)
+	}
+	for _, expected := range []string{`<svg `, `width="256"`, `<path fill="#000000" d="M`} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf(`svg does not contain "%s"`, expected)
+		}
+	}
+}
+
+func TestDefaultMargin(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		margin   *int
+		expected int
+	}{
+		{nil, defaultMargin},
+		{&zero, 0},
+	}
+	for _, test := range tests {
+		g, err := New(&Conf{Margin: test.margin})
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		if margin := g.Defaults().Margin; margin != test.expected {
+			t.Errorf("expected default margin %d but received %d", test.expected, margin)
+		}
+	}
+}
+
+func TestEncodeInvalidOptions(t *testing.T) {
+	g, err := New(&Conf{MaxSize: 512})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	tests := []struct {
+		name   string
+		format string
+		modify func(*Options)
+	}{
+		{"too large", FormatPNG, func(o *Options) { o.Size = 1024 }},
+		{"zero size", FormatPNG, func(o *Options) { o.Size = 0 }},
+		{"level", FormatPNG, func(o *Options) { o.Level = "X" }},
+		{"margin", FormatPNG, func(o *Options) { o.Margin = -1 }},
+		{"foreground", FormatPNG, func(o *Options) { o.Foreground = "black" }},
+		{"background", FormatSVG, func(o *Options) { o.Background = "fff" }},
+		{"format", "gif", func(*Options) {}},
+	}
+	for _, test := range tests {
+		opts := g.Defaults()
+		test.modify(&opts)
+		if _, err := g.Encode(content, test.format, &opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: expected error %v but received %v", test.name, ErrInvalidOptions, err)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	g, err := New(&Conf{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	opts := g.Defaults()
+	etag := g.ETag(content, FormatPNG, &opts)
+	if g.ETag(content, FormatPNG, &opts) != etag {
+		t.Errorf("etag is not stable")
+	}
+	if g.ETag(content, FormatSVG, &opts) == etag {
+		t.Errorf("etag does not change with the format")
+	}
+	opts.Foreground = "1a2b3c"
+	if g.ETag(content, FormatPNG, &opts) == etag {
+		t.Errorf("etag does not change with the options")
+	}
+}
+
+func TestLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			logo.Set(x, y, color.RGBA{0xff, 0, 0, 0xff})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "logo.png")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create logo: %v", err)
+	}
+	if err := png.Encode(file, logo); err != nil {
+		t.Fatalf("encode logo: %v", err)
+	}
+	file.Close()
+
+	g, err := New(&Conf{Logo: path})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	opts := g.Defaults()
+	opts.Logo = true
+	data, err := g.Encode(content, FormatPNG, &opts)
+	if err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	center := defaultSize / 2
+	if c := color.RGBAModel.Convert(img.At(center, center)).(color.RGBA); c != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("expected logo color in the centre but received %v", c)
+	}
+
+	data, err = g.Encode(content, FormatSVG, &opts)
+	if err != nil {
+		t.Fatalf("encode svg: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`href="data:image/png;base64,`)) {
+		t.Errorf("svg does not contain the logo")
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryStore keeps token buckets in process memory.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Count), last: now, limit: limit}
+		s.buckets[key] = b
+	}
+	tokens, allowed := take(refill(b.tokens, now.Sub(b.last), limit))
+	b.tokens, b.last = tokens, now
+
+	return result(tokens, allowed, limit), nil
+}
+
+// sweep removes full buckets, they are the same as absent ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if refill(b.tokens, now.Sub(b.last), b.limit) >= float64(b.limit.Count) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/logger"
+	"github.com/mrvin/url-shortener/pkg/http/realip"
+	httpresponse "github.com/mrvin/url-shortener/pkg/http/response"
+)
+
+var ErrInvalidLimit = errors.New("invalid limit")
+
+// Route groups with separate limits.
+const (
+	GroupRedirect = "redirect"
+	GroupAPI      = "api"
+	GroupCreate   = "create"
+	GroupCheck    = "check"
+	GroupAuth     = "auth"
+)
+
+//nolint:gochecknoglobals
+var Groups = []string{GroupRedirect, GroupAPI, GroupCreate, GroupCheck, GroupAuth}
+
+// Limit allows Count requests per Period with bursts up to Count.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+type Conf struct {
+	// "redis" or "memory".
+	Store string
+	// Limits per client address and per user by route group.
+	IP   map[string]Limit
+	User map[string]Limit
+}
+
+// Result is the state of a bucket after taking a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Time until the bucket is full again.
+	Reset time.Duration
+	// Time until the next token is available if the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Take must be atomic.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type Limiter struct {
+	conf  *Conf
+	store Store
+}
+
+func New(conf *Conf, store Store) *Limiter {
+	return &Limiter{conf: conf, store: store}
+}
+
+// ParseLimit parses limits like "100/1m", "10/s" or "5" (per second).
+// The period must be at least a millisecond, the precision of the stores.
+func ParseLimit(str string) (Limit, error) {
+	strCount, strPeriod, found := strings.Cut(str, "/")
+	count, err := strconv.Atoi(strings.TrimSpace(strCount))
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, str)
+	}
+	period := time.Second
+	if found {
+		strPeriod = strings.TrimSpace(strPeriod)
+		switch strPeriod {
+		case "s":
+			period = time.Second
+		case "m":
+			period = time.Minute
+		case "h":
+			period = time.Hour
+		default:
+			period, err = time.ParseDuration(strPeriod)
+			if err != nil || period < time.Millisecond {
+				return Limit{}, fmt.Errorf("%w: %q", ErrInvalidLimit, str)
+			}
+		}
+	}
+
+	return Limit{Count: count, Period: period}, nil
+}
+
+// ByIP limits requests of the route group per client address.
+func (l *Limiter) ByIP(group string, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := l.conf.IP[group]
+	if !ok {
+		return next
+	}
+	return l.middleware(group, limit, func(req *http.Request) string {
+		return "ip:" + realip.Host(req)
+	}, next)
+}
+
+// ByUser limits requests of the route group per authenticated user.
+// It must be used after authentication.
+func (l *Limiter) ByUser(group string, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := l.conf.User[group]
+	if !ok {
+		return next
+	}
+	return l.middleware(group, limit, func(req *http.Request) string {
+		username, err := logger.GetUsernameFromCtx(req.Context())
+		if err != nil {
+			return ""
+		}
+		return "user:" + username
+	}, next)
+}
+
+func (l *Limiter) middleware(group string, limit Limit, key func(req *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	policy := fmt.Sprintf("%d;w=%d", limit.Count, int(limit.Period.Seconds()))
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		k := key(req)
+		if k == "" {
+			next(res, req)
+			return
+		}
+
+		result, err := l.store.Take(ctx, group+":"+k, limit)
+		if err != nil {
+			// Fail open: an unavailable store must not take the service down.
+			slog.WarnContext(ctx, "Rate limit", slog.String("warn", err.Error()))
+			next(res, req)
+			return
+		}
+
+		// When both per-address and per-user limits apply the headers
+		// describe the more restrictive one.
+		if remaining, err := strconv.Atoi(res.Header().Get("RateLimit-Remaining")); err != nil || result.Remaining <= remaining {
+			res.Header().Set("RateLimit-Policy", policy)
+			res.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Count))
+			res.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			res.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+		}
+		if !result.Allowed {
+			slog.InfoContext(ctx, "Rate limit exceeded", slog.String("group", group), slog.String("key", k))
+			httpresponse.SetRetryAfter(res, result.RetryAfter)
+			httpresponse.WriteError(res, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next(res, req)
+	}
+}
+
+// refill returns the number of tokens after the elapsed time.
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	rate := float64(limit.Count) / float64(limit.Period)
+	return math.Min(float64(limit.Count), tokens+float64(max(elapsed, 0))*rate)
+}
+
+// take takes a token if there is one.
+func take(tokens float64) (float64, bool) {
+	if tokens >= 1 {
+		return tokens - 1, true
+	}
+	return tokens, false
+}
+
+// result describes the bucket with the tokens left after a take.
+func result(tokens float64, allowed bool, limit Limit) Result {
+	perToken := float64(limit.Period) / float64(limit.Count)
+	res := Result{
+		Allowed:    allowed,
+		Remaining:  int(tokens),
+		Reset:      time.Duration((float64(limit.Count) - tokens) * perToken),
+		RetryAfter: 0,
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+
+	return res
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		str      string
+		expected Limit
+		isErr    bool
+	}{
+		{"100/1m", Limit{Count: 100, Period: time.Minute}, false},
+		{"10/s", Limit{Count: 10, Period: time.Second}, false},
+		{"5", Limit{Count: 5, Period: time.Second}, false},
+		{" 30 / 1h ", Limit{Count: 30, Period: time.Hour}, false},
+		{"0/1m", Limit{}, true},
+		{"ten/1m", Limit{}, true},
+		{"10/day", Limit{}, true},
+		{"10/-1s", Limit{}, true},
+		{"10/1ms", Limit{Count: 10, Period: time.Millisecond}, false},
+		{"10/999us", Limit{}, true},
+	}
+	for _, test := range tests {
+		limit, err := ParseLimit(test.str)
+		if test.isErr {
+			if !errors.Is(err, ErrInvalidLimit) {
+				t.Errorf("%q: expected ErrInvalidLimit but received %v", test.str, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.str, err)
+			continue
+		}
+		if limit != test.expected {
+			t.Errorf("%q: expected %v but received %v", test.str, test.expected, limit)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	limit := Limit{Count: 3, Period: time.Minute}
+
+	for i := range 3 {
+		res, _ := s.Take(ctx, "key", limit)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Errorf("take %d: expected allowed with %d remaining but received %+v", i+1, 2-i, res)
+		}
+	}
+	res, _ := s.Take(ctx, "key", limit)
+	if res.Allowed {
+		t.Errorf("expected denied but received %+v", res)
+	}
+	if res.RetryAfter <= 0 || res.RetryAfter > 20*time.Second {
+		t.Errorf("expected retry after in (0, 20s] but received %v", res.RetryAfter)
+	}
+	if res, _ := s.Take(ctx, "other", limit); !res.Allowed {
+		t.Errorf("expected separate bucket for other key but received %+v", res)
+	}
+
+	// Tokens are refilled over time.
+	s.buckets["key"].last = time.Now().Add(-20 * time.Second)
+	if res, _ := s.Take(ctx, "key", limit); !res.Allowed {
+		t.Errorf("expected allowed after refill but received %+v", res)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("store unavailable")
+}
+
+func TestMiddleware(t *testing.T) {
+	conf := Conf{
+		Store: "memory",
+		IP:    map[string]Limit{GroupRedirect: {Count: 2, Period: time.Minute}},
+		User:  map[string]Limit{},
+	}
+	ok := func(res http.ResponseWriter, _ *http.Request) { res.WriteHeader(http.StatusOK) }
+	handler := New(&conf, NewMemoryStore()).ByIP(GroupRedirect, ok)
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, status := range expected {
+		req := httptest.NewRequest(http.MethodGet, "/alias", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		res := httptest.NewRecorder()
+		handler(res, req)
+		if res.Code != status {
+			t.Errorf("request %d: expected status %d but received %d", i+1, status, res.Code)
+		}
+		if res.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("request %d: expected RateLimit-Limit 2 but received %q", i+1, res.Header().Get("RateLimit-Limit"))
+		}
+		if status == http.StatusTooManyRequests && res.Header().Get("Retry-After") == "" {
+			t.Errorf("request %d: expected Retry-After header", i+1)
+		}
+	}
+
+	// Other addresses have their own buckets.
+	req := httptest.NewRequest(http.MethodGet, "/alias", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	res := httptest.NewRecorder()
+	handler(res, req)
+	if res.Code != http.StatusOK {
+		t.Errorf("other address: expected status %d but received %d", http.StatusOK, res.Code)
+	}
+
+	// Groups without a limit are not limited.
+	res = httptest.NewRecorder()
+	New(&conf, NewMemoryStore()).ByIP(GroupAPI, ok)(res, httptest.NewRequest(http.MethodGet, "/api/urls", nil))
+	if res.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("group without limit: unexpected RateLimit-Limit %q", res.Header().Get("RateLimit-Limit"))
+	}
+
+	// An unavailable store does not block requests.
+	handler = New(&conf, failingStore{}).ByIP(GroupRedirect, ok)
+	res = httptest.NewRecorder()
+	handler(res, httptest.NewRequest(http.MethodGet, "/alias", nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("failing store: expected status %d but received %d", http.StatusOK, res.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TokenTaker atomically refills the bucket at count tokens per period
+// and takes a token from it.
+type TokenTaker interface {
+	TakeToken(ctx context.Context, key string, count int, period time.Duration) (float64, bool, error)
+}
+
+// RedisStore keeps token buckets in Redis so that all instances share limits.
+type RedisStore struct {
+	taker TokenTaker
+}
+
+func NewRedisStore(taker TokenTaker) *RedisStore {
+	return &RedisStore{taker: taker}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	tokens, allowed, err := s.taker.TakeToken(ctx, key, limit.Count, limit.Period)
+	if err != nil {
+		return Result{}, fmt.Errorf("take token: %w", err)
+	}
+
+	return result(tokens, allowed, limit), nil
+}
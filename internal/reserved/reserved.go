@@ -0,0 +1,228 @@
+package reserved
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/errcode"
+)
+
+const (
+	defaultReloadInterval = 30 * time.Second
+
+	scanBatchSize = 1000
+)
+
+// Kinds of matching of admin-managed terms.
+const (
+	// MatchExact reserves the alias equal to the term.
+	MatchExact = "exact"
+	// MatchContains rejects every alias containing the term, it is meant
+	// for profanity and brand terms.
+	MatchContains = "contains"
+)
+
+var (
+	ErrInvalidTerm = errors.New("invalid alias term")
+	ErrReserved    = errcode.New("alias_reserved", "alias is reserved")
+)
+
+// builtin are the names of routes and static files of the application,
+// an alias equal to one of them would shadow or be shadowed by it.
+//
+//nolint:gochecknoglobals
+var builtin = []string{
+	"api", "static", "css", "js", "img", "images", "assets",
+	"index", "index.html", "login", "login.html", "dashboard", "dashboard.html",
+	"swagger", "swagger.html", "favicon.ico", "robots.txt", "sitemap.xml",
+	"health", "metrics", "admin", "logout", ".well-known",
+}
+
+type Conf struct {
+	// Aliases reserved in addition to the built-in ones.
+	Aliases []string
+	// How often terms are reloaded from the storage to pick up
+	// changes made through other instances.
+	ReloadInterval time.Duration
+}
+
+// AliasScanner lists the stored aliases in batches.
+type AliasScanner interface {
+	ScanAliases(ctx context.Context, after string, limit uint64) ([]string, error)
+}
+
+type Store interface {
+	CreateAliasTerm(ctx context.Context, term *storage.AliasTerm) (int64, error)
+	GetAliasTerms(ctx context.Context) ([]storage.AliasTerm, error)
+	DeleteAliasTerm(ctx context.Context, id int64) error
+}
+
+type termSet struct {
+	exact    map[string]int64
+	contains []storage.AliasTerm
+}
+
+// Filter rejects aliases that are reserved by the application, by the
+// config or by admins.
+type Filter struct {
+	reloadInterval time.Duration
+	aliases        []string
+	store          Store
+	terms          atomic.Pointer[termSet]
+}
+
+func New(ctx context.Context, conf *Conf, store Store) (*Filter, error) {
+	aliases := slices.Clone(builtin)
+	for _, alias := range conf.Aliases {
+		aliases = append(aliases, strings.ToLower(strings.TrimSpace(alias)))
+	}
+	reloadInterval := conf.ReloadInterval
+	if reloadInterval <= 0 {
+		reloadInterval = defaultReloadInterval
+	}
+	f := &Filter{reloadInterval: reloadInterval, aliases: aliases, store: store}
+	if err := f.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Run reloads terms periodically until the context is canceled.
+func (f *Filter) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Reload(ctx); err != nil {
+				slog.WarnContext(ctx, "Reload alias terms", slog.String("warn", err.Error()))
+			}
+		}
+	}
+}
+
+// Reload replaces the terms in use with the terms from the storage.
+func (f *Filter) Reload(ctx context.Context) error {
+	terms, err := f.store.GetAliasTerms(ctx)
+	if err != nil {
+		return fmt.Errorf("get alias terms: %w", err)
+	}
+	set := termSet{exact: make(map[string]int64)}
+	for _, term := range terms {
+		if term.Match == MatchContains {
+			set.contains = append(set.contains, term)
+		} else {
+			set.exact[term.Term] = term.ID
+		}
+	}
+	f.terms.Store(&set)
+
+	return nil
+}
+
+// Terms returns all admin-managed terms from the storage.
+func (f *Filter) Terms(ctx context.Context) ([]storage.AliasTerm, error) {
+	terms, err := f.store.GetAliasTerms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get alias terms: %w", err)
+	}
+
+	return terms, nil
+}
+
+// AddTerm validates and saves the term and applies it at once.
+func (f *Filter) AddTerm(ctx context.Context, term *storage.AliasTerm) (int64, error) {
+	if term.Match != MatchExact && term.Match != MatchContains {
+		return 0, fmt.Errorf("%w: unknown match %q", ErrInvalidTerm, term.Match)
+	}
+	term.Term = strings.ToLower(strings.TrimSpace(term.Term))
+	if term.Term == "" {
+		return 0, fmt.Errorf("%w: empty term", ErrInvalidTerm)
+	}
+	id, err := f.store.CreateAliasTerm(ctx, term)
+	if err != nil {
+		return 0, fmt.Errorf("create alias term: %w", err)
+	}
+	slog.WarnContext(ctx, "Add alias term",
+		slog.Bool("audit", true),
+		slog.Int64("id", id),
+		slog.String("term", term.Term),
+		slog.String("match", term.Match),
+	)
+
+	return id, f.Reload(ctx)
+}
+
+// DeleteTerm deletes the term and applies the change at once.
+func (f *Filter) DeleteTerm(ctx context.Context, id int64) error {
+	if err := f.store.DeleteAliasTerm(ctx, id); err != nil {
+		return fmt.Errorf("delete alias term: %w", err)
+	}
+	slog.WarnContext(ctx, "Delete alias term", slog.Bool("audit", true), slog.Int64("id", id))
+
+	return f.Reload(ctx)
+}
+
+// CheckAlias returns ErrReserved if the alias must not be used. Aliases are
+// compared case-insensitively and by the first path segment, so "API/x" is
+// reserved as well as "api". Terms matched by containment also ignore
+// separators, so "b-r-a-n-d" contains "brand".
+func (f *Filter) CheckAlias(alias string) error {
+	alias = strings.ToLower(alias)
+	segment, _, _ := strings.Cut(alias, "/")
+	if slices.Contains(f.aliases, alias) || slices.Contains(f.aliases, segment) {
+		return fmt.Errorf("%w: %s", ErrReserved, alias)
+	}
+	set := f.terms.Load()
+	if set == nil {
+		return nil
+	}
+	if id, ok := set.exact[alias]; ok {
+		return fmt.Errorf("%w: %s matches term %d", ErrReserved, alias, id)
+	}
+	if id, ok := set.exact[segment]; ok {
+		return fmt.Errorf("%w: %s matches term %d", ErrReserved, alias, id)
+	}
+	compact := strings.NewReplacer("-", "", "_", "", ".", "", "/", "").Replace(alias)
+	for _, term := range set.contains {
+		if strings.Contains(alias, term.Term) || strings.Contains(compact, term.Term) {
+			return fmt.Errorf("%w: %s matches term %d", ErrReserved, alias, term.ID)
+		}
+	}
+
+	return nil
+}
+
+// Builtin returns the stored aliases shadowed by routes and static files of
+// the application, compared as in CheckAlias. Such links were created before
+// the name became built-in and can not be reached any more.
+func Builtin(ctx context.Context, store AliasScanner) ([]string, error) {
+	var shadowed []string
+	after := ""
+	for {
+		batch, err := store.ScanAliases(ctx, after, scanBatchSize)
+		if err != nil {
+			return shadowed, fmt.Errorf("scan aliases: %w", err)
+		}
+		for _, alias := range batch {
+			segment, _, _ := strings.Cut(strings.ToLower(alias), "/")
+			if slices.Contains(builtin, segment) {
+				shadowed = append(shadowed, alias)
+			}
+		}
+		if len(batch) < scanBatchSize {
+			return shadowed, nil
+		}
+		after = batch[len(batch)-1]
+	}
+}
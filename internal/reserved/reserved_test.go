@@ -0,0 +1,131 @@
+package reserved
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type memoryStore struct {
+	terms  []storage.AliasTerm
+	nextID int64
+}
+
+func (s *memoryStore) CreateAliasTerm(_ context.Context, term *storage.AliasTerm) (int64, error) {
+	for _, t := range s.terms {
+		if t.Term == term.Term && t.Match == term.Match {
+			return 0, storage.ErrAliasTermExists
+		}
+	}
+	s.nextID++
+	t := *term
+	t.ID = s.nextID
+	s.terms = append(s.terms, t)
+
+	return t.ID, nil
+}
+
+func (s *memoryStore) GetAliasTerms(_ context.Context) ([]storage.AliasTerm, error) {
+	return s.terms, nil
+}
+
+func (s *memoryStore) DeleteAliasTerm(_ context.Context, id int64) error {
+	for i, t := range s.terms {
+		if t.ID == id {
+			s.terms = append(s.terms[:i], s.terms[i+1:]...)
+			return nil
+		}
+	}
+	return storage.ErrAliasTermNotFound
+}
+
+type aliasList []string
+
+func (l aliasList) ScanAliases(_ context.Context, after string, limit uint64) ([]string, error) {
+	var aliases []string
+	for _, alias := range l {
+		if alias > after && uint64(len(aliases)) < limit {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases, nil
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	f, err := New(ctx, &Conf{Aliases: []string{" Docs "}}, &memoryStore{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	terms := []storage.AliasTerm{
+		{Term: "Promo", Match: MatchExact},
+		{Term: "acme", Match: MatchContains},
+	}
+	ids := make([]int64, 0, len(terms))
+	for _, term := range terms {
+		id, err := f.AddTerm(ctx, &term)
+		if err != nil {
+			t.Fatalf("add term %q: %v", term.Term, err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		alias    string
+		reserved bool
+	}{
+		{"api", true},
+		{"API", true},
+		{"api/urls", true},
+		{"login.html", true},
+		{"favicon.ico", true},
+		{"check", false},
+		{"stats", false},
+		{"docs", true},
+		{"promo", true},
+		{"promo2", false},
+		{"best-acme-deals", true},
+		{"a-c-m-e", true},
+		{"zn9edcu", false},
+		{"apiary", false},
+	}
+	for _, test := range tests {
+		err := f.CheckAlias(test.alias)
+		if reserved := errors.Is(err, ErrReserved); reserved != test.reserved {
+			t.Errorf("%s: expected reserved %t but received %v", test.alias, test.reserved, err)
+		}
+	}
+
+	if _, err := f.AddTerm(ctx, &storage.AliasTerm{Term: "x", Match: "prefix"}); !errors.Is(err, ErrInvalidTerm) {
+		t.Errorf("expected ErrInvalidTerm for unknown match but received %v", err)
+	}
+	if _, err := f.AddTerm(ctx, &storage.AliasTerm{Term: " ", Match: MatchExact}); !errors.Is(err, ErrInvalidTerm) {
+		t.Errorf("expected ErrInvalidTerm for empty term but received %v", err)
+	}
+	if _, err := f.AddTerm(ctx, &storage.AliasTerm{Term: "acme", Match: MatchContains}); !errors.Is(err, storage.ErrAliasTermExists) {
+		t.Errorf("expected ErrAliasTermExists but received %v", err)
+	}
+
+	if err := f.DeleteTerm(ctx, ids[1]); err != nil {
+		t.Fatalf("delete term: %v", err)
+	}
+	if err := f.CheckAlias("best-acme-deals"); err != nil {
+		t.Errorf("expected alias allowed after deleting the term but received %v", err)
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	aliases := aliasList{"Metrics", "api/x", "check", "metricsx", "promo", "stats"}
+	shadowed, err := Builtin(context.Background(), aliases)
+	if err != nil {
+		t.Fatalf("builtin: %v", err)
+	}
+	expected := []string{"Metrics", "api/x"}
+	if !slices.Equal(shadowed, expected) {
+		t.Errorf("expected %v but received %v", expected, shadowed)
+	}
+}
@@ -0,0 +1,205 @@
+package safety
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultThreat = "malware"
+	// How often the feed file is checked for changes.
+	feedStatInterval = time.Minute
+
+	minPrefixLen = 4
+	maxHosts     = 5
+	maxPaths     = 6
+)
+
+var ErrInvalidFeed = errors.New("invalid threat feed")
+
+// Feed checks urls against a local threat feed file in the style of
+// Safe Browsing. Every line of the file holds a hex encoded prefix (4 to 32
+// bytes) of the SHA-256 hash of a url expression like "evil.example/login"
+// and optionally the threat kind:
+//
+//	# comment
+//	5f2b1a3c phishing
+//	0d6e4079e36703ebd37c00722f5891d28b0e2811dc114b129092d2b1f5d3cd2b
+//
+// The file is reloaded when it changes.
+type Feed struct {
+	path string
+
+	mu       sync.RWMutex
+	prefixes map[int]map[string]string // length in bytes → prefix → threat
+	modTime  time.Time
+	lastStat time.Time
+}
+
+func NewFeed(path string) (*Feed, error) {
+	f := &Feed{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *Feed) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	f.reloadIfChanged(ctx)
+
+	expressions, err := Expressions(rawURL)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, expr := range expressions {
+		sum := sha256.Sum256([]byte(expr))
+		for length, prefixes := range f.prefixes {
+			if threat, ok := prefixes[string(sum[:length])]; ok {
+				return Verdict{Unsafe: true, Threat: threat}, nil
+			}
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+func (f *Feed) reloadIfChanged(ctx context.Context) {
+	f.mu.Lock()
+	now := time.Now()
+	if now.Sub(f.lastStat) < feedStatInterval {
+		f.mu.Unlock()
+		return
+	}
+	f.lastStat = now
+	modTime := f.modTime
+	f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		slog.WarnContext(ctx, "Threat feed", slog.String("warn", err.Error()))
+		return
+	}
+	if info.ModTime().Equal(modTime) {
+		return
+	}
+	if err := f.reload(); err != nil {
+		// Keep the previous feed.
+		slog.WarnContext(ctx, "Threat feed", slog.String("warn", err.Error()))
+		return
+	}
+	slog.InfoContext(ctx, "Reload threat feed", slog.String("path", f.path))
+}
+
+func (f *Feed) reload() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("open threat feed: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat threat feed: %w", err)
+	}
+
+	prefixes := make(map[int]map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		prefix, err := hex.DecodeString(fields[0])
+		if err != nil || len(prefix) < minPrefixLen || len(prefix) > sha256.Size {
+			return fmt.Errorf("%w: line %d: bad hash prefix %q", ErrInvalidFeed, line, fields[0])
+		}
+		threat := defaultThreat
+		if len(fields) > 1 {
+			threat = fields[1]
+		}
+		if prefixes[len(prefix)] == nil {
+			prefixes[len(prefix)] = make(map[string]string)
+		}
+		prefixes[len(prefix)][string(prefix)] = threat
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read threat feed: %w", err)
+	}
+
+	f.mu.Lock()
+	f.prefixes = prefixes
+	f.modTime = info.ModTime()
+	f.lastStat = time.Now()
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Expressions returns the host suffix and path prefix expressions of the
+// url that are looked up in the feed, as Safe Browsing does: the exact host
+// and up to 4 hosts formed from the last 5 components, combined with the
+// exact path with and without the query and up to 4 path prefixes.
+func Expressions(rawURL string) ([]string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	host := strings.Trim(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil, fmt.Errorf("parse url: empty host: %q", rawURL)
+	}
+
+	hosts := []string{host}
+	if _, err := netip.ParseAddr(host); err != nil {
+		components := strings.Split(host, ".")
+		for i := max(1, len(components)-maxHosts); i < len(components)-1; i++ {
+			hosts = append(hosts, strings.Join(components[i:], "."))
+		}
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, cleaned+"?"+u.RawQuery)
+	}
+	paths = append(paths, cleaned)
+	prefix := "/"
+	for _, component := range strings.Split(strings.Trim(cleaned, "/"), "/") {
+		if len(paths) >= maxPaths || prefix == cleaned {
+			break
+		}
+		paths = append(paths, prefix)
+		prefix += component + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			expressions = append(expressions, h+p)
+		}
+	}
+
+	return expressions, nil
+}
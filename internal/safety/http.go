@@ -0,0 +1,78 @@
+package safety
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 2 * time.Second
+	maxResponseSize    = 1 << 16
+)
+
+// HTTP checks urls with a remote service. It posts {"url": "..."} to the
+// endpoint and expects {"unsafe": true, "threat": "phishing"} in response,
+// so a local stand-in is easy to write.
+type HTTP struct {
+	endpoint string
+	client   *http.Client
+}
+
+type requestCheck struct {
+	URL string `json:"url"`
+}
+
+type responseCheck struct {
+	Unsafe bool   `json:"unsafe"`
+	Threat string `json:"threat"`
+}
+
+func NewHTTP(endpoint string, timeout time.Duration) *HTTP {
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	return &HTTP{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout}, //nolint:exhaustruct
+	}
+}
+
+func (h *HTTP) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	body, err := json.Marshal(requestCheck{URL: rawURL})
+	if err != nil {
+		return Verdict{}, fmt.Errorf("marshal check request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("create check request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("check url: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("check url: unexpected status %d", res.StatusCode)
+	}
+	body, err = io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("read check response: %w", err)
+	}
+	var response responseCheck
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Verdict{}, fmt.Errorf("unmarshal check response: %w", err)
+	}
+	if response.Unsafe && response.Threat == "" {
+		response.Threat = defaultThreat
+	}
+
+	return Verdict{Unsafe: response.Unsafe, Threat: response.Threat}, nil
+}
@@ -0,0 +1,79 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mrvin/url-shortener/pkg/errcode"
+)
+
+var ErrUnsafe = errcode.New("unsafe_url", "unsafe url")
+
+type Conf struct {
+	// Local threat feed file with hashed url prefixes, disabled if empty.
+	FeedFile string
+	// Endpoint of the HTTP checker, disabled if empty.
+	HTTPURL     string
+	HTTPTimeout time.Duration
+	// How often existing urls are rechecked, disabled if zero.
+	ScanInterval time.Duration
+}
+
+// Verdict is the result of a url check. Threat is the kind of the threat
+// like "malware" or "phishing" if the url is unsafe.
+type Verdict struct {
+	Unsafe bool
+	Threat string
+}
+
+// Checker checks whether a url is unsafe.
+type Checker interface {
+	Check(ctx context.Context, rawURL string) (Verdict, error)
+}
+
+// New returns a checker consulting every checker enabled in the config.
+func New(conf *Conf) (Checker, error) {
+	var checkers Multi
+	if conf.FeedFile != "" {
+		feed, err := NewFeed(conf.FeedFile)
+		if err != nil {
+			return nil, err
+		}
+		checkers = append(checkers, feed)
+	}
+	if conf.HTTPURL != "" {
+		checkers = append(checkers, NewHTTP(conf.HTTPURL, conf.HTTPTimeout))
+	}
+
+	return checkers, nil
+}
+
+// Multi consults the checkers in order until one of them finds the url unsafe.
+type Multi []Checker
+
+func (m Multi) Check(ctx context.Context, rawURL string) (Verdict, error) {
+	var errs []error
+	for _, checker := range m {
+		verdict, err := checker.Check(ctx, rawURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if verdict.Unsafe {
+			return verdict, nil
+		}
+	}
+
+	return Verdict{}, errors.Join(errs...)
+}
+
+// Err returns ErrUnsafe describing the threat if the verdict is unsafe.
+func (v Verdict) Err() error {
+	if !v.Unsafe {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnsafe, v.Threat)
+}
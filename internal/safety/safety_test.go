@@ -0,0 +1,202 @@
+package safety
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{
+			url: "http://a.b.c/1/2.html?param=1",
+			expected: []string{
+				"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+				"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+			},
+		},
+		{
+			url: "https://A.B.C.D.E.F.G:8443/1.html#frag",
+			expected: []string{
+				"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+				"c.d.e.f.g/1.html", "c.d.e.f.g/",
+				"d.e.f.g/1.html", "d.e.f.g/",
+				"e.f.g/1.html", "e.f.g/",
+				"f.g/1.html", "f.g/",
+			},
+		},
+		{
+			url:      "http://1.2.3.4/a/../b/",
+			expected: []string{"1.2.3.4/b/", "1.2.3.4/"},
+		},
+		{
+			url:      "https://evil.example",
+			expected: []string{"evil.example/"},
+		},
+	}
+	for _, test := range tests {
+		expressions, err := Expressions(test.url)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.url, err)
+			continue
+		}
+		if !slices.Equal(expressions, test.expected) {
+			t.Errorf("%s: expected %q but received %q", test.url, test.expected, expressions)
+		}
+	}
+}
+
+func hashPrefix(expr string, length int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:length])
+}
+
+func TestFeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.txt")
+	data := "# test feed\n" +
+		hashPrefix("evil.example/", 4) + " phishing\n" +
+		hashPrefix("downloads.example/bad/", sha256.Size) + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write feed: %v", err)
+	}
+	feed, err := NewFeed(path)
+	if err != nil {
+		t.Fatalf("new feed: %v", err)
+	}
+
+	tests := []struct {
+		url     string
+		verdict Verdict
+	}{
+		{"https://www.evil.example/login?next=1", Verdict{Unsafe: true, Threat: "phishing"}},
+		{"https://downloads.example/bad/setup.exe", Verdict{Unsafe: true, Threat: "malware"}},
+		{"https://downloads.example/good/setup.exe", Verdict{}},
+		{"https://en.wikipedia.org/wiki/Systems_design", Verdict{}},
+	}
+	for _, test := range tests {
+		verdict, err := feed.Check(context.Background(), test.url)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.url, err)
+			continue
+		}
+		if verdict != test.verdict {
+			t.Errorf("%s: expected %+v but received %+v", test.url, test.verdict, verdict)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("not-hex\n"), 0o600); err != nil {
+		t.Fatalf("write feed: %v", err)
+	}
+	if _, err := NewFeed(path); !errors.Is(err, ErrInvalidFeed) {
+		t.Errorf("expected ErrInvalidFeed but received %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var request requestCheck
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response := responseCheck{}
+		if request.URL == "https://evil.example/" {
+			response = responseCheck{Unsafe: true, Threat: "phishing"}
+		}
+		json.NewEncoder(res).Encode(response)
+	}))
+	defer server.Close()
+
+	checker := NewHTTP(server.URL, 0)
+	if verdict, err := checker.Check(context.Background(), "https://evil.example/"); err != nil || verdict != (Verdict{Unsafe: true, Threat: "phishing"}) {
+		t.Errorf("expected phishing verdict but received %+v, %v", verdict, err)
+	}
+	if verdict, err := checker.Check(context.Background(), "https://example.com/"); err != nil || verdict.Unsafe {
+		t.Errorf("expected safe verdict but received %+v, %v", verdict, err)
+	}
+
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+	if _, err := NewHTTP(failing.URL, 0).Check(context.Background(), "https://example.com/"); err == nil {
+		t.Errorf("expected error on unexpected status")
+	}
+}
+
+type checkerFunc func(rawURL string) (Verdict, error)
+
+func (f checkerFunc) Check(_ context.Context, rawURL string) (Verdict, error) {
+	return f(rawURL)
+}
+
+type memoryURLs struct {
+	urls    []storage.URL
+	flagged map[string]string
+}
+
+func (m *memoryURLs) ScanURLs(_ context.Context, after string, limit uint64) ([]storage.URL, error) {
+	var urls []storage.URL
+	for _, url := range m.urls {
+		if url.Alias > after && m.flagged[url.Alias] == "" && uint64(len(urls)) < limit {
+			urls = append(urls, url)
+		}
+	}
+	return urls, nil
+}
+
+func (m *memoryURLs) FlagURL(_ context.Context, alias, threat string) error {
+	m.flagged[alias] = threat
+	return nil
+}
+
+func (m *memoryURLs) DeleteURL(_ context.Context, _ string) error {
+	return nil
+}
+
+func TestScanner(t *testing.T) {
+	st := &memoryURLs{
+		urls: []storage.URL{
+			{Alias: "a", URL: "https://example.com/"},
+			{Alias: "b", URL: "https://evil.example/"},
+			{Alias: "c", URL: "https://unavailable.example/"},
+			{Alias: "d", URL: "https://example.com/", Targets: []storage.TargetRule{{URL: "https://example.com/ios"}}},
+			{Alias: "e", URL: "https://example.com/", Variants: []storage.Variant{{URL: "https://example.com/a", Weight: 1}, {URL: "https://evil.example/", Weight: 1}}},
+			{Alias: "f", URL: "https://example.com/", Schedule: storage.Schedule{Changes: []storage.ScheduledChange{{URL: "https://unavailable.example/"}, {URL: "https://evil.example/"}}}},
+		},
+		flagged: make(map[string]string),
+	}
+	checker := Multi{
+		checkerFunc(func(rawURL string) (Verdict, error) {
+			if rawURL == "https://unavailable.example/" {
+				return Verdict{}, errors.New("unavailable")
+			}
+			return Verdict{}, nil
+		}),
+		checkerFunc(func(rawURL string) (Verdict, error) {
+			if rawURL == "https://evil.example/" {
+				return Verdict{Unsafe: true, Threat: "phishing"}, nil
+			}
+			return Verdict{}, nil
+		}),
+	}
+
+	flagged, err := NewScanner(checker, st, st, 0).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if flagged != 3 || st.flagged["b"] != "phishing" || st.flagged["e"] != "phishing" || st.flagged["f"] != "phishing" {
+		t.Errorf("expected b, e and f flagged as phishing but received %d: %v", flagged, st.flagged)
+	}
+}
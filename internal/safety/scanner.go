@@ -0,0 +1,116 @@
+package safety
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+const scanBatchSize = 500
+
+type URLScanner interface {
+	ScanURLs(ctx context.Context, after string, limit uint64) ([]storage.URL, error)
+	FlagURL(ctx context.Context, alias, threat string) error
+}
+
+type CacheURLDeleter interface {
+	DeleteURL(ctx context.Context, alias string) error
+}
+
+// Scanner periodically rechecks existing urls and disables the unsafe ones.
+type Scanner struct {
+	checker  Checker
+	st       URLScanner
+	cache    CacheURLDeleter
+	interval time.Duration
+}
+
+func NewScanner(checker Checker, st URLScanner, cache CacheURLDeleter, interval time.Duration) *Scanner {
+	return &Scanner{checker: checker, st: st, cache: cache, interval: interval}
+}
+
+// Run scans all urls every interval until the context is canceled.
+func (s *Scanner) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flagged, err := s.Scan(ctx)
+			if err != nil {
+				slog.WarnContext(ctx, "Safety scan", slog.String("warn", err.Error()))
+			}
+			slog.InfoContext(ctx, "Safety scan", slog.Int("flagged", flagged))
+		}
+	}
+}
+
+// Scan checks all destinations of not flagged urls once and returns the
+// number of urls flagged.
+func (s *Scanner) Scan(ctx context.Context) (int, error) {
+	var flagged int
+	after := ""
+	for {
+		urls, err := s.st.ScanURLs(ctx, after, scanBatchSize)
+		if err != nil {
+			return flagged, fmt.Errorf("scan urls: %w", err)
+		}
+		for _, url := range urls {
+			verdict := s.check(ctx, &url)
+			if !verdict.Unsafe {
+				continue
+			}
+			if err := s.Flag(ctx, url.Alias, verdict.Threat); err != nil {
+				return flagged, err
+			}
+			flagged++
+		}
+		if len(urls) < scanBatchSize {
+			return flagged, nil
+		}
+		after = urls[len(urls)-1].Alias
+	}
+}
+
+// check returns the verdict of the first unsafe destination of the url.
+// A destination the checker fails on is skipped until the next scan.
+func (s *Scanner) check(ctx context.Context, url *storage.URL) Verdict {
+	for _, rawURL := range url.Destinations() {
+		verdict, err := s.checker.Check(ctx, rawURL)
+		if err != nil {
+			slog.WarnContext(ctx, "Safety scan", slog.String("alias", url.Alias), slog.String("warn", err.Error()))
+			continue
+		}
+		if verdict.Unsafe {
+			return verdict
+		}
+	}
+
+	return Verdict{}
+}
+
+// Flag disables the url and drops it from the cache so that the next
+// redirect shows the warning. An empty threat enables the url again.
+func (s *Scanner) Flag(ctx context.Context, alias, threat string) error {
+	if err := s.st.FlagURL(ctx, alias, threat); err != nil {
+		return fmt.Errorf("flag url %s: %w", alias, err)
+	}
+	if err := s.cache.DeleteURL(ctx, alias); err != nil {
+		slog.WarnContext(ctx, "Flag url", slog.String("warn", fmt.Errorf("deleting url from cache: %w", err).Error()))
+	}
+	slog.WarnContext(ctx, "Flag url",
+		slog.Bool("audit", true),
+		slog.String("alias", alias),
+		slog.String("threat", threat),
+	)
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token expired")
+	ErrRevokedToken = errors.New("session token revoked")
+	ErrNoSession    = errors.New("no session in ctx")
+	// ErrUnavailable means the revocation of the session could not be
+	// checked, the token itself may be valid.
+	ErrUnavailable = errors.New("session revocation unavailable")
+)
+
+const (
+	CookieName     = "session"
+	CSRFCookieName = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+const defaultTTL = 24 * time.Hour
+const lenRandom = 32
+
+type contextKey int
+
+const contextKeyClaims contextKey = iota
+
+type Conf struct {
+	Secret       string
+	TTL          time.Duration
+	CookieSecure bool
+}
+
+// Revoker keeps track of revoked sessions and of the moments before which
+// all sessions of a user are revoked, until the sessions expire.
+type Revoker interface {
+	RevokeSession(ctx context.Context, id string, ttl time.Duration) error
+	IsSessionRevoked(ctx context.Context, id string) (bool, error)
+	RevokeUserSessions(ctx context.Context, username string, before time.Time, ttl time.Duration) error
+	UserSessionsRevokedBefore(ctx context.Context, username string) (time.Time, error)
+}
+
+//nolint:tagliatelle
+type Claims struct {
+	ID       string `json:"jti"`
+	Username string `json:"sub"`
+	Role     string `json:"role"`
+	CSRF     string `json:"csrf"`
+	// IssuedAt is in Unix nanoseconds, so that a session issued in the same
+	// second as a revocation of all sessions of the user is told apart.
+	IssuedAt  int64 `json:"iat_ns"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+type Session struct {
+	Token  string
+	Claims Claims
+}
+
+// Manager issues and verifies HMAC-SHA256 signed session tokens.
+// A token is "base64url(claims).base64url(signature)".
+type Manager struct {
+	secret       []byte
+	ttl          time.Duration
+	cookieSecure bool
+
+	revoker Revoker
+}
+
+func New(conf *Conf, revoker Revoker) (*Manager, error) {
+	secret := []byte(conf.Secret)
+	if len(secret) == 0 {
+		slog.Warn("Empty session secret, using random one: sessions will not survive restart")
+		var err error
+		secret, err = randomBytes(lenRandom)
+		if err != nil {
+			return nil, fmt.Errorf("generate session secret: %w", err)
+		}
+	}
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &Manager{
+		secret:       secret,
+		ttl:          ttl,
+		cookieSecure: conf.CookieSecure,
+		revoker:      revoker,
+	}, nil
+}
+
+// Issue creates a new session for the user.
+func (m *Manager) Issue(_ context.Context, username, role string) (*Session, error) {
+	id, err := randomString()
+	if err != nil {
+		return nil, fmt.Errorf("generate session id: %w", err)
+	}
+	csrf, err := randomString()
+	if err != nil {
+		return nil, fmt.Errorf("generate csrf token: %w", err)
+	}
+	now := time.Now()
+	claims := Claims{
+		ID:        id,
+		Username:  username,
+		Role:      role,
+		CSRF:      csrf,
+		IssuedAt:  now.UnixNano(),
+		ExpiresAt: now.Add(m.ttl).Unix(),
+	}
+	token, err := m.sign(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{Token: token, Claims: claims}, nil
+}
+
+// Parse verifies the signature and expiry of the token and checks that
+// neither the session nor all sessions of the user have been revoked.
+func (m *Manager) Parse(ctx context.Context, token string) (*Claims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(sig, m.mac(payload)) {
+		return nil, ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	revoked, err := m.revoker.IsSessionRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: check session revocation: %w", ErrUnavailable, err)
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+	before, err := m.revoker.UserSessionsRevokedBefore(ctx, claims.Username)
+	if err != nil {
+		return nil, fmt.Errorf("%w: check user sessions revocation: %w", ErrUnavailable, err)
+	}
+	if !before.IsZero() && claims.IssuedAt < before.UnixNano() {
+		return nil, ErrRevokedToken
+	}
+
+	return &claims, nil
+}
+
+// Refresh revokes the current session and issues a new one for the same
+// user with the role, which is the current role of the user rather than
+// the one in the claims.
+func (m *Manager) Refresh(ctx context.Context, claims *Claims, role string) (*Session, error) {
+	if err := m.Revoke(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return m.Issue(ctx, claims.Username, role)
+}
+
+// Revoke invalidates the session until its expiry.
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if ttl <= 0 {
+		return nil
+	}
+	if err := m.revoker.RevokeSession(ctx, claims.ID, ttl); err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUser invalidates all sessions of the user issued before now.
+func (m *Manager) RevokeUser(ctx context.Context, username string) error {
+	// No session issued before now outlives the ttl.
+	if err := m.revoker.RevokeUserSessions(ctx, username, time.Now(), m.ttl); err != nil {
+		return fmt.Errorf("revoke user sessions: %w", err)
+	}
+
+	return nil
+}
+
+// SetCookies writes the HttpOnly session cookie and the CSRF cookie readable by scripts.
+func (m *Manager) SetCookies(res http.ResponseWriter, s *Session) {
+	expires := time.Unix(s.Claims.ExpiresAt, 0)
+	http.SetCookie(res, &http.Cookie{ //nolint:exhaustruct
+		Name:     CookieName,
+		Value:    s.Token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   m.cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(res, &http.Cookie{ //nolint:exhaustruct
+		Name:     CSRFCookieName,
+		Value:    s.Claims.CSRF,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: false,
+		Secure:   m.cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearCookies removes the session and CSRF cookies.
+func (m *Manager) ClearCookies(res http.ResponseWriter) {
+	for _, name := range []string{CookieName, CSRFCookieName} {
+		http.SetCookie(res, &http.Cookie{ //nolint:exhaustruct
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == CookieName,
+			Secure:   m.cookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// CheckCSRF compares the CSRF token from the request with the one bound to the session.
+func CheckCSRF(claims *Claims, token string) bool {
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(claims.CSRF), []byte(token)) == 1
+}
+
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKeyClaims, claims)
+}
+
+func GetClaimsFromCtx(ctx context.Context) (*Claims, error) {
+	if ctx == nil {
+		return nil, errors.New("ctx is nil")
+	}
+	claims, ok := ctx.Value(contextKeyClaims).(*Claims)
+	if !ok {
+		return nil, ErrNoSession
+	}
+
+	return claims, nil
+}
+
+func (m *Manager) sign(claims *Claims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(m.mac(payload)), nil
+}
+
+func (m *Manager) mac(payload string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("read random: %w", err)
+	}
+	return b, nil
+}
+
+func randomString() (string, error) {
+	b, err := randomBytes(lenRandom)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,156 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memRevoker struct {
+	sessions map[string]struct{}
+	users    map[string]time.Time
+}
+
+func newMemRevoker() *memRevoker {
+	return &memRevoker{sessions: make(map[string]struct{}), users: make(map[string]time.Time)}
+}
+
+func (r *memRevoker) RevokeSession(_ context.Context, id string, _ time.Duration) error {
+	r.sessions[id] = struct{}{}
+	return nil
+}
+
+func (r *memRevoker) IsSessionRevoked(_ context.Context, id string) (bool, error) {
+	_, ok := r.sessions[id]
+	return ok, nil
+}
+
+func (r *memRevoker) RevokeUserSessions(_ context.Context, username string, before time.Time, _ time.Duration) error {
+	r.users[username] = before
+	return nil
+}
+
+func (r *memRevoker) UserSessionsRevokedBefore(_ context.Context, username string) (time.Time, error) {
+	return r.users[username], nil
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(&Conf{Secret: "secret", TTL: time.Hour}, newMemRevoker())
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+
+	sess, err := m.Issue(ctx, "Bob", "user")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	t.Run("Success parse", func(t *testing.T) {
+		claims, err := m.Parse(ctx, sess.Token)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if claims.Username != "Bob" || claims.Role != "user" || claims.CSRF != sess.Claims.CSRF {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("Error tampered token", func(t *testing.T) {
+		payload, sig, _ := strings.Cut(sess.Token, ".")
+		if _, err := m.Parse(ctx, payload+"x."+sig); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected %v but received %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("Error foreign secret", func(t *testing.T) {
+		other, _ := New(&Conf{Secret: "other", TTL: time.Hour}, newMemRevoker())
+		if _, err := other.Parse(ctx, sess.Token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected %v but received %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("Error expired token", func(t *testing.T) {
+		expired, _ := m.sign(&Claims{ID: "id", Username: "Bob", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+		if _, err := m.Parse(ctx, expired); !errors.Is(err, ErrExpiredToken) {
+			t.Errorf("expected %v but received %v", ErrExpiredToken, err)
+		}
+	})
+
+	t.Run("Refresh revokes old session", func(t *testing.T) {
+		s, _ := m.Issue(ctx, "Alice", "admin")
+		refreshed, err := m.Refresh(ctx, &s.Claims, "user")
+		if err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if _, err := m.Parse(ctx, s.Token); !errors.Is(err, ErrRevokedToken) {
+			t.Errorf("expected %v but received %v", ErrRevokedToken, err)
+		}
+		claims, err := m.Parse(ctx, refreshed.Token)
+		if err != nil {
+			t.Fatalf("parse refreshed: %v", err)
+		}
+		if claims.Role != "user" {
+			t.Errorf(`expected role "user" but received "%s"`, claims.Role)
+		}
+	})
+
+	t.Run("Revoke all sessions of user", func(t *testing.T) {
+		now := time.Now()
+		old, _ := m.sign(&Claims{ID: "old", Username: "Carol", IssuedAt: now.Add(-time.Minute).UnixNano(), ExpiresAt: now.Add(time.Hour).Unix()})
+		// Issued just before the revocation, most likely in the same second.
+		recent, _ := m.sign(&Claims{ID: "recent", Username: "Carol", IssuedAt: now.UnixNano(), ExpiresAt: now.Add(time.Hour).Unix()})
+		other, _ := m.sign(&Claims{ID: "other", Username: "Dave", IssuedAt: now.Add(-time.Minute).UnixNano(), ExpiresAt: now.Add(time.Hour).Unix()})
+		time.Sleep(time.Microsecond)
+		if err := m.RevokeUser(ctx, "Carol"); err != nil {
+			t.Fatalf("revoke user: %v", err)
+		}
+		for _, token := range []string{old, recent} {
+			if _, err := m.Parse(ctx, token); !errors.Is(err, ErrRevokedToken) {
+				t.Errorf("expected %v but received %v", ErrRevokedToken, err)
+			}
+		}
+		if _, err := m.Parse(ctx, other); err != nil {
+			t.Errorf("parse session of other user: %v", err)
+		}
+		s, _ := m.Issue(ctx, "Carol", "user")
+		if _, err := m.Parse(ctx, s.Token); err != nil {
+			t.Errorf("parse session issued after revocation: %v", err)
+		}
+	})
+}
+
+type failingRevoker struct {
+	*memRevoker
+}
+
+func (failingRevoker) IsSessionRevoked(_ context.Context, _ string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestParseUnavailable(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(&Conf{Secret: "secret", TTL: time.Hour}, failingRevoker{newMemRevoker()})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	sess, err := m.Issue(ctx, "Bob", "user")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if _, err := m.Parse(ctx, sess.Token); !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected %v but received %v", ErrUnavailable, err)
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	claims := &Claims{CSRF: "csrf"}
+	if !CheckCSRF(claims, "csrf") {
+		t.Error("expected valid csrf token")
+	}
+	if CheckCSRF(claims, "") || CheckCSRF(claims, "other") {
+		t.Error("expected invalid csrf token")
+	}
+}
@@ -3,15 +3,18 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/jackc/pgx/v5/pgconn"
 	// Import pgx driver for database/sql.
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/mrvin/url-shortener/internal/storage"
 	"github.com/mrvin/url-shortener/pkg/retry"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 )
 
 const maxOpenConns = 25
@@ -33,18 +36,61 @@ type Storage struct {
 
 	conf *Conf
 
-	insertUser *sql.Stmt
-	selectUser *sql.Stmt
+	insertUser     *sql.Stmt
+	selectUser     *sql.Stmt
+	updatePassword *sql.Stmt
+	updateRole     *sql.Stmt
 
 	insertURL      *sql.Stmt
 	selectURL      *sql.Stmt
+	selectURLInfo  *sql.Stmt
+	selectUserURL  *sql.Stmt
+	updateURL      *sql.Stmt
+	flagURL        *sql.Stmt
+	setMetadata    *sql.Stmt
+	setHealth      *sql.Stmt
 	countIncrement *sql.Stmt
+	countCountry   *sql.Stmt
+	countVariant   *sql.Stmt
 	deleteURL      *sql.Stmt
 
-	selectURLs      *sql.Stmt
-	selectTotalURLs *sql.Stmt
+	selectURLs          *sql.Stmt
+	selectTotalURLs     *sql.Stmt
+	selectCampaignStats *sql.Stmt
+	scanURLs            *sql.Stmt
+	scanHealth          *sql.Stmt
 
 	existsAlias *sql.Stmt
+	selectAlias *sql.Stmt
+	scanAliases *sql.Stmt
+	renameAlias *sql.Stmt
+
+	insertHostRule  *sql.Stmt
+	selectHostRules *sql.Stmt
+	deleteHostRule  *sql.Stmt
+
+	insertAliasTerm  *sql.Stmt
+	selectAliasTerms *sql.Stmt
+	deleteAliasTerm  *sql.Stmt
+
+	selectUTMDefaults *sql.Stmt
+	upsertUTMDefaults *sql.Stmt
+
+	insertWebhook      *sql.Stmt
+	selectWebhooks     *sql.Stmt
+	selectWebhook      *sql.Stmt
+	deleteWebhook      *sql.Stmt
+	enqueueEvent       *sql.Stmt
+	selectDeliveries   *sql.Stmt
+	redeliver          *sql.Stmt
+	claimDeliveries    *sql.Stmt
+	setDeliveryResult  *sql.Stmt
+	releaseDelivery    *sql.Stmt
+	deleteDeliveries   *sql.Stmt
+	selectClicksCross  *sql.Stmt
+	setClicksNotified  *sql.Stmt
+	selectExpiredURLs  *sql.Stmt
+	setExpiredNotified *sql.Stmt
 }
 
 func New(ctx context.Context, conf *Conf) (*Storage, error) {
@@ -63,7 +109,11 @@ func New(ctx context.Context, conf *Conf) (*Storage, error) {
 }
 
 func (s *Storage) CreateUser(ctx context.Context, user *storage.User) error {
-	if _, err := s.insertUser.ExecContext(ctx, user.Name, user.HashPassword, user.Role); err != nil {
+	provider := user.Provider
+	if provider == "" {
+		provider = storage.ProviderLocal
+	}
+	if _, err := s.insertUser.ExecContext(ctx, user.Name, user.HashPassword, user.Role, provider); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			// unique_violation SQLSTATE
@@ -72,144 +122,1088 @@ func (s *Storage) CreateUser(ctx context.Context, user *storage.User) error {
 			}
 		}
 
-		return fmt.Errorf("insert user: %w", err)
+		return fmt.Errorf("insert user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, name string) (*storage.User, error) {
+	var user storage.User
+
+	if err := s.selectUser.QueryRowContext(ctx, name).Scan(&user.HashPassword, &user.Role, &user.Provider); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("can't scan user with name: %s: %w", name, err)
+	}
+	user.Name = name
+
+	return &user, nil
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, name, hashPassword string) error {
+	res, err := s.updatePassword.ExecContext(ctx, name, hashPassword)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateRole(ctx context.Context, name, role string) error {
+	res, err := s.updateRole.ExecContext(ctx, name, role)
+	if err != nil {
+		return fmt.Errorf("update role: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update role: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateURL(ctx context.Context, username, alias string, target *storage.Target) error {
+	targets, err := marshalList(target.Targets)
+	if err != nil {
+		return err
+	}
+	variants, err := marshalList(target.Variants)
+	if err != nil {
+		return err
+	}
+	changes, err := marshalList(target.Changes)
+	if err != nil {
+		return err
+	}
+	if _, err := s.insertURL.ExecContext(ctx, target.URL, alias, username, target.RedirectType, target.ForwardQuery, target.ForwardPath,
+		target.Source, target.Medium, target.Campaign, target.Term, target.Content, target.Title, targets, variants, target.Sticky,
+		target.ActiveFrom, target.ActiveUntil, changes); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storage.ErrAliasExists
+			}
+		}
+		return fmt.Errorf("insert url: %w", err)
+	}
+
+	return nil
+}
+
+// GetURL returns the target of the alias. The click is counted separately
+// with CountIncrement once it is redirected.
+func (s *Storage) GetURL(ctx context.Context, alias string) (*storage.Target, error) {
+	var target storage.Target
+	var targets, variants, changes []byte
+
+	err := s.selectURL.QueryRowContext(ctx, alias).Scan(
+		&target.URL,
+		&target.Threat,
+		&target.RedirectType,
+		&target.ForwardQuery,
+		&target.ForwardPath,
+		&target.Source,
+		&target.Medium,
+		&target.Campaign,
+		&target.Term,
+		&target.Content,
+		&targets,
+		&variants,
+		&target.Sticky,
+		&target.ActiveFrom,
+		&target.ActiveUntil,
+		&changes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrAliasNotFound
+		}
+		return nil, fmt.Errorf("can't scan URL with alias: %s: %w", alias, err)
+	}
+	if target.Targets, err = unmarshalList[storage.TargetRule](targets); err != nil {
+		return nil, err
+	}
+	if target.Variants, err = unmarshalList[storage.Variant](variants); err != nil {
+		return nil, err
+	}
+	if target.Changes, err = unmarshalList[storage.ScheduledChange](changes); err != nil {
+		return nil, err
+	}
+
+	return &target, nil
+}
+
+// GetURLInfo returns the url with its settings without counting a click.
+func (s *Storage) GetURLInfo(ctx context.Context, alias string) (*storage.URL, error) {
+	var url storage.URL
+	var targets, variants, changes []byte
+	var metadata storage.Metadata
+	var fetchedAt sql.NullTime
+	var health storage.Health
+	var checkedAt sql.NullTime
+	err := s.selectURLInfo.QueryRowContext(ctx, alias).Scan(
+		&url.URL,
+		&url.Alias,
+		&url.Count,
+		&url.CreatedAt,
+		&url.Threat,
+		&url.RedirectType,
+		&url.ForwardQuery,
+		&url.ForwardPath,
+		&url.Source,
+		&url.Medium,
+		&url.Campaign,
+		&url.Term,
+		&url.Content,
+		&url.Title,
+		&targets,
+		&variants,
+		&url.Sticky,
+		&url.ActiveFrom,
+		&url.ActiveUntil,
+		&changes,
+		&metadata.Title,
+		&metadata.Description,
+		&metadata.Image,
+		&metadata.Favicon,
+		&fetchedAt,
+		&health.Status,
+		&health.LatencyMS,
+		&health.Error,
+		&checkedAt,
+		&health.Broken,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrAliasNotFound
+		}
+		return nil, fmt.Errorf("can't scan URL info with alias: %s: %w", alias, err)
+	}
+	if url.Targets, err = unmarshalList[storage.TargetRule](targets); err != nil {
+		return nil, err
+	}
+	if url.Variants, err = unmarshalList[storage.Variant](variants); err != nil {
+		return nil, err
+	}
+	if url.Changes, err = unmarshalList[storage.ScheduledChange](changes); err != nil {
+		return nil, err
+	}
+	url.Metadata = fetched(&metadata, fetchedAt)
+	url.Health = checked(&health, checkedAt)
+
+	return &url, nil
+}
+
+// GetUserURL returns the destination of the alias if it belongs to the user.
+func (s *Storage) GetUserURL(ctx context.Context, username, alias string) (string, error) {
+	var url string
+	if err := s.selectUserURL.QueryRowContext(ctx, username, alias).Scan(&url); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.ErrAliasNotFound
+		}
+		return "", fmt.Errorf("can't scan URL of user: %s with alias: %s: %w", username, alias, err)
+	}
+
+	return url, nil
+}
+
+func (s *Storage) UpdateURL(ctx context.Context, username, alias string, target *storage.Target) error {
+	targets, err := marshalList(target.Targets)
+	if err != nil {
+		return err
+	}
+	variants, err := marshalList(target.Variants)
+	if err != nil {
+		return err
+	}
+	changes, err := marshalList(target.Changes)
+	if err != nil {
+		return err
+	}
+	res, err := s.updateURL.ExecContext(ctx, username, alias, target.URL, target.RedirectType, target.ForwardQuery, target.ForwardPath,
+		target.Source, target.Medium, target.Campaign, target.Term, target.Content, target.Title, targets, variants, target.Sticky,
+		target.ActiveFrom, target.ActiveUntil, changes)
+	if err != nil {
+		return fmt.Errorf("update url: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update url: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+// FlagURL disables the url as unsafe. An empty threat enables it again.
+func (s *Storage) FlagURL(ctx context.Context, alias, threat string) error {
+	res, err := s.flagURL.ExecContext(ctx, alias, threat)
+	if err != nil {
+		return fmt.Errorf("flag url: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("flag url: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+// SetMetadata stores the metadata of the destination page. It fails with
+// ErrAliasNotFound if the alias was deleted or now leads to another url.
+func (s *Storage) SetMetadata(ctx context.Context, alias, url string, metadata *storage.Metadata) error {
+	res, err := s.setMetadata.ExecContext(ctx, alias, url,
+		metadata.Title, metadata.Description, metadata.Image, metadata.Favicon, metadata.FetchedAt)
+	if err != nil {
+		return fmt.Errorf("set metadata: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set metadata: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+// SetHealth stores the result of the check of the destination. It fails with
+// ErrAliasNotFound if the alias was deleted or now leads to another url.
+func (s *Storage) SetHealth(ctx context.Context, alias, url string, health *storage.Health) error {
+	res, err := s.setHealth.ExecContext(ctx, alias, url,
+		health.Status, health.LatencyMS, health.Error, health.CheckedAt, health.Broken)
+	if err != nil {
+		return fmt.Errorf("set health: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set health: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) CountIncrement(alias string) error {
+	res, err := s.countIncrement.Exec(alias) //nolint:noctx
+	if err != nil {
+		return fmt.Errorf("count increment: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("count increment: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+// CountCountry counts a click of the alias from the country.
+func (s *Storage) CountCountry(alias, country string) error {
+	if _, err := s.countCountry.Exec(alias, country); err != nil { //nolint:noctx
+		return fmt.Errorf("count country: %w", err)
+	}
+
+	return nil
+}
+
+// CountVariant counts a click of the alias sent to the url of a variant.
+func (s *Storage) CountVariant(alias, url string) error {
+	if _, err := s.countVariant.Exec(alias, url); err != nil { //nolint:noctx
+		return fmt.Errorf("count variant: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, username, alias string) error {
+	res, err := s.deleteURL.ExecContext(ctx, username, alias)
+	if err != nil {
+		return fmt.Errorf("delete url: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete url: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) GetURLs(ctx context.Context, username string, filter *storage.URLFilter, limit, offset uint64) ([]storage.URL, uint64, error) {
+	urls := make([]storage.URL, 0)
+
+	rows, err := s.selectURLs.QueryContext(ctx, username, limit, offset,
+		filter.Source, filter.Medium, filter.Campaign, filter.Term, filter.Content, filter.Broken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return urls, 0, nil
+		}
+		return nil, 0, fmt.Errorf("can't get rows urls: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var url storage.URL
+		var targets, variants, changes []byte
+		var metadata storage.Metadata
+		var fetchedAt sql.NullTime
+		var health storage.Health
+		var checkedAt sql.NullTime
+		var countries []byte
+		err = rows.Scan(
+			&url.URL,
+			&url.Alias,
+			&url.Count,
+			&url.CreatedAt,
+			&url.Threat,
+			&url.RedirectType,
+			&url.ForwardQuery,
+			&url.ForwardPath,
+			&url.Source,
+			&url.Medium,
+			&url.Campaign,
+			&url.Term,
+			&url.Content,
+			&url.Title,
+			&targets,
+			&variants,
+			&url.Sticky,
+			&url.ActiveFrom,
+			&url.ActiveUntil,
+			&changes,
+			&metadata.Title,
+			&metadata.Description,
+			&metadata.Image,
+			&metadata.Favicon,
+			&fetchedAt,
+			&health.Status,
+			&health.LatencyMS,
+			&health.Error,
+			&checkedAt,
+			&health.Broken,
+			&countries,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("can't scan next row: %w", err)
+		}
+		if url.Targets, err = unmarshalList[storage.TargetRule](targets); err != nil {
+			return nil, 0, err
+		}
+		if url.Variants, err = unmarshalList[storage.Variant](variants); err != nil {
+			return nil, 0, err
+		}
+		if url.Changes, err = unmarshalList[storage.ScheduledChange](changes); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(countries, &url.Countries); err != nil {
+			return nil, 0, fmt.Errorf("unmarshal countries: %w", err)
+		}
+		if len(url.Countries) == 0 {
+			url.Countries = nil
+		}
+		url.Metadata = fetched(&metadata, fetchedAt)
+		url.Health = checked(&health, checkedAt)
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows error: %w", err)
+	}
+
+	var total uint64
+	err = s.selectTotalURLs.QueryRowContext(ctx, username,
+		filter.Source, filter.Medium, filter.Campaign, filter.Term, filter.Content, filter.Broken).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't scan total urls: %w", err)
+	}
+
+	return urls, total, nil
+}
+
+// ScanURLs returns up to limit not flagged urls with aliases after
+// the given one in alias order, to walk all urls in batches. Targets,
+// variants and the schedule are filled in to check all destinations.
+func (s *Storage) ScanURLs(ctx context.Context, after string, limit uint64) ([]storage.URL, error) {
+	urls := make([]storage.URL, 0)
+
+	rows, err := s.scanURLs.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows urls: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var url storage.URL
+		var targets, variants, changes []byte
+		if err := rows.Scan(&url.URL, &url.Alias, &targets, &variants, &changes); err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		if url.Targets, err = unmarshalList[storage.TargetRule](targets); err != nil {
+			return nil, err
+		}
+		if url.Variants, err = unmarshalList[storage.Variant](variants); err != nil {
+			return nil, err
+		}
+		if url.Changes, err = unmarshalList[storage.ScheduledChange](changes); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return urls, nil
+}
+
+// ScanHealth returns up to limit not flagged links with aliases after the
+// given one in alias order, to check the health of all destinations in
+// batches. The urls of targets, variants and the schedule are filled in too.
+func (s *Storage) ScanHealth(ctx context.Context, after string, limit uint64) ([]storage.HealthState, error) {
+	states := make([]storage.HealthState, 0)
+
+	rows, err := s.scanHealth.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows health: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state storage.HealthState
+		var url storage.URL
+		var targets, variants, changes []byte
+		if err := rows.Scan(&state.Alias, &state.URL, &state.Username, &state.Broken, &targets, &variants, &changes); err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		if url.Targets, err = unmarshalList[storage.TargetRule](targets); err != nil {
+			return nil, err
+		}
+		if url.Variants, err = unmarshalList[storage.Variant](variants); err != nil {
+			return nil, err
+		}
+		if url.Changes, err = unmarshalList[storage.ScheduledChange](changes); err != nil {
+			return nil, err
+		}
+		state.Destinations = url.Destinations()[1:]
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return states, nil
+}
+
+func (s *Storage) CheckAlias(ctx context.Context, alias string) (bool, error) {
+	var exists bool
+	if err := s.existsAlias.QueryRowContext(ctx, alias).Scan(&exists); err != nil {
+		return false, fmt.Errorf("exists alias: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetAliasByURL returns the oldest plain link of the user leading to the url
+// of the target with the same redirect type, forwarding of the query and the
+// path, title and campaign parameters.
+// Links with targets, variants, an activation window or a schedule are never
+// returned: they may lead elsewhere or nowhere at the moment.
+func (s *Storage) GetAliasByURL(ctx context.Context, username string, target *storage.Target) (string, error) {
+	var alias string
+	err := s.selectAlias.QueryRowContext(ctx, username, target.URL, target.RedirectType, target.Title,
+		target.ForwardQuery, target.ForwardPath, target.Source, target.Medium, target.Campaign, target.Term, target.Content).Scan(&alias)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", storage.ErrURLNotFound
+		}
+		return "", fmt.Errorf("can't scan alias of url: %s: %w", target.URL, err)
+	}
+
+	return alias, nil
+}
+
+// ScanAliases returns up to limit aliases after the given one in alias
+// order, to walk all aliases in batches.
+func (s *Storage) ScanAliases(ctx context.Context, after string, limit uint64) ([]string, error) {
+	aliases := make([]string, 0)
+
+	rows, err := s.scanAliases.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows aliases: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// RenameAlias changes the alias of the url, the clicks by country and by
+// variant follow it. It fails with ErrAliasExists if the new alias is taken.
+func (s *Storage) RenameAlias(ctx context.Context, alias, newAlias string) error {
+	res, err := s.renameAlias.ExecContext(ctx, alias, newAlias)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return storage.ErrAliasExists
+			}
+		}
+		return fmt.Errorf("rename alias: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rename alias: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) GetCampaignStats(ctx context.Context, username string, filter *storage.UTM) ([]storage.CampaignStats, error) {
+	stats := make([]storage.CampaignStats, 0)
+
+	rows, err := s.selectCampaignStats.QueryContext(ctx, username,
+		filter.Source, filter.Medium, filter.Campaign, filter.Term, filter.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows campaign stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var campaign storage.CampaignStats
+		err = rows.Scan(
+			&campaign.Source,
+			&campaign.Medium,
+			&campaign.Campaign,
+			&campaign.Links,
+			&campaign.Clicks,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		stats = append(stats, campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetUTMDefaults returns the campaign parameters applied to new links of the
+// user, all empty if the user has not set them.
+func (s *Storage) GetUTMDefaults(ctx context.Context, username string) (*storage.UTM, error) {
+	var defaults storage.UTM
+	err := s.selectUTMDefaults.QueryRowContext(ctx, username).Scan(
+		&defaults.Source,
+		&defaults.Medium,
+		&defaults.Campaign,
+		&defaults.Term,
+		&defaults.Content,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("can't scan utm defaults of user: %s: %w", username, err)
+	}
+
+	return &defaults, nil
+}
+
+func (s *Storage) SetUTMDefaults(ctx context.Context, username string, defaults *storage.UTM) error {
+	_, err := s.upsertUTMDefaults.ExecContext(ctx, username,
+		defaults.Source, defaults.Medium, defaults.Campaign, defaults.Term, defaults.Content)
+	if err != nil {
+		return fmt.Errorf("upsert utm defaults: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateHostRule(ctx context.Context, rule *storage.HostRule) (int64, error) {
+	var id int64
+	if err := s.insertHostRule.QueryRowContext(ctx, rule.List, rule.Type, rule.Pattern, rule.CreatedBy).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return 0, storage.ErrHostRuleExists
+			}
+		}
+		return 0, fmt.Errorf("insert host rule: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetHostRules(ctx context.Context) ([]storage.HostRule, error) {
+	rules := make([]storage.HostRule, 0)
+
+	rows, err := s.selectHostRules.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows host rules: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule storage.HostRule
+		err = rows.Scan(
+			&rule.ID,
+			&rule.List,
+			&rule.Type,
+			&rule.Pattern,
+			&rule.CreatedBy,
+			&rule.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (s *Storage) DeleteHostRule(ctx context.Context, id int64) error {
+	res, err := s.deleteHostRule.ExecContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("delete host rule: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete host rule: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrHostRuleNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateAliasTerm(ctx context.Context, term *storage.AliasTerm) (int64, error) {
+	var id int64
+	if err := s.insertAliasTerm.QueryRowContext(ctx, term.Term, term.Match, term.CreatedBy).Scan(&id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return 0, storage.ErrAliasTermExists
+			}
+		}
+		return 0, fmt.Errorf("insert alias term: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetAliasTerms(ctx context.Context) ([]storage.AliasTerm, error) {
+	terms := make([]storage.AliasTerm, 0)
+
+	rows, err := s.selectAliasTerms.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows alias terms: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var term storage.AliasTerm
+		err = rows.Scan(
+			&term.ID,
+			&term.Term,
+			&term.Match,
+			&term.CreatedBy,
+			&term.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		terms = append(terms, term)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return terms, nil
+}
+
+func (s *Storage) DeleteAliasTerm(ctx context.Context, id int64) error {
+	res, err := s.deleteAliasTerm.ExecContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("delete alias term: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete alias term: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrAliasTermNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, webhook *storage.Webhook) (int64, error) {
+	events, err := marshalList(webhook.Events)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := s.insertWebhook.QueryRowContext(ctx, webhook.Username, webhook.URL, webhook.Secret, events).Scan(&id); err != nil {
+		return 0, fmt.Errorf("insert webhook: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetWebhooks(ctx context.Context, username string) ([]storage.Webhook, error) {
+	webhooks := make([]storage.Webhook, 0)
+
+	rows, err := s.selectWebhooks.QueryContext(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook storage.Webhook
+		var events []byte
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &events, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
+		}
+		if webhook.Events, err = unmarshalList[string](events); err != nil {
+			return nil, err
+		}
+		webhook.Username = username
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook returns the webhook if it belongs to the user.
+func (s *Storage) GetWebhook(ctx context.Context, username string, id int64) (*storage.Webhook, error) {
+	var webhook storage.Webhook
+	var events []byte
+	err := s.selectWebhook.QueryRowContext(ctx, username, id).Scan(&webhook.URL, &webhook.Secret, &events, &webhook.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("can't scan webhook with id: %d: %w", id, err)
+	}
+	if webhook.Events, err = unmarshalList[string](events); err != nil {
+		return nil, err
+	}
+	webhook.ID = id
+	webhook.Username = username
+
+	return &webhook, nil
+}
+
+func (s *Storage) DeleteWebhook(ctx context.Context, username string, id int64) error {
+	res, err := s.deleteWebhook.ExecContext(ctx, username, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueEvent queues the payload for every webhook of the user subscribed
+// to the event.
+func (s *Storage) EnqueueEvent(ctx context.Context, username, event string, payload []byte) error {
+	if _, err := s.enqueueEvent.ExecContext(ctx, username, event, string(payload)); err != nil {
+		return fmt.Errorf("enqueue event: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Storage) GetUser(ctx context.Context, name string) (*storage.User, error) {
-	var user storage.User
+// GetDeliveries returns the deliveries of the webhook of the user, the newest
+// first.
+func (s *Storage) GetDeliveries(ctx context.Context, username string, webhookID int64, limit, offset uint64) ([]storage.Delivery, error) {
+	deliveries := make([]storage.Delivery, 0)
 
-	if err := s.selectUser.QueryRowContext(ctx, name).Scan(&user.HashPassword, &user.Role); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, storage.ErrUserNotFound
+	rows, err := s.selectDeliveries.QueryContext(ctx, username, webhookID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery storage.Delivery
+		var payload []byte
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.LastStatus,
+			&delivery.LastError,
+			&delivery.LastAttemptAt,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
 		}
-		return nil, fmt.Errorf("can't scan user with name: %s: %w", name, err)
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
 	}
-	user.Name = name
 
-	return &user, nil
+	return deliveries, nil
 }
 
-func (s *Storage) CreateURL(ctx context.Context, username, url, alias string) error {
-	if _, err := s.insertURL.ExecContext(ctx, url, alias, username); err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == "23505" {
-				return storage.ErrAliasExists
-			}
-		}
-		return fmt.Errorf("insert url: %w", err)
+// Redeliver queues the delivery of the webhook of the user to be sent again
+// now, whatever the outcome of the previous attempts.
+func (s *Storage) Redeliver(ctx context.Context, username string, webhookID, id int64) error {
+	res, err := s.redeliver.ExecContext(ctx, username, webhookID, id)
+	if err != nil {
+		return fmt.Errorf("redeliver: %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("redeliver: %w", err)
+	}
+	if count != 1 {
+		return storage.ErrDeliveryNotFound
 	}
 
 	return nil
 }
 
-func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
-	var url string
+// ClaimDeliveries returns up to limit pending deliveries due now and puts
+// their next attempt off by the lease, so that other instances do not send
+// them at the same time.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit uint64, lease time.Duration) ([]storage.PendingDelivery, error) {
+	deliveries := make([]storage.PendingDelivery, 0)
 
-	if err := s.selectURL.QueryRowContext(ctx, alias).Scan(&url); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", storage.ErrAliasNotFound
+	rows, err := s.claimDeliveries.QueryContext(ctx, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("can't get rows deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery storage.PendingDelivery
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
 		}
-		return "", fmt.Errorf("can't scan URL with alias: %s: %w", alias, err)
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	return url, nil
+	return deliveries, nil
 }
 
-func (s *Storage) CountIncrement(alias string) error {
-	res, err := s.countIncrement.Exec(alias) //nolint:noctx
-	if err != nil {
-		return fmt.Errorf("count increment: %w", err)
-	}
-	count, err := res.RowsAffected()
+func (s *Storage) SetDeliveryResult(ctx context.Context, id int64, result *storage.DeliveryResult) error {
+	_, err := s.setDeliveryResult.ExecContext(ctx, id,
+		result.Status, result.LastStatus, result.LastError, result.AttemptedAt, result.NextAttemptAt)
 	if err != nil {
-		return fmt.Errorf("count increment: %w", err)
+		return fmt.Errorf("set delivery result: %w", err)
 	}
-	if count != 1 {
-		return storage.ErrAliasNotFound
+
+	return nil
+}
+
+// ReleaseDelivery makes the claimed pending delivery due at once, when its
+// sending was interrupted, instead of when the claim expires.
+func (s *Storage) ReleaseDelivery(ctx context.Context, id int64) error {
+	if _, err := s.releaseDelivery.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("release delivery: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Storage) DeleteURL(ctx context.Context, username, alias string) error {
-	res, err := s.deleteURL.ExecContext(ctx, username, alias)
+// DeleteDeliveries deletes the delivered and failed deliveries created
+// before the time and returns how many were deleted.
+func (s *Storage) DeleteDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.deleteDeliveries.ExecContext(ctx, before)
 	if err != nil {
-		return fmt.Errorf("delete url: %w", err)
+		return 0, fmt.Errorf("delete deliveries: %w", err)
 	}
 	count, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("delete url: %w", err)
+		return 0, fmt.Errorf("delete deliveries: %w", err)
 	}
-	if count != 1 {
-		return storage.ErrAliasNotFound
+
+	return count, nil
+}
+
+// GetClicksCrossed returns up to limit links with at least threshold clicks
+// not yet notified of a threshold as high.
+func (s *Storage) GetClicksCrossed(ctx context.Context, threshold, limit uint64) ([]storage.OwnedURL, error) {
+	return s.ownedURLs(ctx, s.selectClicksCross, threshold, limit)
+}
+
+// SetClicksNotified records that the link was notified of the threshold.
+func (s *Storage) SetClicksNotified(ctx context.Context, alias string, threshold uint64) error {
+	if _, err := s.setClicksNotified.ExecContext(ctx, alias, threshold); err != nil {
+		return fmt.Errorf("set clicks notified: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Storage) GetURLs(ctx context.Context, username string, limit, offset uint64) ([]storage.URL, uint64, error) {
-	urls := make([]storage.URL, 0)
+// GetExpiredURLs returns up to limit links expired by now and not yet
+// notified of it.
+func (s *Storage) GetExpiredURLs(ctx context.Context, now time.Time, limit uint64) ([]storage.OwnedURL, error) {
+	return s.ownedURLs(ctx, s.selectExpiredURLs, now, limit)
+}
+
+// SetExpiredNotified records that the link was notified of its expiry.
+func (s *Storage) SetExpiredNotified(ctx context.Context, alias string) error {
+	if _, err := s.setExpiredNotified.ExecContext(ctx, alias); err != nil {
+		return fmt.Errorf("set expired notified: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ownedURLs(ctx context.Context, stmt *sql.Stmt, args ...any) ([]storage.OwnedURL, error) {
+	urls := make([]storage.OwnedURL, 0)
 
-	rows, err := s.selectURLs.QueryContext(ctx, username, limit, offset)
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return urls, 0, nil
-		}
-		return nil, 0, fmt.Errorf("can't get rows urls: %w", err)
+		return nil, fmt.Errorf("can't get rows urls: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var url storage.URL
-		err = rows.Scan(
-			&url.URL,
-			&url.Alias,
-			&url.Count,
-			&url.CreatedAt,
-		)
-		if err != nil {
-			return nil, 0, fmt.Errorf("can't scan next row: %w", err)
+		var url storage.OwnedURL
+		if err := rows.Scan(&url.Username, &url.Alias, &url.URL, &url.Count, &url.ActiveUntil); err != nil {
+			return nil, fmt.Errorf("can't scan next row: %w", err)
 		}
 		urls = append(urls, url)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("rows error: %w", err)
+		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	var total uint64
-	if err := s.selectTotalURLs.QueryRowContext(ctx, username).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("can't scan total urls: %w", err)
-	}
-
-	return urls, total, nil
+	return urls, nil
 }
 
-func (s *Storage) CheckAlias(ctx context.Context, alias string) (bool, error) {
-	var exists bool
-	if err := s.existsAlias.QueryRowContext(ctx, alias).Scan(&exists); err != nil {
-		return false, fmt.Errorf("exists alias: %w", err)
-	}
-
-	return exists, nil
+// Stats returns the statistics of the pool of connections.
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
 }
 
 func (s *Storage) Close() error {
 	s.insertUser.Close()
 	s.selectUser.Close()
+	s.updatePassword.Close()
+	s.updateRole.Close()
 
 	s.insertURL.Close()
 	s.selectURL.Close()
+	s.selectURLInfo.Close()
+	s.selectUserURL.Close()
+	s.updateURL.Close()
+	s.flagURL.Close()
+	s.setMetadata.Close()
+	s.setHealth.Close()
 	s.countIncrement.Close()
+	s.countCountry.Close()
+	s.countVariant.Close()
 	s.deleteURL.Close()
 
 	s.selectURLs.Close()
 	s.selectTotalURLs.Close()
+	s.selectCampaignStats.Close()
+	s.scanURLs.Close()
+	s.scanHealth.Close()
 
 	s.existsAlias.Close()
+	s.selectAlias.Close()
+	s.scanAliases.Close()
+	s.renameAlias.Close()
+
+	s.insertHostRule.Close()
+	s.selectHostRules.Close()
+	s.deleteHostRule.Close()
+
+	s.insertAliasTerm.Close()
+	s.selectAliasTerms.Close()
+	s.deleteAliasTerm.Close()
+
+	s.selectUTMDefaults.Close()
+	s.upsertUTMDefaults.Close()
+
+	s.insertWebhook.Close()
+	s.selectWebhooks.Close()
+	s.selectWebhook.Close()
+	s.deleteWebhook.Close()
+	s.enqueueEvent.Close()
+	s.selectDeliveries.Close()
+	s.redeliver.Close()
+	s.claimDeliveries.Close()
+	s.setDeliveryResult.Close()
+	s.releaseDelivery.Close()
+	s.deleteDeliveries.Close()
+	s.selectClicksCross.Close()
+	s.setClicksNotified.Close()
+	s.selectExpiredURLs.Close()
+	s.setExpiredNotified.Close()
 
 	return s.db.Close() //nolint:wrapcheck
 }
@@ -218,7 +1212,13 @@ func (s *Storage) connect(ctx context.Context) error {
 	var err error
 	dbConfStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		s.conf.Host, s.conf.Port, s.conf.User, s.conf.Password, s.conf.Name)
-	s.db, err = sql.Open("pgx", dbConfStr)
+	s.db, err = otelsql.Open("pgx", dbConfStr,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{ //nolint:exhaustruct
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return fmt.Errorf("open: %w", err)
 	}
@@ -236,6 +1236,72 @@ func (s *Storage) connect(ctx context.Context) error {
 	return nil
 }
 
+// marshalList encodes a list for a jsonb column, nil as an empty list.
+func marshalList[T any](list []T) (string, error) {
+	if list == nil {
+		list = []T{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("marshal list: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// unmarshalList decodes a list from a jsonb column, an empty list as nil.
+func unmarshalList[T any](data []byte) ([]T, error) {
+	var list []T
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unmarshal list: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	return list, nil
+}
+
+// fetched returns the metadata if it was ever fetched, otherwise nil.
+func fetched(metadata *storage.Metadata, fetchedAt sql.NullTime) *storage.Metadata {
+	if !fetchedAt.Valid {
+		return nil
+	}
+	metadata.FetchedAt = fetchedAt.Time
+
+	return metadata
+}
+
+// checked returns the health if the destination was ever checked, otherwise nil.
+func checked(health *storage.Health, checkedAt sql.NullTime) *storage.Health {
+	if !checkedAt.Valid {
+		return nil
+	}
+	health.CheckedAt = checkedAt.Time
+
+	return health
+}
+
+// Filters of urls by the campaign parameters, an empty parameter matches any
+// value, and by the broken destination, false matches any url. The number is
+// the position of the first parameter.
+const (
+	sqlFilterUTM2 = `($2 = '' OR utm_source = $2) AND ($3 = '' OR utm_medium = $3) AND
+		($4 = '' OR utm_campaign = $4) AND ($5 = '' OR utm_term = $5) AND ($6 = '' OR utm_content = $6)`
+	sqlFilterBroken7 = `($7 = false OR broken)`
+	sqlFilterBroken9 = `($9 = false OR broken)`
+	sqlFilterUTM4    = `($4 = '' OR utm_source = $4) AND ($5 = '' OR utm_medium = $5) AND
+		($6 = '' OR utm_campaign = $6) AND ($7 = '' OR utm_term = $7) AND ($8 = '' OR utm_content = $8)`
+)
+
+// sqlVariantCounts selects the variants of the url with the number of clicks
+// sent to each of them.
+const sqlVariantCounts = `(
+	SELECT COALESCE(jsonb_agg(variant || jsonb_build_object('count', COALESCE(url_variants.count, 0)) ORDER BY position), '[]')
+	FROM jsonb_array_elements(urls.variants) WITH ORDINALITY AS variants(variant, position)
+	LEFT JOIN url_variants ON url_variants.alias = urls.alias AND url_variants.url = variant->>'url'
+)`
+
 func (s *Storage) prepareQuery(ctx context.Context) error {
 	var err error
 	fmtStrErr := "prepare \"%s\" query: %w"
@@ -245,41 +1311,174 @@ func (s *Storage) prepareQuery(ctx context.Context) error {
 		INSERT INTO users (
 			name,
 			hash_password,
-			role
+			role,
+			provider
 		)
-		VALUES ($1, $2, $3)`
+		VALUES ($1, $2, $3, $4)`
 	s.insertUser, err = s.db.PrepareContext(ctx, sqlInsertUser)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "insert user", err)
 	}
 	sqlGetUser := `
 		SELECT hash_password,
-			role
+			role,
+			provider
 		FROM users
 		WHERE name = $1`
 	s.selectUser, err = s.db.PrepareContext(ctx, sqlGetUser)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "select user", err)
 	}
+	const sqlUpdatePassword = `
+		UPDATE users
+		SET hash_password = $2
+		WHERE name = $1`
+	s.updatePassword, err = s.db.PrepareContext(ctx, sqlUpdatePassword)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "update password", err)
+	}
+	const sqlUpdateRole = `
+		UPDATE users
+		SET role = $2
+		WHERE name = $1`
+	s.updateRole, err = s.db.PrepareContext(ctx, sqlUpdateRole)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "update role", err)
+	}
 
 	// URL query.
 	const sqlInsertURL = `
-		INSERT INTO urls (url, alias, username)
-			VALUES($1, $2, $3)`
+		INSERT INTO urls (url, alias, username, redirect_type, forward_query, forward_path,
+				utm_source, utm_medium, utm_campaign, utm_term, utm_content, title, targets, variants, sticky,
+				active_from, active_until, schedule)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`
 	s.insertURL, err = s.db.PrepareContext(ctx, sqlInsertURL)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "insert url", err)
 	}
 	const sqlSelectURL = `
-		UPDATE urls
-		SET count = count+1
-		WHERE alias = $1
-		RETURNING url`
+		SELECT url, threat, redirect_type, forward_query, forward_path,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content, targets, variants, sticky,
+			active_from, active_until, schedule
+		FROM urls
+		WHERE alias = $1`
 
 	s.selectURL, err = s.db.PrepareContext(ctx, sqlSelectURL)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "select url", err)
 	}
+	const sqlSelectURLInfo = `
+		SELECT
+			url,
+			alias,
+			count,
+			created_at,
+			threat,
+			redirect_type,
+			forward_query,
+			forward_path,
+			utm_source,
+			utm_medium,
+			utm_campaign,
+			utm_term,
+			utm_content,
+			title,
+			targets,
+			` + sqlVariantCounts + `,
+			sticky,
+			active_from,
+			active_until,
+			schedule,
+			meta_title,
+			meta_description,
+			meta_image,
+			meta_favicon,
+			meta_fetched_at,
+			health_status,
+			health_latency_ms,
+			health_error,
+			health_checked_at,
+			broken
+		FROM urls
+		WHERE alias = $1`
+	s.selectURLInfo, err = s.db.PrepareContext(ctx, sqlSelectURLInfo)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select url info", err)
+	}
+	const sqlSelectUserURL = `SELECT url FROM urls WHERE username = $1 AND alias = $2`
+	s.selectUserURL, err = s.db.PrepareContext(ctx, sqlSelectUserURL)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select user url", err)
+	}
+	// The metadata and the health of the previous url are dropped when the
+	// url changes.
+	const sqlUpdateURL = `
+		UPDATE urls
+		SET meta_title = CASE WHEN url = $3 THEN meta_title ELSE '' END,
+			meta_description = CASE WHEN url = $3 THEN meta_description ELSE '' END,
+			meta_image = CASE WHEN url = $3 THEN meta_image ELSE '' END,
+			meta_favicon = CASE WHEN url = $3 THEN meta_favicon ELSE '' END,
+			meta_fetched_at = CASE WHEN url = $3 THEN meta_fetched_at ELSE NULL END,
+			health_status = CASE WHEN url = $3 THEN health_status ELSE 0 END,
+			health_latency_ms = CASE WHEN url = $3 THEN health_latency_ms ELSE 0 END,
+			health_error = CASE WHEN url = $3 THEN health_error ELSE '' END,
+			health_checked_at = CASE WHEN url = $3 THEN health_checked_at ELSE NULL END,
+			broken = CASE WHEN url = $3 THEN broken ELSE false END,
+			url = $3,
+			redirect_type = $4,
+			forward_query = $5,
+			forward_path = $6,
+			utm_source = $7,
+			utm_medium = $8,
+			utm_campaign = $9,
+			utm_term = $10,
+			utm_content = $11,
+			title = $12,
+			targets = $13,
+			variants = $14,
+			sticky = $15,
+			active_from = $16,
+			active_until = $17,
+			schedule = $18,
+			expired_notified = expired_notified AND active_until IS NOT DISTINCT FROM $17
+		WHERE username = $1 AND alias = $2`
+	s.updateURL, err = s.db.PrepareContext(ctx, sqlUpdateURL)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "update url", err)
+	}
+	const sqlFlagURL = `
+		UPDATE urls
+		SET threat = $2,
+			flagged_at = CASE WHEN $2 = '' THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE alias = $1`
+	s.flagURL, err = s.db.PrepareContext(ctx, sqlFlagURL)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "flag url", err)
+	}
+	const sqlSetMetadata = `
+		UPDATE urls
+		SET meta_title = $3,
+			meta_description = $4,
+			meta_image = $5,
+			meta_favicon = $6,
+			meta_fetched_at = $7
+		WHERE alias = $1 AND url = $2`
+	s.setMetadata, err = s.db.PrepareContext(ctx, sqlSetMetadata)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "set metadata", err)
+	}
+	const sqlSetHealth = `
+		UPDATE urls
+		SET health_status = $3,
+			health_latency_ms = $4,
+			health_error = $5,
+			health_checked_at = $6,
+			broken = $7
+		WHERE alias = $1 AND url = $2`
+	s.setHealth, err = s.db.PrepareContext(ctx, sqlSetHealth)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "set health", err)
+	}
 	const sqlCountIncrement = `
 		UPDATE urls
 		SET count = count+1
@@ -289,6 +1488,22 @@ func (s *Storage) prepareQuery(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "counter increment", err)
 	}
+	const sqlCountCountry = `
+		INSERT INTO url_countries (alias, country, count)
+		SELECT alias, $2, 1 FROM urls WHERE alias = $1
+		ON CONFLICT (alias, country) DO UPDATE SET count = url_countries.count+1`
+	s.countCountry, err = s.db.PrepareContext(ctx, sqlCountCountry)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "count country", err)
+	}
+	const sqlCountVariant = `
+		INSERT INTO url_variants (alias, url, count)
+		SELECT alias, $2, 1 FROM urls WHERE alias = $1
+		ON CONFLICT (alias, url) DO UPDATE SET count = url_variants.count+1`
+	s.countVariant, err = s.db.PrepareContext(ctx, sqlCountVariant)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "count variant", err)
+	}
 	const sqlDeleteURL = `
 		DELETE FROM urls
 		WHERE username = $1 AND alias = $2`
@@ -301,9 +1516,40 @@ func (s *Storage) prepareQuery(ctx context.Context) error {
 			url,
 			alias,
 			count,
-			created_at
+			created_at,
+			threat,
+			redirect_type,
+			forward_query,
+			forward_path,
+			utm_source,
+			utm_medium,
+			utm_campaign,
+			utm_term,
+			utm_content,
+			title,
+			targets,
+			` + sqlVariantCounts + `,
+			sticky,
+			active_from,
+			active_until,
+			schedule,
+			meta_title,
+			meta_description,
+			meta_image,
+			meta_favicon,
+			meta_fetched_at,
+			health_status,
+			health_latency_ms,
+			health_error,
+			health_checked_at,
+			broken,
+			COALESCE((
+				SELECT jsonb_object_agg(country, url_countries.count)
+				FROM url_countries
+				WHERE url_countries.alias = urls.alias
+			), '{}')
 		FROM urls
-		WHERE username = $1
+		WHERE username = $1 AND ` + sqlFilterUTM4 + ` AND ` + sqlFilterBroken9 + `
 		ORDER BY created_at DESC
 		LIMIT $2
 		OFFSET $3`
@@ -312,17 +1558,346 @@ func (s *Storage) prepareQuery(ctx context.Context) error {
 		return fmt.Errorf(fmtStrErr, "select urls", err)
 	}
 
-	const sqlSelectTotalURLs = `SELECT COUNT(alias) FROM urls WHERE username = $1`
+	const sqlSelectTotalURLs = `SELECT COUNT(alias) FROM urls WHERE username = $1 AND ` + sqlFilterUTM2 + ` AND ` + sqlFilterBroken7
 	s.selectTotalURLs, err = s.db.PrepareContext(ctx, sqlSelectTotalURLs)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "select total urls", err)
 	}
+	const sqlSelectCampaignStats = `
+		SELECT
+			utm_source,
+			utm_medium,
+			utm_campaign,
+			COUNT(alias),
+			COALESCE(SUM(count), 0)
+		FROM urls
+		WHERE username = $1 AND ` + sqlFilterUTM2 + `
+		GROUP BY utm_source, utm_medium, utm_campaign
+		ORDER BY 5 DESC, 1, 2, 3`
+	s.selectCampaignStats, err = s.db.PrepareContext(ctx, sqlSelectCampaignStats)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select campaign stats", err)
+	}
+
+	const sqlScanURLs = `
+		SELECT
+			url,
+			alias,
+			targets,
+			variants,
+			schedule
+		FROM urls
+		WHERE alias > $1 AND threat = ''
+		ORDER BY alias
+		LIMIT $2`
+	s.scanURLs, err = s.db.PrepareContext(ctx, sqlScanURLs)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "scan urls", err)
+	}
+
+	const sqlScanHealth = `
+		SELECT
+			alias,
+			url,
+			username,
+			broken,
+			targets,
+			variants,
+			schedule
+		FROM urls
+		WHERE alias > $1 AND threat = ''
+		ORDER BY alias
+		LIMIT $2`
+	s.scanHealth, err = s.db.PrepareContext(ctx, sqlScanHealth)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "scan health", err)
+	}
 
 	const sqlExistsAlias = `SELECT EXISTS ( SELECT 1 FROM urls WHERE alias = $1 )`
 	s.existsAlias, err = s.db.PrepareContext(ctx, sqlExistsAlias)
 	if err != nil {
 		return fmt.Errorf(fmtStrErr, "exists alias", err)
 	}
+	const sqlSelectAlias = `
+		SELECT alias
+		FROM urls
+		WHERE username = $1 AND url = $2 AND threat = ''
+			AND redirect_type = $3 AND title = $4
+			AND forward_query = $5 AND forward_path = $6
+			AND utm_source = $7 AND utm_medium = $8 AND utm_campaign = $9
+			AND utm_term = $10 AND utm_content = $11
+			AND targets = '[]' AND variants = '[]' AND schedule = '[]'
+			AND active_from IS NULL AND active_until IS NULL
+		ORDER BY created_at
+		LIMIT 1`
+	s.selectAlias, err = s.db.PrepareContext(ctx, sqlSelectAlias)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select alias", err)
+	}
+	const sqlScanAliases = `
+		SELECT alias
+		FROM urls
+		WHERE alias > $1
+		ORDER BY alias
+		LIMIT $2`
+	s.scanAliases, err = s.db.PrepareContext(ctx, sqlScanAliases)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "scan aliases", err)
+	}
+	const sqlRenameAlias = `UPDATE urls SET alias = $2 WHERE alias = $1`
+	s.renameAlias, err = s.db.PrepareContext(ctx, sqlRenameAlias)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "rename alias", err)
+	}
+
+	// Host rules query.
+	const sqlInsertHostRule = `
+		INSERT INTO host_rules (list, type, pattern, created_by)
+			VALUES($1, $2, $3, $4)
+		RETURNING id`
+	s.insertHostRule, err = s.db.PrepareContext(ctx, sqlInsertHostRule)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "insert host rule", err)
+	}
+	const sqlSelectHostRules = `
+		SELECT
+			id,
+			list,
+			type,
+			pattern,
+			created_by,
+			created_at
+		FROM host_rules
+		ORDER BY id`
+	s.selectHostRules, err = s.db.PrepareContext(ctx, sqlSelectHostRules)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select host rules", err)
+	}
+	const sqlDeleteHostRule = `DELETE FROM host_rules WHERE id = $1`
+	s.deleteHostRule, err = s.db.PrepareContext(ctx, sqlDeleteHostRule)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "delete host rule", err)
+	}
+
+	// Alias terms query.
+	const sqlInsertAliasTerm = `
+		INSERT INTO alias_terms (term, match, created_by)
+			VALUES($1, $2, $3)
+		RETURNING id`
+	s.insertAliasTerm, err = s.db.PrepareContext(ctx, sqlInsertAliasTerm)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "insert alias term", err)
+	}
+	const sqlSelectAliasTerms = `
+		SELECT
+			id,
+			term,
+			match,
+			created_by,
+			created_at
+		FROM alias_terms
+		ORDER BY id`
+	s.selectAliasTerms, err = s.db.PrepareContext(ctx, sqlSelectAliasTerms)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select alias terms", err)
+	}
+	const sqlDeleteAliasTerm = `DELETE FROM alias_terms WHERE id = $1`
+	s.deleteAliasTerm, err = s.db.PrepareContext(ctx, sqlDeleteAliasTerm)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "delete alias term", err)
+	}
+
+	// UTM defaults query.
+	const sqlSelectUTMDefaults = `
+		SELECT
+			utm_source,
+			utm_medium,
+			utm_campaign,
+			utm_term,
+			utm_content
+		FROM utm_defaults
+		WHERE username = $1`
+	s.selectUTMDefaults, err = s.db.PrepareContext(ctx, sqlSelectUTMDefaults)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select utm defaults", err)
+	}
+	const sqlUpsertUTMDefaults = `
+		INSERT INTO utm_defaults (username, utm_source, utm_medium, utm_campaign, utm_term, utm_content)
+			VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (username) DO UPDATE
+		SET utm_source = EXCLUDED.utm_source,
+			utm_medium = EXCLUDED.utm_medium,
+			utm_campaign = EXCLUDED.utm_campaign,
+			utm_term = EXCLUDED.utm_term,
+			utm_content = EXCLUDED.utm_content`
+	s.upsertUTMDefaults, err = s.db.PrepareContext(ctx, sqlUpsertUTMDefaults)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "upsert utm defaults", err)
+	}
+
+	// Webhooks query.
+	const sqlInsertWebhook = `
+		INSERT INTO webhooks (username, url, secret, events)
+			VALUES($1, $2, $3, $4)
+		RETURNING id`
+	s.insertWebhook, err = s.db.PrepareContext(ctx, sqlInsertWebhook)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "insert webhook", err)
+	}
+	const sqlSelectWebhooks = `
+		SELECT
+			id,
+			url,
+			events,
+			created_at
+		FROM webhooks
+		WHERE username = $1
+		ORDER BY id`
+	s.selectWebhooks, err = s.db.PrepareContext(ctx, sqlSelectWebhooks)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select webhooks", err)
+	}
+	const sqlSelectWebhook = `
+		SELECT
+			url,
+			secret,
+			events,
+			created_at
+		FROM webhooks
+		WHERE username = $1 AND id = $2`
+	s.selectWebhook, err = s.db.PrepareContext(ctx, sqlSelectWebhook)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select webhook", err)
+	}
+	const sqlDeleteWebhook = `
+		DELETE FROM webhooks
+		WHERE username = $1 AND id = $2`
+	s.deleteWebhook, err = s.db.PrepareContext(ctx, sqlDeleteWebhook)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "delete webhook", err)
+	}
+	const sqlEnqueueEvent = `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE username = $1 AND events @> jsonb_build_array($2::text)`
+	s.enqueueEvent, err = s.db.PrepareContext(ctx, sqlEnqueueEvent)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "enqueue event", err)
+	}
+	const sqlSelectDeliveries = `
+		SELECT
+			d.id,
+			d.event,
+			d.payload,
+			d.status,
+			d.attempts,
+			d.last_status,
+			d.last_error,
+			d.last_attempt_at,
+			d.next_attempt_at,
+			d.created_at
+		FROM webhook_deliveries AS d
+		JOIN webhooks AS w ON w.id = d.webhook_id
+		WHERE w.username = $1 AND d.webhook_id = $2
+		ORDER BY d.id DESC
+		LIMIT $3
+		OFFSET $4`
+	s.selectDeliveries, err = s.db.PrepareContext(ctx, sqlSelectDeliveries)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select deliveries", err)
+	}
+	const sqlRedeliver = `
+		UPDATE webhook_deliveries AS d
+		SET status = 'pending',
+			next_attempt_at = CURRENT_TIMESTAMP
+		FROM webhooks AS w
+		WHERE w.id = d.webhook_id AND w.username = $1 AND d.webhook_id = $2 AND d.id = $3`
+	s.redeliver, err = s.db.PrepareContext(ctx, sqlRedeliver)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "redeliver", err)
+	}
+	const sqlClaimDeliveries = `
+		UPDATE webhook_deliveries AS d
+		SET next_attempt_at = CURRENT_TIMESTAMP + $2::bigint * interval '1 millisecond'
+		FROM webhooks AS w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, w.url, w.secret, d.event, d.payload, d.attempts`
+	s.claimDeliveries, err = s.db.PrepareContext(ctx, sqlClaimDeliveries)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "claim deliveries", err)
+	}
+	const sqlSetDeliveryResult = `
+		UPDATE webhook_deliveries
+		SET attempts = attempts+1,
+			status = $2,
+			last_status = $3,
+			last_error = $4,
+			last_attempt_at = $5,
+			next_attempt_at = $6
+		WHERE id = $1`
+	s.setDeliveryResult, err = s.db.PrepareContext(ctx, sqlSetDeliveryResult)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "set delivery result", err)
+	}
+	const sqlReleaseDelivery = `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'`
+	s.releaseDelivery, err = s.db.PrepareContext(ctx, sqlReleaseDelivery)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "release delivery", err)
+	}
+	const sqlDeleteDeliveries = `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < $1`
+	s.deleteDeliveries, err = s.db.PrepareContext(ctx, sqlDeleteDeliveries)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "delete deliveries", err)
+	}
+	const sqlSelectClicksCrossed = `
+		SELECT username, alias, url, count, active_until
+		FROM urls
+		WHERE clicks_notified < $1 AND count >= $1
+		ORDER BY alias
+		LIMIT $2`
+	s.selectClicksCross, err = s.db.PrepareContext(ctx, sqlSelectClicksCrossed)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select clicks crossed", err)
+	}
+	const sqlSetClicksNotified = `
+		UPDATE urls
+		SET clicks_notified = GREATEST(clicks_notified, $2)
+		WHERE alias = $1`
+	s.setClicksNotified, err = s.db.PrepareContext(ctx, sqlSetClicksNotified)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "set clicks notified", err)
+	}
+	const sqlSelectExpiredURLs = `
+		SELECT username, alias, url, count, active_until
+		FROM urls
+		WHERE active_until <= $1 AND NOT expired_notified
+		ORDER BY alias
+		LIMIT $2`
+	s.selectExpiredURLs, err = s.db.PrepareContext(ctx, sqlSelectExpiredURLs)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "select expired urls", err)
+	}
+	const sqlSetExpiredNotified = `
+		UPDATE urls
+		SET expired_notified = true
+		WHERE alias = $1`
+	s.setExpiredNotified, err = s.db.PrepareContext(ctx, sqlSetExpiredNotified)
+	if err != nil {
+		return fmt.Errorf(fmtStrErr, "set expired notified", err)
+	}
 
 	return nil
 }
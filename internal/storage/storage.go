@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -12,6 +13,28 @@ var (
 
 	ErrAliasExists   = errors.New("alias already exists")
 	ErrAliasNotFound = errors.New("alias not found")
+	ErrURLNotFound   = errors.New("url not found")
+
+	ErrHostRuleExists   = errors.New("host rule already exists")
+	ErrHostRuleNotFound = errors.New("host rule not found")
+
+	ErrAliasTermExists   = errors.New("alias term already exists")
+	ErrAliasTermNotFound = errors.New("alias term not found")
+
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+const (
+	ProviderLocal = "local"
+	ProviderOIDC  = "oidc"
+)
+
+// Statuses of webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
 )
 
 //nolint:tagliatelle
@@ -19,6 +42,7 @@ type User struct {
 	Name         string `json:"name"`
 	HashPassword string `json:"hash_password"`
 	Role         string `json:"role"`
+	Provider     string `json:"provider"`
 }
 
 //nolint:tagliatelle
@@ -27,23 +51,364 @@ type URL struct {
 	Alias     string    `json:"alias"`
 	Count     uint64    `json:"count"`
 	CreatedAt time.Time `json:"created_at"`
+	// Threat is set when the url is flagged as unsafe and disabled.
+	Threat       string `json:"threat,omitempty"`
+	RedirectType int    `json:"redirect_type,omitempty"`
+	ForwardQuery bool   `json:"forward_query,omitempty"`
+	ForwardPath  bool   `json:"forward_path,omitempty"`
+	UTM
+	Title    string       `json:"title,omitempty"`
+	Targets  []TargetRule `json:"targets,omitempty"`
+	Variants []Variant    `json:"variants,omitempty"`
+	Sticky   bool         `json:"sticky,omitempty"`
+	Schedule
+	// Metadata of the destination page, nil until it is fetched.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Health of the destination, nil until it is checked.
+	Health *Health `json:"health,omitempty"`
+	// Countries is the number of clicks by the country code, clicks from
+	// unknown countries are only in Count.
+	Countries map[string]uint64 `json:"countries,omitempty"`
+}
+
+// Destinations returns the url and the urls of the targeting rules, the
+// variants and the scheduled changes of the link.
+func (u *URL) Destinations() []string {
+	urls := make([]string, 0, 1+len(u.Targets)+len(u.Variants)+len(u.Changes))
+	urls = append(urls, u.URL)
+	for _, rule := range u.Targets {
+		urls = append(urls, rule.URL)
+	}
+	for _, variant := range u.Variants {
+		urls = append(urls, variant.URL)
+	}
+	for _, change := range u.Changes {
+		urls = append(urls, change.URL)
+	}
+
+	return urls
+}
+
+// Metadata describes the destination page as it was when fetched. Image and
+// Favicon are absolute urls.
+//
+//nolint:tagliatelle
+type Metadata struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Health is the result of the last check of the destination. Status is the
+// status code of the response, zero if there was none, then Error tells why.
+//
+//nolint:tagliatelle
+type Health struct {
+	Status    int       `json:"status,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Broken    bool      `json:"broken"`
+}
+
+// HealthState is what the health checker knows of a link before the check.
+type HealthState struct {
+	Alias string
+	URL   string
+	// Destinations are the urls of the targeting rules, the variants and
+	// the scheduled changes besides URL.
+	Destinations []string
+	Username     string
+	Broken       bool
+}
+
+// OwnedURL is a link with its owner as found by the background checks of
+// expiry and clicks.
+type OwnedURL struct {
+	Username    string
+	Alias       string
+	URL         string
+	Count       uint64
+	ActiveUntil *time.Time
+}
+
+// URLFilter selects the urls of a user, the zero filter matches all of them.
+type URLFilter struct {
+	UTM
+	// Broken matches only the urls with a broken destination.
+	Broken bool
+}
+
+// UTM holds the campaign parameters appended to the url at redirect. As a
+// filter, empty fields match any value.
+//
+//nolint:tagliatelle
+type UTM struct {
+	Source   string `json:"utm_source,omitempty"`
+	Medium   string `json:"utm_medium,omitempty"`
+	Campaign string `json:"utm_campaign,omitempty"`
+	Term     string `json:"utm_term,omitempty"`
+	Content  string `json:"utm_content,omitempty"`
+}
+
+// CampaignStats is the number of links and clicks of a combination of the
+// source, the medium and the campaign.
+//
+//nolint:tagliatelle
+type CampaignStats struct {
+	Source   string `json:"utm_source"`
+	Medium   string `json:"utm_medium"`
+	Campaign string `json:"utm_campaign"`
+	Links    uint64 `json:"links"`
+	Clicks   uint64 `json:"clicks"`
+}
+
+// Target is the destination of an alias with the settings of the link. It is
+// cached as JSON.
+//
+//nolint:tagliatelle
+type Target struct {
+	URL    string `json:"url"`
+	Threat string `json:"threat,omitempty"`
+	// RedirectType is the status code of the redirect, the server
+	// default if zero.
+	RedirectType int `json:"redirect_type,omitempty"`
+	// ForwardQuery merges the query string of the request into the url.
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// ForwardPath redirects /alias/rest/of/path to url/rest/of/path.
+	ForwardPath bool `json:"forward_path,omitempty"`
+	UTM
+	// Title is given by the owner and shown on the preview page.
+	Title string `json:"title,omitempty"`
+	// Targets send clients to other urls by their device and country,
+	// the first matching rule wins and URL is the fallback.
+	Targets []TargetRule `json:"targets,omitempty"`
+	// Variants split the clients no targeting rule matches between urls
+	// by their weights.
+	Variants []Variant `json:"variants,omitempty"`
+	// Sticky keeps a client on the variant chosen first by a cookie.
+	Sticky bool `json:"sticky,omitempty"`
+	Schedule
+}
+
+// Schedule is the time a link is active and the changes of its url at given
+// moments.
+//
+//nolint:tagliatelle
+type Schedule struct {
+	// The link is active from ActiveFrom until ActiveUntil, a nil bound
+	// does not limit it.
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	// Changes are sorted by the time.
+	Changes []ScheduledChange `json:"schedule,omitempty"`
+}
+
+// ScheduledChange replaces the url of the link from At on.
+type ScheduledChange struct {
+	At  time.Time `json:"at"`
+	URL string    `json:"url"`
+}
+
+// URLAt returns the url of the latest change made by now, or url if none is.
+func (s *Schedule) URLAt(url string, now time.Time) string {
+	for _, change := range s.Changes {
+		if now.Before(change.At) {
+			break
+		}
+		url = change.URL
+	}
+
+	return url
+}
+
+// NextChange returns the time after now the link is activated, deactivated
+// or its url changes, zero if there is none.
+func (s *Schedule) NextChange(now time.Time) time.Time {
+	var next time.Time
+	later := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	if s.ActiveFrom != nil {
+		later(*s.ActiveFrom)
+	}
+	if s.ActiveUntil != nil {
+		later(*s.ActiveUntil)
+	}
+	for _, change := range s.Changes {
+		later(change.At)
+	}
+
+	return next
+}
+
+// Variant is a destination of an A/B split, it gets the share of the clients
+// of its weight in the sum of the weights of all variants.
+type Variant struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	// Count is the number of clicks sent to the url, it is only filled in
+	// the list of urls.
+	Count uint64 `json:"count,omitempty"`
+}
+
+// TargetRule matches clients by the operating system and the type of the
+// device as told by useragent.Parse and by the upper case ISO 3166-1 alpha-2
+// code of the country as told by geoip.DB, an empty field matches any value.
+type TargetRule struct {
+	OS      string `json:"os,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Country string `json:"country,omitempty"`
+	URL     string `json:"url"`
+}
+
+// HostRule is a destination host rule of the denylist or the allowlist.
+//
+//nolint:tagliatelle
+type HostRule struct {
+	ID        int64     `json:"id"`
+	List      string    `json:"list"`
+	Type      string    `json:"type"`
+	Pattern   string    `json:"pattern"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Webhook is a subscription of the user to the events of their links. The
+// secret signs the payloads and is only shown when the webhook is created.
+//
+//nolint:tagliatelle
+type Webhook struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is an event queued for a webhook with the outcome of the last
+// attempt to send it.
+//
+//nolint:tagliatelle
+type Delivery struct {
+	ID            int64           `json:"id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastStatus    int             `json:"last_status,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// PendingDelivery is a delivery claimed to be sent now.
+type PendingDelivery struct {
+	ID       int64
+	URL      string
+	Secret   string
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+// DeliveryResult is the outcome of an attempt to send a delivery.
+type DeliveryResult struct {
+	Status        string
+	LastStatus    int
+	LastError     string
+	AttemptedAt   time.Time
+	NextAttemptAt time.Time
+}
+
+// AliasTerm is a word that must not be used in aliases, like a reserved
+// name, a profanity or a brand term.
+//
+//nolint:tagliatelle
+type AliasTerm struct {
+	ID        int64     `json:"id"`
+	Term      string    `json:"term"`
+	Match     string    `json:"match"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type UserStorage interface {
 	CreateUser(ctx context.Context, user *User) error
 	GetUser(ctx context.Context, name string) (*User, error)
+	UpdatePassword(ctx context.Context, name, hashPassword string) error
+	UpdateRole(ctx context.Context, name, role string) error
 }
 
 type URLStorage interface {
-	CreateURL(ctx context.Context, username, url, alias string) error
-	GetURL(ctx context.Context, alias string) (string, error)
+	CreateURL(ctx context.Context, username, alias string, target *Target) error
+	GetURL(ctx context.Context, alias string) (*Target, error)
+	GetURLInfo(ctx context.Context, alias string) (*URL, error)
+	GetUserURL(ctx context.Context, username, alias string) (string, error)
+	UpdateURL(ctx context.Context, username, alias string, target *Target) error
+	FlagURL(ctx context.Context, alias, threat string) error
+	SetMetadata(ctx context.Context, alias, url string, metadata *Metadata) error
+	ScanURLs(ctx context.Context, after string, limit uint64) ([]URL, error)
+	ScanHealth(ctx context.Context, after string, limit uint64) ([]HealthState, error)
+	SetHealth(ctx context.Context, alias, url string, health *Health) error
 	CountIncrement(alias string) error
+	CountCountry(alias, country string) error
+	CountVariant(alias, url string) error
 	DeleteURL(ctx context.Context, username, alias string) error
-	GetURLs(ctx context.Context, username string, limit, offset uint64) ([]URL, uint64, error)
+	GetURLs(ctx context.Context, username string, filter *URLFilter, limit, offset uint64) ([]URL, uint64, error)
+	GetCampaignStats(ctx context.Context, username string, filter *UTM) ([]CampaignStats, error)
 	CheckAlias(ctx context.Context, alias string) (bool, error)
+	GetAliasByURL(ctx context.Context, username string, target *Target) (string, error)
+	ScanAliases(ctx context.Context, after string, limit uint64) ([]string, error)
+	RenameAlias(ctx context.Context, alias, newAlias string) error
+}
+
+type UTMStorage interface {
+	GetUTMDefaults(ctx context.Context, username string) (*UTM, error)
+	SetUTMDefaults(ctx context.Context, username string, defaults *UTM) error
+}
+
+type HostRuleStorage interface {
+	CreateHostRule(ctx context.Context, rule *HostRule) (int64, error)
+	GetHostRules(ctx context.Context) ([]HostRule, error)
+	DeleteHostRule(ctx context.Context, id int64) error
+}
+
+type AliasTermStorage interface {
+	CreateAliasTerm(ctx context.Context, term *AliasTerm) (int64, error)
+	GetAliasTerms(ctx context.Context) ([]AliasTerm, error)
+	DeleteAliasTerm(ctx context.Context, id int64) error
+}
+
+type WebhookStorage interface {
+	CreateWebhook(ctx context.Context, webhook *Webhook) (int64, error)
+	GetWebhooks(ctx context.Context, username string) ([]Webhook, error)
+	GetWebhook(ctx context.Context, username string, id int64) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, username string, id int64) error
+	EnqueueEvent(ctx context.Context, username, event string, payload []byte) error
+	GetDeliveries(ctx context.Context, username string, webhookID int64, limit, offset uint64) ([]Delivery, error)
+	Redeliver(ctx context.Context, username string, webhookID, id int64) error
+	ClaimDeliveries(ctx context.Context, limit uint64, lease time.Duration) ([]PendingDelivery, error)
+	SetDeliveryResult(ctx context.Context, id int64, result *DeliveryResult) error
+	ReleaseDelivery(ctx context.Context, id int64) error
+	DeleteDeliveries(ctx context.Context, before time.Time) (int64, error)
+	GetClicksCrossed(ctx context.Context, threshold, limit uint64) ([]OwnedURL, error)
+	SetClicksNotified(ctx context.Context, alias string, threshold uint64) error
+	GetExpiredURLs(ctx context.Context, now time.Time, limit uint64) ([]OwnedURL, error)
+	SetExpiredNotified(ctx context.Context, alias string) error
 }
 
 type Storage interface {
 	UserStorage
 	URLStorage
+	HostRuleStorage
+	AliasTermStorage
+	UTMStorage
+	WebhookStorage
 }
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2026, time.March, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	schedule := Schedule{
+		ActiveFrom:  &start,
+		ActiveUntil: &end,
+		Changes: []ScheduledChange{
+			{At: start.Add(2 * time.Hour), URL: "https://example.com/live"},
+			{At: start.Add(6 * time.Hour), URL: "https://example.com/recording"},
+		},
+	}
+	tests := []struct {
+		name        string
+		now         time.Time
+		expectedURL string
+		nextChange  time.Time
+	}{
+		{"before start", start.Add(-time.Hour), "https://example.com/register", start},
+		{"at start", start, "https://example.com/register", start.Add(2 * time.Hour)},
+		{"at first change", start.Add(2 * time.Hour), "https://example.com/live", start.Add(6 * time.Hour)},
+		{"after last change", start.Add(7 * time.Hour), "https://example.com/recording", end},
+		{"after end", end.Add(time.Hour), "https://example.com/recording", time.Time{}},
+	}
+	for _, test := range tests {
+		if url := schedule.URLAt("https://example.com/register", test.now); url != test.expectedURL {
+			t.Errorf("%s: expected url %q but received %q", test.name, test.expectedURL, url)
+		}
+		if next := schedule.NextChange(test.now); !next.Equal(test.nextChange) {
+			t.Errorf("%s: expected next change %s but received %s", test.name, test.nextChange, next)
+		}
+	}
+
+	var empty Schedule
+	if next := empty.NextChange(start); !next.IsZero() {
+		t.Errorf("empty schedule: expected no next change but received %s", next)
+	}
+}
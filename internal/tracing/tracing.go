@@ -0,0 +1,104 @@
+// Package tracing sets up the export of OpenTelemetry spans and the
+// propagation of the W3C trace context.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Exporters of spans.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const serviceName = "url-shortener"
+
+var ErrUnknownExporter = errors.New("unknown exporter")
+
+type Conf struct {
+	// Exporter of spans: otlp, stdout or empty to export nothing.
+	Exporter string
+	// URL of the OTLP/HTTP collector like "http://otel-collector:4318", the
+	// OTEL_EXPORTER_OTLP_* variables are used if empty.
+	Endpoint string
+	// Share of the traces started by the service that are sampled, all if
+	// zero. Traces propagated by the caller follow its decision.
+	SampleRatio float64
+}
+
+// Shutdown flushes the spans not exported yet and stops the export.
+type Shutdown func(ctx context.Context) error
+
+// Init installs the propagator of the W3C trace context and baggage and,
+// unless the exporter is empty, the provider of tracers exporting the spans
+// of the service of the version. Instrumented clients take the provider when
+// they are created, so Init goes before them.
+func Init(ctx context.Context, conf *Conf, version string) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch conf.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(conf.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = newStdoutExporter(os.Stdout)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExporter, conf.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("new %s exporter: %w", conf.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("new resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler(conf.SampleRatio)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func newStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint()) //nolint:wrapcheck
+}
+
+func newSampler(ratio float64) sdktrace.Sampler {
+	if ratio <= 0 || ratio >= 1 {
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInit(t *testing.T) {
+	shutdown, err := Init(context.Background(), &Conf{}, "v1.0.0") //nolint:exhaustruct
+	if err != nil {
+		t.Fatalf("init disabled: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown disabled: %v", err)
+	}
+
+	if _, err := Init(context.Background(), &Conf{Exporter: "zipkin"}, "v1.0.0"); !errors.Is(err, ErrUnknownExporter) { //nolint:exhaustruct
+		t.Errorf("expected error %q but received %v", ErrUnknownExporter, err)
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter, err := newStdoutExporter(&buf)
+	if err != nil {
+		t.Fatalf("new exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(context.Background(), "GET /{alias...}")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), span.SpanContext().TraceID().String()) {
+		t.Errorf("expected trace id %s in %q", span.SpanContext().TraceID(), buf.String())
+	}
+}
+
+func TestSampler(t *testing.T) {
+	remote := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{ //nolint:exhaustruct
+		TraceID:    trace.TraceID{0x4b, 0xf9},
+		SpanID:     trace.SpanID{0x01},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	tests := []struct {
+		ratio    float64
+		ctx      context.Context
+		expected bool
+	}{
+		{0, context.Background(), true},
+		{1, context.Background(), true},
+		{0.000001, context.Background(), false},
+		{0.000001, remote, true},
+	}
+	for _, test := range tests {
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(newSampler(test.ratio)))
+		_, span := provider.Tracer("test").Start(test.ctx, "span")
+		if sampled := span.SpanContext().IsSampled(); sampled != test.expected {
+			t.Errorf("ratio %v: expected sampled %t but received %t", test.ratio, test.expected, sampled)
+		}
+	}
+}
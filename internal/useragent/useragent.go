@@ -0,0 +1,71 @@
+// Package useragent tells the operating system and the type of the device
+// from the User-Agent header, as far as targeting of links needs it.
+package useragent
+
+import "strings"
+
+const (
+	OSIOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	// DeviceBot is crawlers and link preview fetchers, no targeting rule
+	// matches them.
+	DeviceBot = "bot"
+)
+
+//nolint:gochecknoglobals
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "preview", "curl/", "wget/"}
+
+// Agent is the client described by a User-Agent header. OS is empty if it
+// is not known.
+type Agent struct {
+	OS     string
+	Device string
+}
+
+// Parse reads the User-Agent header. Unknown clients are desktops with no
+// OS.
+func Parse(userAgent string) Agent {
+	ua := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return Agent{OS: "", Device: DeviceBot}
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "ipad"):
+		return Agent{OS: OSIOS, Device: DeviceTablet}
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return Agent{OS: OSIOS, Device: DeviceMobile}
+	case strings.Contains(ua, "android"):
+		// Android tablets do not send "Mobile".
+		if strings.Contains(ua, "mobile") {
+			return Agent{OS: OSAndroid, Device: DeviceMobile}
+		}
+		return Agent{OS: OSAndroid, Device: DeviceTablet}
+	case strings.Contains(ua, "windows phone"):
+		return Agent{OS: OSWindows, Device: DeviceMobile}
+	case strings.Contains(ua, "windows"):
+		return Agent{OS: OSWindows, Device: DeviceDesktop}
+	case strings.Contains(ua, "cros"):
+		return Agent{OS: OSChromeOS, Device: DeviceDesktop}
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		// iPadOS presents itself as macOS, but only iPads have touch
+		// screens, which the header does not tell.
+		return Agent{OS: OSMacOS, Device: DeviceDesktop}
+	case strings.Contains(ua, "linux"):
+		return Agent{OS: OSLinux, Device: DeviceDesktop}
+	default:
+		return Agent{OS: "", Device: DeviceDesktop}
+	}
+}
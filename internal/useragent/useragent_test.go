@@ -0,0 +1,29 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  Agent
+	}{
+		{"iphone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", Agent{OSIOS, DeviceMobile}},
+		{"ipad", "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1", Agent{OSIOS, DeviceTablet}},
+		{"android phone", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", Agent{OSAndroid, DeviceMobile}},
+		{"android tablet", "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", Agent{OSAndroid, DeviceTablet}},
+		{"windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", Agent{OSWindows, DeviceDesktop}},
+		{"macos", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", Agent{OSMacOS, DeviceDesktop}},
+		{"linux", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", Agent{OSLinux, DeviceDesktop}},
+		{"chromeos", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", Agent{OSChromeOS, DeviceDesktop}},
+		{"googlebot", "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Agent{"", DeviceBot}},
+		{"telegram preview", "TelegramBot (like TwitterBot)", Agent{"", DeviceBot}},
+		{"curl", "curl/8.5.0", Agent{"", DeviceBot}},
+		{"empty", "", Agent{"", DeviceDesktop}},
+	}
+	for _, test := range tests {
+		if agent := Parse(test.userAgent); agent != test.expected {
+			t.Errorf("%s: expected %+v but received %+v", test.name, test.expected, agent)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Package webhook sends the events of links to the webhooks their owners
+// subscribed to. Webhooks belong to users, there are no shared workspaces. Events are queued in the storage and sent in the background
+// as JSON signed with HMAC-SHA256 by the secret of the webhook.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+	"github.com/mrvin/url-shortener/pkg/retry"
+)
+
+// Events of links.
+const (
+	EventCreated   = "link.created"
+	EventUpdated   = "link.updated"
+	EventDeleted   = "link.deleted"
+	EventExpired   = "link.expired"
+	EventClicks    = "link.clicks"
+	EventBroken    = "link.broken"
+	EventRecovered = "link.recovered"
+)
+
+// Headers of the requests to webhooks.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 10
+	defaultMaxAttempts = 10
+	defaultRetryDelay  = time.Second
+	defaultRetention   = 30 * 24 * time.Hour
+
+	// Delay before the second attempt, doubled before each next one.
+	attemptDelay    = time.Minute
+	maxAttemptDelay = 6 * time.Hour
+
+	batchSize    = 100
+	maxErrorSize = 300
+	secretSize   = 32
+
+	userAgent = "url-shortener-webhook/1.0"
+)
+
+// Events are all the events a webhook may subscribe to.
+var Events = []string{EventCreated, EventUpdated, EventDeleted, EventExpired, EventClicks, EventBroken, EventRecovered}
+
+var errTransient = errors.New("transient failure")
+
+type Conf struct {
+	// How often queued events are sent and links are checked for expiry and
+	// click thresholds, webhooks are disabled if zero.
+	Interval time.Duration
+	// Time limit of a request.
+	Timeout time.Duration
+	// How many deliveries are sent at once.
+	Concurrency int
+	// How many attempts are made before a delivery fails for good.
+	MaxAttempts int
+	// How many times a transient failure is retried within an attempt.
+	Retries int
+	// Delay before the first retry, doubled before each next one.
+	RetryDelay time.Duration
+	// Numbers of clicks link.clicks is sent at.
+	ClickThresholds []uint64
+	// How long sent and failed deliveries are kept.
+	Retention time.Duration
+}
+
+type WebhookStorage interface {
+	EnqueueEvent(ctx context.Context, username, event string, payload []byte) error
+	ClaimDeliveries(ctx context.Context, limit uint64, lease time.Duration) ([]storage.PendingDelivery, error)
+	SetDeliveryResult(ctx context.Context, id int64, result *storage.DeliveryResult) error
+	ReleaseDelivery(ctx context.Context, id int64) error
+	DeleteDeliveries(ctx context.Context, before time.Time) (int64, error)
+	GetClicksCrossed(ctx context.Context, threshold, limit uint64) ([]storage.OwnedURL, error)
+	SetClicksNotified(ctx context.Context, alias string, threshold uint64) error
+	GetExpiredURLs(ctx context.Context, now time.Time, limit uint64) ([]storage.OwnedURL, error)
+	SetExpiredNotified(ctx context.Context, alias string) error
+}
+
+// Link is the link an event is about.
+//
+//nolint:tagliatelle
+type Link struct {
+	Username    string          `json:"username"`
+	Alias       string          `json:"alias"`
+	URL         string          `json:"url,omitempty"`
+	Count       uint64          `json:"count,omitempty"`
+	Threshold   uint64          `json:"threshold,omitempty"`
+	ActiveUntil *time.Time      `json:"active_until,omitempty"`
+	Health      *storage.Health `json:"health,omitempty"`
+}
+
+// Payload is the body of the request to a webhook.
+//
+//nolint:tagliatelle
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Link      *Link     `json:"link"`
+}
+
+// Dispatcher queues the events of links and sends them to webhooks.
+type Dispatcher struct {
+	conf   Conf
+	client *http.Client
+	st     WebhookStorage
+}
+
+func New(conf *Conf, st WebhookStorage) *Dispatcher {
+	c := *conf
+	if c.Timeout <= 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = defaultRetryDelay
+	}
+	if c.Retention <= 0 {
+		c.Retention = defaultRetention
+	}
+	// The highest threshold is checked first so that a link crossing
+	// several of them at once is notified of the highest only.
+	c.ClickThresholds = slices.Clone(c.ClickThresholds)
+	slices.Sort(c.ClickThresholds)
+	slices.Reverse(c.ClickThresholds)
+
+	return &Dispatcher{
+		conf:   c,
+		client: destination.NewClient(c.Timeout, 0, false),
+		st:     st,
+	}
+}
+
+// Enabled tells whether events are queued and sent.
+func (d *Dispatcher) Enabled() bool {
+	return d.conf.Interval > 0
+}
+
+// Publish queues the event for the webhooks of the owner of the link.
+func (d *Dispatcher) Publish(ctx context.Context, event string, link *Link) error {
+	if !d.Enabled() {
+		return nil
+	}
+	payload, err := json.Marshal(&Payload{Event: event, CreatedAt: time.Now().UTC(), Link: link})
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	if err := d.st.EnqueueEvent(ctx, link.Username, event, payload); err != nil {
+		return fmt.Errorf("enqueue %s: %w", event, err)
+	}
+
+	return nil
+}
+
+// NotifyHealth sends link.broken or link.recovered to the webhooks of the
+// owner.
+func (d *Dispatcher) NotifyHealth(ctx context.Context, state *storage.HealthState, h *storage.Health) {
+	event := EventRecovered
+	if h.Broken {
+		event = EventBroken
+	}
+	link := Link{Username: state.Username, Alias: state.Alias, URL: state.URL, Health: h}
+	if err := d.Publish(ctx, event, &link); err != nil {
+		slog.WarnContext(ctx, "Notify health", slog.String("alias", state.Alias), slog.String("warn", err.Error()))
+	}
+}
+
+// Run sends the queued events and checks the links every interval until the
+// context is canceled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if !d.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(d.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Sweep(ctx); err != nil {
+				slog.WarnContext(ctx, "Webhooks sweep", slog.String("warn", err.Error()))
+			}
+			sent, err := d.Deliver(ctx)
+			if err != nil {
+				slog.WarnContext(ctx, "Webhooks delivery", slog.String("warn", err.Error()))
+			}
+			if sent > 0 {
+				slog.InfoContext(ctx, "Webhooks delivery", slog.Int("sent", sent))
+			}
+		}
+	}
+}
+
+// Sweep queues link.expired for the links expired since the last sweep and
+// link.clicks for the links that crossed a click threshold, and deletes the
+// deliveries older than the retention. An event is queued before the link is
+// marked as notified, so it is sent at least once.
+func (d *Dispatcher) Sweep(ctx context.Context) error {
+	for {
+		urls, err := d.st.GetExpiredURLs(ctx, time.Now(), batchSize)
+		if err != nil {
+			return fmt.Errorf("get expired urls: %w", err)
+		}
+		for _, url := range urls {
+			link := Link{Username: url.Username, Alias: url.Alias, URL: url.URL, Count: url.Count, ActiveUntil: url.ActiveUntil}
+			if err := d.Publish(ctx, EventExpired, &link); err != nil {
+				return err
+			}
+			if err := d.st.SetExpiredNotified(ctx, url.Alias); err != nil {
+				return fmt.Errorf("set expired notified: %w", err)
+			}
+		}
+		if len(urls) < batchSize {
+			break
+		}
+	}
+
+	for _, threshold := range d.conf.ClickThresholds {
+		for {
+			urls, err := d.st.GetClicksCrossed(ctx, threshold, batchSize)
+			if err != nil {
+				return fmt.Errorf("get clicks crossed: %w", err)
+			}
+			for _, url := range urls {
+				link := Link{Username: url.Username, Alias: url.Alias, URL: url.URL, Count: url.Count, Threshold: threshold}
+				if err := d.Publish(ctx, EventClicks, &link); err != nil {
+					return err
+				}
+				if err := d.st.SetClicksNotified(ctx, url.Alias, threshold); err != nil {
+					return fmt.Errorf("set clicks notified: %w", err)
+				}
+			}
+			if len(urls) < batchSize {
+				break
+			}
+		}
+	}
+
+	if _, err := d.st.DeleteDeliveries(ctx, time.Now().Add(-d.conf.Retention)); err != nil {
+		return fmt.Errorf("delete deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// Deliver sends the deliveries due now and returns how many were sent.
+func (d *Dispatcher) Deliver(ctx context.Context) (int, error) {
+	var sent int
+	for {
+		deliveries, err := d.st.ClaimDeliveries(ctx, batchSize, d.lease())
+		if err != nil {
+			return sent, fmt.Errorf("claim deliveries: %w", err)
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, d.conf.Concurrency)
+		for _, delivery := range deliveries {
+			sem <- struct{}{}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				result := d.send(ctx, &delivery)
+				if ctx.Err() != nil {
+					// Interrupted by the shutdown, the delivery is sent again
+					// at once rather than when the claim expires.
+					if err := d.st.ReleaseDelivery(context.WithoutCancel(ctx), delivery.ID); err != nil {
+						slog.WarnContext(ctx, "Webhooks delivery", slog.Int64("delivery", delivery.ID), slog.String("warn", err.Error()))
+					}
+					return
+				}
+				if err := d.st.SetDeliveryResult(ctx, delivery.ID, result); err != nil {
+					slog.WarnContext(ctx, "Webhooks delivery", slog.Int64("delivery", delivery.ID), slog.String("warn", err.Error()))
+					return
+				}
+				if result.Status == storage.DeliveryDelivered {
+					mu.Lock()
+					sent++
+					mu.Unlock()
+				}
+			})
+		}
+		wg.Wait()
+
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return sent, nil
+		}
+	}
+}
+
+// lease is the time a claimed delivery may take to be sent with all its
+// retries.
+func (d *Dispatcher) lease() time.Duration {
+	return time.Duration(d.conf.Retries+1)*d.conf.Timeout + d.conf.RetryDelay<<d.conf.Retries + time.Minute
+}
+
+// send posts the payload to the webhook, retrying transient failures, and
+// returns the outcome of the attempt. A failed attempt is made again later
+// until there are no attempts left.
+func (d *Dispatcher) send(ctx context.Context, delivery *storage.PendingDelivery) *storage.DeliveryResult {
+	var status int
+	attempt := func(ctx context.Context) error {
+		var err error
+		status, err = d.post(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+			return fmt.Errorf("%w: status %d", errTransient, status)
+		}
+		return nil
+	}
+	err := retry.WithDelay(attempt, d.conf.Retries, d.conf.RetryDelay)(ctx)
+
+	now := time.Now().UTC()
+	result := storage.DeliveryResult{
+		Status:        storage.DeliveryDelivered,
+		LastStatus:    status,
+		AttemptedAt:   now,
+		NextAttemptAt: now,
+	}
+	if err == nil && status >= http.StatusOK && status < http.StatusMultipleChoices {
+		return &result
+	}
+
+	if err != nil {
+		result.LastError = truncate(err.Error(), maxErrorSize)
+	} else {
+		result.LastError = "unexpected status " + strconv.Itoa(status)
+	}
+	attempts := delivery.Attempts + 1
+	if attempts >= d.conf.MaxAttempts {
+		result.Status = storage.DeliveryFailed
+		return &result
+	}
+	result.Status = storage.DeliveryPending
+	result.NextAttemptAt = now.Add(backoff(attempts))
+
+	return &result
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *storage.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("new request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post: %w", err)
+	}
+	defer destination.DiscardBody(res)
+
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature of the body sent at the unix timestamp, the
+// hex encoded HMAC-SHA256 of "timestamp.body" by the secret prefixed with
+// "sha256=". Receivers compute it the same way and compare in constant time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random secret to sign the payloads of a webhook.
+func NewSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// backoff returns the delay before the next attempt after the given number
+// of attempts.
+func backoff(attempts int) time.Duration {
+	delay := attemptDelay
+	for range attempts - 1 {
+		if delay *= 2; delay >= maxAttemptDelay {
+			return maxAttemptDelay
+		}
+	}
+
+	return delay
+}
+
+func truncate(str string, size int) string {
+	if len(str) <= size {
+		return str
+	}
+
+	return str[:size]
+}
@@ -0,0 +1,299 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mrvin/url-shortener/internal/destination"
+	"github.com/mrvin/url-shortener/internal/storage"
+)
+
+type event struct {
+	username string
+	event    string
+	payload  Payload
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	events   []event
+	pending  []storage.PendingDelivery
+	results  map[int64]storage.DeliveryResult
+	released []int64
+	urls     []storage.OwnedURL
+	clicks   map[string]uint64
+	expired  map[string]bool
+	deleteAt time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		results: make(map[int64]storage.DeliveryResult),
+		clicks:  make(map[string]uint64),
+		expired: make(map[string]bool),
+	}
+}
+
+func (s *memoryStore) EnqueueEvent(_ context.Context, username, name string, payload []byte) error {
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	s.events = append(s.events, event{username: username, event: name, payload: p})
+
+	return nil
+}
+
+func (s *memoryStore) ClaimDeliveries(_ context.Context, limit uint64, _ time.Duration) ([]storage.PendingDelivery, error) {
+	n := min(int(limit), len(s.pending))
+	claimed := s.pending[:n]
+	s.pending = s.pending[n:]
+
+	return claimed, nil
+}
+
+func (s *memoryStore) SetDeliveryResult(_ context.Context, id int64, result *storage.DeliveryResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = *result
+
+	return nil
+}
+
+func (s *memoryStore) ReleaseDelivery(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = append(s.released, id)
+
+	return nil
+}
+
+func (s *memoryStore) DeleteDeliveries(_ context.Context, before time.Time) (int64, error) {
+	s.deleteAt = before
+	return 0, nil
+}
+
+func (s *memoryStore) GetClicksCrossed(_ context.Context, threshold, limit uint64) ([]storage.OwnedURL, error) {
+	urls := make([]storage.OwnedURL, 0)
+	for _, url := range s.urls {
+		if s.clicks[url.Alias] < threshold && url.Count >= threshold && uint64(len(urls)) < limit {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+func (s *memoryStore) SetClicksNotified(_ context.Context, alias string, threshold uint64) error {
+	s.clicks[alias] = max(s.clicks[alias], threshold)
+	return nil
+}
+
+func (s *memoryStore) GetExpiredURLs(_ context.Context, now time.Time, limit uint64) ([]storage.OwnedURL, error) {
+	urls := make([]storage.OwnedURL, 0)
+	for _, url := range s.urls {
+		if url.ActiveUntil != nil && !url.ActiveUntil.After(now) && !s.expired[url.Alias] && uint64(len(urls)) < limit {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+func (s *memoryStore) SetExpiredNotified(_ context.Context, alias string) error {
+	s.expired[alias] = true
+	return nil
+}
+
+func newDispatcher(st WebhookStorage) *Dispatcher {
+	dispatcher := New(&Conf{Interval: time.Minute, Retries: 1, RetryDelay: time.Millisecond, MaxAttempts: 3, ClickThresholds: []uint64{10, 1000, 100}}, st)
+	dispatcher.client = destination.NewClient(time.Second, 0, true)
+
+	return dispatcher
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"event":"link.created"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=4183334cf814c621c4bd89e061af921be573dd36def10573e13eca9fe9857c31"
+	if signature := Sign("secret", 1700000000, []byte(`{"event":"link.created"}`)); signature != expected {
+		t.Errorf("expected %q but received %q", expected, signature)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	st := newMemoryStore()
+	dispatcher := newDispatcher(st)
+	if err := dispatcher.Publish(context.Background(), EventCreated, &Link{Username: "Bob", Alias: "zn9edcu", URL: "https://example.com"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(st.events) != 1 {
+		t.Fatalf("expected 1 event but received %d", len(st.events))
+	}
+	e := st.events[0]
+	if e.username != "Bob" || e.event != EventCreated || e.payload.Event != EventCreated || e.payload.Link.Alias != "zn9edcu" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// A disabled dispatcher queues nothing.
+	st = newMemoryStore()
+	if err := New(&Conf{}, st).Publish(context.Background(), EventCreated, &Link{Username: "Bob"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(st.events) != 0 {
+		t.Errorf("expected no events but received %d", len(st.events))
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var flaky atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+		if req.Header.Get(HeaderSignature) != Sign("secret", timestamp, body) || req.Header.Get(HeaderEvent) != EventCreated {
+			res.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	mux.HandleFunc("/flaky", func(res http.ResponseWriter, _ *http.Request) {
+		if flaky.Add(1) == 1 {
+			res.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	mux.HandleFunc("/rejected", func(res http.ResponseWriter, _ *http.Request) {
+		res.WriteHeader(http.StatusBadRequest)
+	})
+	mux.Handle("/moved", http.RedirectHandler("/ok", http.StatusFound))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	payload := []byte(`{"event":"link.created"}`)
+	st := newMemoryStore()
+	st.pending = []storage.PendingDelivery{
+		{ID: 1, URL: server.URL + "/ok", Secret: "secret", Event: EventCreated, Payload: payload},
+		{ID: 2, URL: server.URL + "/ok", Secret: "wrong", Event: EventCreated, Payload: payload},
+		{ID: 3, URL: server.URL + "/flaky", Secret: "secret", Event: EventCreated, Payload: payload},
+		{ID: 4, URL: server.URL + "/rejected", Secret: "secret", Event: EventCreated, Payload: payload, Attempts: 2},
+		{ID: 5, URL: server.URL + "/moved", Secret: "secret", Event: EventCreated, Payload: payload},
+	}
+	sent, err := newDispatcher(st).Deliver(context.Background())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if sent != 2 {
+		t.Errorf("expected 2 sent but received %d", sent)
+	}
+
+	tests := []struct {
+		id         int64
+		status     string
+		lastStatus int
+	}{
+		{1, storage.DeliveryDelivered, http.StatusOK},
+		{2, storage.DeliveryPending, http.StatusUnauthorized},
+		{3, storage.DeliveryDelivered, http.StatusOK},
+		{4, storage.DeliveryFailed, http.StatusBadRequest},
+		{5, storage.DeliveryPending, http.StatusFound},
+	}
+	for _, test := range tests {
+		result := st.results[test.id]
+		if result.Status != test.status || result.LastStatus != test.lastStatus {
+			t.Errorf("delivery %d: expected %s with status %d but received %s with status %d",
+				test.id, test.status, test.lastStatus, result.Status, result.LastStatus)
+		}
+		if test.status == storage.DeliveryPending && !result.NextAttemptAt.After(result.AttemptedAt) {
+			t.Errorf("delivery %d: expected the next attempt later", test.id)
+		}
+		if test.status != storage.DeliveryDelivered && result.LastError == "" {
+			t.Errorf("delivery %d: expected error", test.id)
+		}
+	}
+}
+
+func TestDeliverShutdown(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	st := newMemoryStore()
+	st.pending = []storage.PendingDelivery{
+		{ID: 1, URL: server.URL, Secret: "secret", Event: EventCreated, Payload: []byte(`{}`)},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := newDispatcher(st).Deliver(ctx); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if _, ok := st.results[1]; ok || len(st.released) != 1 || st.released[0] != 1 {
+		t.Errorf("expected delivery 1 released without a result but received %v and %v", st.results, st.released)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	st := newMemoryStore()
+	st.urls = []storage.OwnedURL{
+		{Username: "Bob", Alias: "expired", URL: "https://example.com/sale", Count: 5, ActiveUntil: &past},
+		{Username: "Bob", Alias: "active", URL: "https://example.com", Count: 9, ActiveUntil: &future},
+		{Username: "Alice", Alias: "popular", URL: "https://example.org", Count: 150},
+	}
+	st.clicks["popular"] = 10
+
+	dispatcher := newDispatcher(st)
+	if err := dispatcher.Sweep(context.Background()); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if len(st.events) != 2 {
+		t.Fatalf("expected 2 events but received %+v", st.events)
+	}
+	if e := st.events[0]; e.event != EventExpired || e.payload.Link.Alias != "expired" || e.username != "Bob" {
+		t.Errorf("expected expiry of \"expired\" but received %+v", e)
+	}
+	if e := st.events[1]; e.event != EventClicks || e.payload.Link.Alias != "popular" || e.payload.Link.Threshold != 100 {
+		t.Errorf("expected 100 clicks of \"popular\" but received %+v", e)
+	}
+	if st.deleteAt.IsZero() {
+		t.Error("expected old deliveries deleted")
+	}
+
+	// Nothing is sent twice.
+	if err := dispatcher.Sweep(context.Background()); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if len(st.events) != 2 {
+		t.Errorf("expected no more events but received %+v", st.events[2:])
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{20, maxAttemptDelay},
+	}
+	for _, test := range tests {
+		if delay := backoff(test.attempts); delay != test.expected {
+			t.Errorf("%d attempts: expected %v but received %v", test.attempts, test.expected, delay)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS host_rules(
+	id BIGSERIAL PRIMARY KEY,
+	list TEXT NOT NULL CHECK (list IN ('deny', 'allow')),
+	type TEXT NOT NULL CHECK (type IN ('exact', 'wildcard', 'regex')),
+	pattern TEXT NOT NULL,
+	created_by TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	UNIQUE (list, type, pattern)
+);
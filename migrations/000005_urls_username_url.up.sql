@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_urls_username_url ON urls(username, url);
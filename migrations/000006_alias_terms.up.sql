@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS alias_terms(
+	id BIGSERIAL PRIMARY KEY,
+	term TEXT NOT NULL,
+	match TEXT NOT NULL CHECK (match IN ('exact', 'contains')),
+	created_by TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	UNIQUE (term, match)
+);
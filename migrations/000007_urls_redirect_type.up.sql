@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type SMALLINT NOT NULL DEFAULT 0
+	CHECK (redirect_type IN (0, 301, 302, 303, 307, 308));
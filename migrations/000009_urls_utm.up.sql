@@ -0,0 +1,15 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_medium TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_campaign TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_term TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_content TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_urls_username_utm_campaign ON urls(username, utm_campaign);
+
+CREATE TABLE IF NOT EXISTS utm_defaults(
+	username TEXT NOT NULL UNIQUE PRIMARY KEY references users(name) on delete cascade,
+	utm_source TEXT NOT NULL DEFAULT '',
+	utm_medium TEXT NOT NULL DEFAULT '',
+	utm_campaign TEXT NOT NULL DEFAULT '',
+	utm_term TEXT NOT NULL DEFAULT '',
+	utm_content TEXT NOT NULL DEFAULT ''
+);
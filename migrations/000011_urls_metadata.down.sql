@@ -0,0 +1,5 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS meta_fetched_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS meta_favicon;
+ALTER TABLE urls DROP COLUMN IF EXISTS meta_image;
+ALTER TABLE urls DROP COLUMN IF EXISTS meta_description;
+ALTER TABLE urls DROP COLUMN IF EXISTS meta_title;
@@ -0,0 +1,5 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_description TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_image TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_favicon TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_fetched_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS url_countries(
+	alias TEXT NOT NULL references urls(alias) on delete cascade,
+	country TEXT NOT NULL,
+	count BIGINT NOT NULL CHECK (count >= 0) DEFAULT 0,
+	PRIMARY KEY (alias, country)
+);
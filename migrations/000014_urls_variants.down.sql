@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS url_variants;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS sticky;
+ALTER TABLE urls DROP COLUMN IF EXISTS variants;
@@ -0,0 +1,9 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS sticky BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS url_variants(
+	alias TEXT NOT NULL references urls(alias) on delete cascade,
+	url TEXT NOT NULL,
+	count BIGINT NOT NULL CHECK (count >= 0) DEFAULT 0,
+	PRIMARY KEY (alias, url)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_urls_username_broken;
+ALTER TABLE urls DROP COLUMN IF EXISTS broken;
+ALTER TABLE urls DROP COLUMN IF EXISTS health_checked_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS health_error;
+ALTER TABLE urls DROP COLUMN IF EXISTS health_latency_ms;
+ALTER TABLE urls DROP COLUMN IF EXISTS health_status;
@@ -0,0 +1,6 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health_status INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health_latency_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health_checked_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS broken BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_urls_username_broken ON urls(username) WHERE broken;
@@ -0,0 +1,7 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS expired_notified;
+ALTER TABLE urls DROP COLUMN IF EXISTS clicks_notified;
+DROP INDEX IF EXISTS idx_webhook_deliveries_pending;
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_webhooks_username;
+DROP TABLE IF EXISTS webhooks;
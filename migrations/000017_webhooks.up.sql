@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webhooks(
+	id BIGSERIAL PRIMARY KEY,
+	username TEXT NOT NULL references users(name) on delete cascade,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events JSONB NOT NULL DEFAULT '[]',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_username ON webhooks(username);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id BIGINT NOT NULL references webhooks(id) on delete cascade,
+	event TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'failed')) DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_status INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	last_attempt_at TIMESTAMPTZ,
+	next_attempt_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks_notified BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expired_notified BOOLEAN NOT NULL DEFAULT FALSE;
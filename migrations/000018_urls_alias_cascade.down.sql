@@ -0,0 +1,4 @@
+ALTER TABLE url_countries DROP CONSTRAINT IF EXISTS url_countries_alias_fkey,
+	ADD CONSTRAINT url_countries_alias_fkey FOREIGN KEY (alias) REFERENCES urls(alias) ON DELETE CASCADE;
+ALTER TABLE url_variants DROP CONSTRAINT IF EXISTS url_variants_alias_fkey,
+	ADD CONSTRAINT url_variants_alias_fkey FOREIGN KEY (alias) REFERENCES urls(alias) ON DELETE CASCADE;
@@ -0,0 +1,32 @@
+package errcode
+
+import "errors"
+
+// Error is an error with a stable machine-readable code,
+// so that API clients need not parse error messages.
+type Error struct {
+	code string
+	msg  string
+}
+
+func New(code, msg string) *Error {
+	return &Error{code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Code() string {
+	return e.code
+}
+
+// Of returns the code of the first coded error in the chain or "".
+func Of(err error) string {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	return ""
+}
@@ -40,8 +40,8 @@ func (l *Logger) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	requestID := uuid.New().String()
 	ctx := logger.WithRequestID(req.Context(), requestID)
 
+	// The request id and the trace id are added from the context.
 	logReq := slog.With(
-		slog.String("requestID", requestID),
 		slog.String("method", req.Method),
 		slog.String("path", req.URL.Path),
 		slog.String("addr", req.RemoteAddr),
@@ -49,7 +49,7 @@ func (l *Logger) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	timeStart := time.Now()
 	lrw := NewLoggingResponseWriter(res)
 	defer func() {
-		logReq.Info("Request "+req.Proto,
+		logReq.InfoContext(ctx, "Request "+req.Proto,
 			slog.Int("status", lrw.statusCode),
 			slog.Int("bytes", lrw.totalWritByte),
 			slog.String("duration", time.Since(timeStart).String()),
@@ -0,0 +1,118 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver determines the client address of a request. The X-Forwarded-For
+// and X-Real-IP headers are trusted only when the request comes from one of
+// the trusted proxies.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+func New(trusted []netip.Prefix) *Resolver {
+	return &Resolver{trusted: trusted}
+}
+
+// ParsePrefixes parses trusted proxies given as CIDR prefixes or single addresses.
+func ParsePrefixes(trustedProxies []string) ([]netip.Prefix, error) {
+	trusted := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, str := range trustedProxies {
+		if !strings.Contains(str, "/") {
+			addr, err := netip.ParseAddr(str)
+			if err != nil {
+				return nil, fmt.Errorf("parse trusted proxy %q: %w", str, err)
+			}
+			trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(str)
+		if err != nil {
+			return nil, fmt.Errorf("parse trusted proxy %q: %w", str, err)
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	return trusted, nil
+}
+
+// ClientIP returns the first untrusted address walking X-Forwarded-For from
+// right to left, or the remote address if it is not a trusted proxy.
+func (r *Resolver) ClientIP(req *http.Request) netip.Addr {
+	remote := parseAddr(req.RemoteAddr)
+	if !r.isTrusted(remote) {
+		return remote
+	}
+
+	forwarded := req.Header.Values("X-Forwarded-For")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hops := strings.Split(forwarded[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			addr := parseAddr(strings.TrimSpace(hops[j]))
+			if !addr.IsValid() {
+				return remote
+			}
+			if !r.isTrusted(addr) {
+				return addr
+			}
+			remote = addr
+		}
+	}
+	if addr := parseAddr(req.Header.Get("X-Real-IP")); addr.IsValid() {
+		return addr
+	}
+
+	return remote
+}
+
+// Middleware replaces the remote address of the request with the client address.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if addr := r.ClientIP(req); addr.IsValid() {
+			req.RemoteAddr = net.JoinHostPort(addr.String(), "0")
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Addr returns the remote address of the request, invalid if it is not an
+// address.
+func Addr(req *http.Request) netip.Addr {
+	return parseAddr(req.RemoteAddr)
+}
+
+// Host returns the host part of the remote address of the request.
+func Host(req *http.Request) string {
+	if addr := parseAddr(req.RemoteAddr); addr.IsValid() {
+		return addr.String()
+	}
+	return req.RemoteAddr
+}
+
+// parseAddr parses "ip", "ip:port" and "[ipv6]:port".
+func parseAddr(str string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(str); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	if addr, err := netip.ParseAddr(str); err == nil {
+		return addr.Unmap()
+	}
+	return netip.Addr{}
+}
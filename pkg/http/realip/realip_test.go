@@ -0,0 +1,47 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("parse prefixes: %v", err)
+	}
+	r := New(trusted)
+
+	tests := []struct {
+		TestName      string
+		RemoteAddr    string
+		XForwardedFor []string
+		XRealIP       string
+		Expected      string
+	}{
+		{"Direct client", "203.0.113.7:51234", nil, "", "203.0.113.7"},
+		{"Untrusted proxy headers are ignored", "203.0.113.7:51234", []string{"1.2.3.4"}, "1.2.3.4", "203.0.113.7"},
+		{"Trusted proxy", "10.0.0.2:80", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"Chain of trusted proxies", "10.0.0.2:80", []string{"1.2.3.4, 198.51.100.1, 192.168.1.1"}, "", "198.51.100.1"},
+		{"Several headers", "10.0.0.2:80", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"Real IP", "10.0.0.2:80", nil, "198.51.100.2", "198.51.100.2"},
+		{"Invalid hop", "10.0.0.2:80", []string{"garbage"}, "", "10.0.0.2"},
+		{"IPv6", "[2001:db8::1]:443", nil, "", "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.RemoteAddr
+			for _, value := range test.XForwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if test.XRealIP != "" {
+				req.Header.Set("X-Real-IP", test.XRealIP)
+			}
+			if ip := r.ClientIP(req).String(); ip != test.Expected {
+				t.Errorf("expected %s but received %s", test.Expected, ip)
+			}
+		})
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type RequestOK struct {
@@ -14,6 +17,7 @@ type RequestOK struct {
 type RequestError struct {
 	Status string `json:"status"`
 	Error  string `json:"error"`
+	Code   string `json:"code,omitempty"`
 }
 
 func WriteOK(res http.ResponseWriter, status int) {
@@ -39,9 +43,15 @@ func WriteOK(res http.ResponseWriter, status int) {
 }
 
 func WriteError(res http.ResponseWriter, description string, status int) {
+	WriteErrorCode(res, description, "", status)
+}
+
+// WriteErrorCode writes the error with a machine-readable code.
+func WriteErrorCode(res http.ResponseWriter, description, code string, status int) {
 	response := RequestError{
 		Status: "Error",
 		Error:  description,
+		Code:   code,
 	}
 
 	jsonResponse, err := json.Marshal(&response)
@@ -61,3 +71,8 @@ func WriteError(res http.ResponseWriter, description string, status int) {
 		return
 	}
 }
+
+// SetRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func SetRetryAfter(res http.ResponseWriter, d time.Duration) {
+	res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
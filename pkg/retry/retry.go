@@ -7,9 +7,17 @@ import (
 	"time"
 )
 
+const defaultDelay = 2 * time.Second
+
 type Func func(ctx context.Context) error
 
 func Retry(f Func, retries int) Func {
+	return WithDelay(f, retries, defaultDelay)
+}
+
+// WithDelay is Retry waiting delay before the first retry and twice as long
+// before each next one.
+func WithDelay(f Func, retries int, delay time.Duration) Func {
 	return func(ctx context.Context) error {
 		for r := 0; ; r++ {
 			err := f(ctx)
@@ -18,8 +26,8 @@ func Retry(f Func, retries int) Func {
 			}
 
 			// Exponential increase in latency.
-			shouldRetryAt := time.Second * 2 << r //nolint:mnd
-			slog.Warn(fmt.Sprintf("Attempt %d failed; retrying in %v", r+1, shouldRetryAt))
+			shouldRetryAt := delay << r
+			slog.WarnContext(ctx, fmt.Sprintf("Attempt %d failed; retrying in %v", r+1, shouldRetryAt))
 
 			select {
 			case <-time.After(shouldRetryAt):
@@ -5,12 +5,13 @@ class URLShortenerAPI {
         this.baseURL = API_BASE;
     }
 
-    // Получение заголовков с авторизацией
+    // Получение заголовков с CSRF-токеном для изменяющих запросов.
+    // Сама сессия передается в HttpOnly cookie.
     getAuthHeaders() {
-        const credentials = JSON.parse(localStorage.getItem('credentials') || '{}');
-        if (credentials.username && credentials.password) {
+        const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+        if (match) {
             return {
-                'Authorization': 'Basic ' + btoa(credentials.username + ':' + credentials.password),
+                'X-CSRF-Token': decodeURIComponent(match[1]),
                 'Content-Type': 'application/json'
             };
         }
@@ -23,6 +24,12 @@ class URLShortenerAPI {
         return await response.json();
     }
 
+    // Включенные возможности сервиса
+    async getConfig() {
+        const response = await fetch(`${this.baseURL}/api/config`);
+        return await response.json();
+    }
+
     // Регистрация пользователя
     async register(userData) {
         const response = await fetch(`${this.baseURL}/api/users`, {
@@ -38,16 +45,38 @@ class URLShortenerAPI {
         const response = await fetch(`${this.baseURL}/api/users/login`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
+            credentials: 'include',
             body: JSON.stringify(userData)
         });
         return await response.json();
     }
 
+    // Продление сессии
+    async refresh() {
+        const response = await fetch(`${this.baseURL}/api/users/refresh`, {
+            method: 'POST',
+            headers: this.getAuthHeaders(),
+            credentials: 'include'
+        });
+        return await response.json();
+    }
+
+    // Выход пользователя
+    async logout() {
+        const response = await fetch(`${this.baseURL}/api/users/logout`, {
+            method: 'POST',
+            headers: this.getAuthHeaders(),
+            credentials: 'include'
+        });
+        return await response.json();
+    }
+
     // Создание короткой ссылки
     async shortenUrl(urlData) {
         const response = await fetch(`${this.baseURL}/api/urls`, {
             method: 'POST',
             headers: this.getAuthHeaders(),
+            credentials: 'include',
             body: JSON.stringify(urlData)
         });
         return await response.json();
@@ -62,7 +91,8 @@ class URLShortenerAPI {
     // Получение списка URL с пагинацией
     async getUserUrls(limit = 10, offset = 0) {
         const response = await fetch(`${this.baseURL}/api/urls?limit=${limit}&offset=${offset}`, {
-            headers: this.getAuthHeaders()
+            headers: this.getAuthHeaders(),
+            credentials: 'include'
         });
         return await response.json();
     }
@@ -71,7 +101,17 @@ class URLShortenerAPI {
     async deleteUrl(alias) {
         const response = await fetch(`${this.baseURL}/api/urls/${alias}`, {
             method: 'DELETE',
-            headers: this.getAuthHeaders()
+            headers: this.getAuthHeaders(),
+            credentials: 'include'
+        });
+        return await response.json();
+    }
+
+    async refreshMetadata(alias) {
+        const response = await fetch(`${this.baseURL}/api/urls/metadata/${alias}`, {
+            method: 'POST',
+            headers: this.getAuthHeaders(),
+            credentials: 'include'
         });
         return await response.json();
     }
@@ -1,3 +1,6 @@
+// Сессия продлевается, когда до ее окончания остается меньше часа
+const REFRESH_BEFORE_MS = 60 * 60 * 1000;
+
 class AuthManager {
     constructor() {
         this.checkAuthStatus();
@@ -5,8 +8,8 @@ class AuthManager {
 
     // Проверка статуса аутентификации
     checkAuthStatus() {
-        const credentials = localStorage.getItem('credentials');
-        const isLoggedIn = !!credentials;
+        const user = JSON.parse(localStorage.getItem('user') || 'null');
+        const isLoggedIn = !!user && Date.parse(user.expiresAt) > Date.now();
         
         // Обновляем навигацию в зависимости от статуса
         this.updateNavigation(isLoggedIn);
@@ -33,7 +36,8 @@ class AuthManager {
             const result = await api.login({ username, password });
             
             if (result.status === 'OK') {
-                localStorage.setItem('credentials', JSON.stringify({ username, password }));
+                // Пароль не сохраняется: сессия хранится в HttpOnly cookie
+                localStorage.setItem('user', JSON.stringify({ username, expiresAt: result.expires_at }));
                 this.checkAuthStatus();
                 return { success: true };
             } else {
@@ -60,17 +64,46 @@ class AuthManager {
         }
     }
 
+    // Продление сессии
+    async refresh() {
+        try {
+            const result = await api.refresh();
+            if (result.status === 'OK') {
+                localStorage.setItem('user', JSON.stringify({ username: result.username, expiresAt: result.expires_at }));
+                return true;
+            }
+        } catch (error) {
+            // сессия не продлена
+        }
+        return false;
+    }
+
+    // Продление сессии, только если она скоро закончится или известна
+    // лишь по cookie (после входа через SSO)
+    async refreshIfExpiring() {
+        const user = JSON.parse(localStorage.getItem('user') || 'null');
+        if (user && Date.parse(user.expiresAt) - Date.now() > REFRESH_BEFORE_MS) {
+            return true;
+        }
+        return await this.refresh();
+    }
+
     // Выход
-    logout() {
-        localStorage.removeItem('credentials');
+    async logout() {
+        try {
+            await api.logout();
+        } catch (error) {
+            // cookie будут удалены по истечении срока сессии
+        }
+        localStorage.removeItem('user');
         this.checkAuthStatus();
         window.location.href = 'index.html';
     }
 
     // Получение текущего пользователя
     getCurrentUser() {
-        const credentials = JSON.parse(localStorage.getItem('credentials') || '{}');
-        return credentials.username;
+        const user = JSON.parse(localStorage.getItem('user') || '{}');
+        return user.username;
     }
 }
 
@@ -4,12 +4,16 @@ const itemsPerPage = 10; // Фиксированное значение
 let totalItems = 0;
 
 document.addEventListener('DOMContentLoaded', async function() {
+    // Продлеваем сессию незадолго до окончания; после входа через SSO
+    // сессия есть только в cookie
+    await authManager.refreshIfExpiring();
+
     // Проверка авторизации
     if (!authManager.checkAuthStatus()) {
         window.location.href = 'login.html';
         return;
     }
-    
+
     // Показываем имя пользователя
     document.getElementById('username-display').textContent = authManager.getCurrentUser();
     
@@ -89,6 +93,13 @@ function updateStats(showingCount) {
     document.getElementById('showing-count').textContent = showingCount;
 }
 
+// Экранирование для текста и значений атрибутов в кавычках
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML.replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+}
+
 function renderUrlsList(urls) {
     const urlsList = document.getElementById('urls-list');
     
@@ -102,18 +113,32 @@ function renderUrlsList(urls) {
                         <div class="d-flex align-items-center mb-2">
                             <span class="badge bg-secondary me-2">${globalIndex}</span>
                             <h6 class="card-title mb-0">
-                                <a href="${url.url}" target="_blank" class="text-truncate d-inline-block" style="max-width: 400px;">
-                                    ${url.url}
+                                ${url.metadata && url.metadata.favicon ? `<img src="${escapeHtml(url.metadata.favicon)}" width="16" height="16" class="me-1" alt="" onerror="this.remove()">` : ''}
+                                ${url.title ? `<strong>${escapeHtml(url.title)}</strong><br>` : ''}
+                                ${!url.title && url.metadata && url.metadata.title ? `<strong>${escapeHtml(url.metadata.title)}</strong><br>` : ''}
+                                <a href="${escapeHtml(url.url)}" target="_blank" class="text-truncate d-inline-block" style="max-width: 400px;">
+                                    ${escapeHtml(url.url)}
                                 </a>
                             </h6>
                         </div>
+                        ${url.metadata && url.metadata.description ? `<p class="card-text small text-muted mb-1">${escapeHtml(url.metadata.description)}</p>` : ''}
                         <p class="card-text mb-1">
                             <strong>Короткая ссылка:</strong> 
                             <a href="${API_BASE}/${url.alias}" target="_blank">${API_BASE}/${url.alias}</a>
+                            <a href="${API_BASE}/${url.alias}+" target="_blank" class="ms-2 small">Предпросмотр</a>
+                            <a href="${API_BASE}/api/urls/qr/${url.alias}" target="_blank" class="ms-2 small">QR-код</a>
                         </p>
                         <small class="text-muted">
                             Создано: ${new Date(url.created_at).toLocaleDateString('ru-RU')} | 
                             Переходов: <span class="badge bg-info">${url.count}</span>
+                            ${url.utm_campaign ? `| Кампания: <span class="badge bg-success">${[url.utm_source, url.utm_medium, url.utm_campaign].filter(Boolean).join(' / ')}</span>` : ''}
+                            ${url.redirect_type ? `| Перенаправление: <span class="badge bg-secondary">${url.redirect_type}</span>` : ''}
+                            ${url.targets ? `| Правила: <span class="badge bg-warning text-dark" title="${escapeHtml(url.targets.map(t => [t.os, t.device, t.country].filter(Boolean).join('/') + ' → ' + t.url).join('\n'))}">${url.targets.length}</span>` : ''}
+                            ${url.variants ? `| A/B: <span class="badge bg-primary">${escapeHtml(url.variants.map(v => `${v.weight}: ${v.count || 0}`).join(' / '))}</span>` : ''}
+                            ${url.active_from || url.active_until || url.schedule ? `| Расписание: <span class="badge bg-info text-dark" title="${escapeHtml([url.active_from ? 'с ' + new Date(url.active_from).toLocaleString() : '', url.active_until ? 'до ' + new Date(url.active_until).toLocaleString() : '', ...(url.schedule || []).map(c => new Date(c.at).toLocaleString() + ' → ' + c.url)].filter(Boolean).join('\n'))}">${(url.schedule || []).length} смен</span>` : ''}
+                            ${url.countries ? `| Страны: <span class="badge bg-light text-dark">${escapeHtml(Object.entries(url.countries).sort((a, b) => b[1] - a[1]).slice(0, 3).map(([country, clicks]) => `${country} ${clicks}`).join(', '))}</span>` : ''}
+                            ${url.threat ? `| <span class="badge bg-danger">Отключена: ${escapeHtml(url.threat)}</span>` : ''}
+                            ${url.health && url.health.broken ? `| <span class="badge bg-danger" title="${escapeHtml(url.health.error || 'HTTP ' + url.health.status)}">Не работает</span>` : ''}
                         </small>
                     </div>
                     <div class="col-md-4 text-end">
@@ -122,6 +147,11 @@ function renderUrlsList(urls) {
                                 title="Копировать ссылку">
                             📋 Копировать
                         </button>
+                        <button class="btn btn-sm btn-outline-secondary me-2" 
+                                onclick="refreshMetadata('${url.alias}')"
+                                title="Обновить название и описание страницы">
+                            🔄 Обновить
+                        </button>
                         <button class="btn btn-sm btn-outline-danger" 
                                 onclick="deleteUrl('${url.alias}')"
                                 title="Удалить ссылку">
@@ -194,6 +224,21 @@ async function deleteUrl(alias) {
     }
 }
 
+async function refreshMetadata(alias) {
+    try {
+        const result = await api.refreshMetadata(alias);
+        
+        if (result.status === 'OK') {
+            await loadUserUrls();
+            showTempAlert('✅ Данные страницы обновлены', 'success');
+        } else {
+            showTempAlert(`❌ ${escapeHtml(result.error || 'Ошибка обновления')}`, 'danger');
+        }
+    } catch (error) {
+        showTempAlert('❌ Ошибка сети', 'danger');
+    }
+}
+
 function copyUrl(url) {
     navigator.clipboard.writeText(url).then(() => {
         // Показываем временное уведомление
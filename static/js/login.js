@@ -4,6 +4,13 @@ document.addEventListener('DOMContentLoaded', function() {
     const showRegister = document.getElementById('show-register');
     const showLogin = document.getElementById('show-login');
     
+    // Кнопка SSO показывается, только если вход через OIDC настроен
+    api.getConfig().then(config => {
+        if (config.oidc) {
+            document.getElementById('oidc-login').style.display = 'block';
+        }
+    }).catch(() => {});
+    
     // Переключение между формами
     showRegister.addEventListener('click', function(e) {
         e.preventDefault();
@@ -12,16 +12,14 @@ document.addEventListener('DOMContentLoaded', function() {
             return;
         }
         
-        // Валидация паттерна
-        const pattern = /^[a-zA-Z0-9_-]+$/;
-        if (!pattern.test(alias)) {
-            aliasStatus.innerHTML = '<span class="text-danger">❌ Используйте только буквы, цифры, - и _</span>';
-            return;
-        }
-        
         try {
-            const result = await api.checkAlias(alias);
-            if (result.exists) {
+            // Длина и допустимые символы алиаса настраиваются на сервере
+            const result = await api.checkAlias(encodeURIComponent(alias));
+            if (!result.valid) {
+                aliasStatus.innerHTML = '<span class="text-danger">❌ Недопустимая длина или символы алиаса</span>';
+            } else if (result.reserved) {
+                aliasStatus.innerHTML = '<span class="text-danger">❌ Этот алиас зарезервирован</span>';
+            } else if (result.exists) {
                 aliasStatus.innerHTML = '<span class="text-danger">❌ Этот алиас уже занят</span>';
             } else {
                 aliasStatus.innerHTML = '<span class="text-success">✅ Алиас доступен</span>';
@@ -49,12 +47,25 @@ document.addEventListener('DOMContentLoaded', function() {
         shortenBtn.textContent = 'Создание...';
         
         try {
-            const result = await api.shortenUrl({ url, alias });
+            const redirectType = parseInt(document.getElementById('redirect-type-input').value, 10);
+            const result = await api.shortenUrl({
+                url,
+                alias,
+                title: document.getElementById('title-input').value.trim() || undefined,
+                redirect_type: redirectType || undefined,
+                forward_query: document.getElementById('forward-query-input').checked,
+                forward_path: document.getElementById('forward-path-input').checked,
+                utm_source: document.getElementById('utm-source-input').value.trim() || undefined,
+                utm_medium: document.getElementById('utm-medium-input').value.trim() || undefined,
+                utm_campaign: document.getElementById('utm-campaign-input').value.trim() || undefined
+            });
             
             if (result.status === 'OK') {
-                const shortUrl = `${API_BASE}/${alias}`;
+                // Если у пользователя уже есть ссылка на этот адрес, сервер возвращает ее алиас
+                const shortUrl = `${API_BASE}/${result.alias || alias}`;
+                const title = result.alias && result.alias !== alias ? 'Ссылка на этот адрес уже существует' : 'Ссылка создана!';
                 showResult(`
-                    <h5>✅ Ссылка создана!</h5>
+                    <h5>✅ ${title}</h5>
                     <div class="mt-2">
                         <strong>Короткая ссылка:</strong><br>
                         <a href="${shortUrl}" target="_blank">${shortUrl}</a>